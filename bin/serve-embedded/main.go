@@ -0,0 +1,61 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"log"
+	"os"
+	"time"
+
+	"github.com/halverneus/static-file-server/cli"
+	"github.com/halverneus/static-file-server/storage"
+)
+
+// content served in place of FOLDER. Replace the files in the 'content' folder
+// with the content to embed before building.
+//
+//go:embed all:content
+var content embed.FS
+
+// buildTime is the RFC 3339 time the binary was built, used as the
+// modification time of the content. Set it when building with:
+//
+//	go build -ldflags "-X main.buildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// If not set, the modification time of the binary is used.
+var buildTime string
+
+func main() {
+	modTime, err := contentModTime()
+	if nil != err {
+		log.Fatalf("Error: %v\n", err)
+	}
+	root, err := fs.Sub(content, "content")
+	if nil != err {
+		log.Fatalf("Error: %v\n", err)
+	}
+	fsys, err := storage.Embedded(root, modTime)
+	if nil != err {
+		log.Fatalf("Error: %v\n", err)
+	}
+	if err := cli.ExecuteFS(fsys); nil != err {
+		log.Fatalf("Error: %v\n", err)
+	}
+}
+
+// contentModTime returns the build time or, if not set, the modification time
+// of the binary.
+func contentModTime() (time.Time, error) {
+	if "" != buildTime {
+		return time.Parse(time.RFC3339, buildTime)
+	}
+	executable, err := os.Executable()
+	if nil != err {
+		return time.Time{}, err
+	}
+	info, err := os.Stat(executable)
+	if nil != err {
+		return time.Time{}, err
+	}
+	return info.ModTime().UTC(), nil
+}
@@ -3,6 +3,7 @@ package cli
 import (
 	"flag"
 	"fmt"
+	"io/fs"
 
 	"github.com/halverneus/static-file-server/cli/help"
 	"github.com/halverneus/static-file-server/cli/server"
@@ -51,6 +52,13 @@ func Execute() (err error) {
 	return job()
 }
 
+// ExecuteFS executes CLI arguments, serving files from the file system in place
+// of the configured storage backend.
+func ExecuteFS(fsys fs.FS) error {
+	server.UseFileSystem(fsys)
+	return Execute()
+}
+
 func selectionRoutine(args Args) func() error {
 	switch {
 
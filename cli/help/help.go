@@ -33,6 +33,46 @@ DEPENDENCIES
     None... not even libc!
 
 ENVIRONMENT VARIABLES
+    ARCHIVE_DOWNLOADS
+        When set to 'true' (and SHOW_LISTING is 'true') directories can be
+        downloaded as a single zip or gzipped tar archive by adding the query
+        parameter 'download=zip' or 'download=tar.gz' to the directory URL. The
+        archive is streamed without temporary files. Symbolic links to files are
+        followed and symbolic links to directories are skipped. Default value is
+        'false'.
+    ARCHIVE_MAX_BYTES
+        The maximum combined size in bytes of the files in a directory archive
+        before compression. Larger directories return 'FORBIDDEN'. If not
+        supplied or set to '0', the size is unlimited.
+    ARCHIVE_MAX_FILES
+        The maximum number of files in a directory archive. Directories with
+        more files return 'FORBIDDEN'. If not supplied or set to '0', the number
+        of files is unlimited.
+    BACKEND
+        The storage backend the contents are served from. Set to 'local' to
+        serve a directory on the local file system, 'archive' to serve the
+        contents of a zip, tar or gzipped tar archive file or 's3' to serve the
+        objects of a bucket in S3-compatible object storage (see S3_*). If not
+        supplied, 'archive' is used when FOLDER is an archive file ('.zip',
+        '.tar', '.tar.gz' or '.tgz') and 'local' otherwise.
+    CACHE_CONTROL
+        The value of the 'Cache-Control' header set on successful responses
+        (e.g. 'public, max-age=3600'). Error responses are left uncached. If not
+        supplied, no 'Cache-Control' header is set.
+    CLEAN_URLS
+        When set to 'true' pages are served without the '.html' extension. For
+        example, 'about.html' is retrieved with 'http://127.0.0.1/about' and
+        'http://127.0.0.1/about.html' is permanently redirected there, unless a
+        file or directory named 'about' exists. Index files are still governed
+        by ALLOW_INDEX and SHOW_LISTING. Default value is 'false'.
+    CONTENT_SNIFFING
+        When set to 'false' files with an extension without a known content
+        type are served as 'application/octet-stream' instead of having their
+        content type detected from their contents, and the header
+        'X-Content-Type-Options: nosniff' tells browsers not to detect it
+        either. Content types of common web formats are built in and can be
+        overridden per extension with 'mime-types' and 'charsets' in the YAML
+        configuration file. Default value is 'true'.
     CORS
         When set to 'true' it enables resource access from any domain. All
         responses will include the headers 'Access-Control-Allow-Origin' and
@@ -42,14 +82,180 @@ ENVIRONMENT VARIABLES
         configuration used and an access log for each request. IMPORTANT NOTE:
         The configuration summary is printed to stdout while logs generated
         during execution are printed to stderr. Default value is 'false'.
+    DIGESTS
+        When set to 'true' the 'Repr-Digest' (RFC 9530) and 'Digest' headers of
+        files are set to their SHA-256 digest, and requests for 'FILE.sha256'
+        or 'FILE.md5' where FILE exists but the checksum file doesn't are served
+        a checksum file in the format of 'sha256sum' or 'md5sum'. Digests are
+        computed when first requested and cached until the file changes.
+        Default value is 'false'.
+        Example:
+          wget http://my.machine/build.tgz http://my.machine/build.tgz.sha256
+          sha256sum -c build.tgz.sha256
+    DOWNLOADS
+        A comma-separated list of patterns of files always served as
+        attachments ('Content-Disposition: attachment'), which browsers
+        download rather than display. Patterns starting with '/' match the path
+        of the file (relative to URL_PREFIX), other patterns containing '/'
+        match the content type of the file and the rest match the file name.
+        '*' doesn't match '/'. Any file is served as an attachment when
+        requested with the 'download' query parameter or the 'filename' query
+        parameter, which also sets the name of the downloaded file. If not
+        supplied, only requested downloads are attachments.
+        Example:
+          DOWNLOADS='*.pdf,/reports/*,application/zip'
+          wget 'http://my.machine/notes.txt?filename=notes-2024.txt'
+    ERROR_PAGES
+        A comma-separated list of error pages, each formatted as 'CODE=FILE',
+        used as the body of HTTP error responses with the matching status code
+        in place of the default plain text message. Relative file paths are
+        relative to the first folder in FOLDER containing the file. Error pages
+        limited to a URL path prefix can be set in the YAML configuration file.
+        If not supplied, the default plain text messages are used.
+        Example:
+          ERROR_PAGES='404=errors/404.html,403=/etc/server/403.html'
     FOLDER
         The path to the folder containing the contents to be served over
-        HTTP(s). If not supplied, defaults to '/web' (for Docker reasons).
+        HTTP(s). If not supplied, defaults to '/web' (for Docker reasons). A
+        comma-separated list of folders is layered, with each request served
+        from the first folder containing the file, directory listings merged
+        from all folders and index files found in any folder. Folders that are
+        archive files are served from the archive (see BACKEND).
+        Example:
+          FOLDER='/web/team,/web/theme'
+    HEADERS_FILES
+        When set to 'true' custom response headers are read from '_headers'
+        files in the served folders. Each unindented line is a URL path, with
+        ':name' segments matching any segment and a final '*' matching the rest
+        of the path, followed by indented 'Name: value' header lines. Paths are
+        relative to the directory of the '_headers' file and files in deeper
+        directories take precedence. Files are reloaded when changed and are
+        never served. Headers from '_headers' files take precedence over
+        CACHE_CONTROL. Default value is 'false'.
+        Example '_headers' file:
+          /*
+            X-Frame-Options: DENY
+          /assets/*
+            Cache-Control: public, max-age=31536000, immutable
     HOST
         The hostname used for binding. If not supplied, contents will be served
         to a client without regard for the hostname.
+    IMAGE_CACHE
+        Path to a directory where images resized for IMAGE_SIZES are cached,
+        keyed by the modification time of the image. The directory is created
+        if it doesn't exist. If not supplied, images are resized for every
+        request.
+    IMAGE_CACHE_BYTES
+        The combined size in bytes of the resized images cached in IMAGE_CACHE
+        for each folder. When exceeded, the least recently used images are
+        removed. If set to '0', the cache isn't limited. Default value is
+        '1073741824' (1 GiB).
+    IMAGE_SIZES
+        A comma-separated list of the sizes ('WIDTHxHEIGHT' in pixels, where a
+        '0' width or height keeps the aspect ratio) that PNG, JPEG and GIF
+        images can be resized to with the 'w' and 'h' query parameters. The
+        'fit' query parameter is 'contain' (default), 'cover' (cropped) or
+        'fill' (stretched) and the 'format' query parameter converts the image
+        to 'jpeg', 'png' or 'gif'. Other sizes, and conversions without a
+        size, return '400 Bad Request'. Images are never enlarged and only the
+        first frame of GIF images is kept. If not supplied, images are not
+        resized.
+        Example:
+          IMAGE_SIZES='200x200,800x0'
+          wget 'http://my.machine/photos/cat.jpg?w=200&h=200&fit=cover'
+    INDEX_FILES
+        A comma-separated list of the names of index files, in order of
+        precedence. The first index file found in a directory is served for the
+        directory, including when a rewrite rule (see REDIRECTS) rewrites a
+        request to the directory, and directories with an index file are never
+        listed. Default value is 'index.html'.
+        Example:
+          INDEX_FILES='index.html,index.htm,default.html,README.html'
+    LISTING_TEMPLATE
+        Path to a Go 'html/template' file used to render directory listings
+        when SHOW_LISTING is 'true'. The template is executed with the listing
+        path, breadcrumbs, entries (name, URL, size, modification time and
+        whether the entry is a directory) and current sort order. If not
+        supplied, the built-in template is used. Listings are sorted with the
+        'sort' ('name', 'size' or 'time') and 'order' ('asc' or 'desc') query
+        parameters.
+        Listings are returned as JSON, NDJSON or CSV instead of HTML when
+        requested with the 'format' query parameter ('json', 'ndjson' or 'csv')
+        or the 'Accept' header ('application/json', 'application/x-ndjson' or
+        'text/csv'). Entries are paginated with the 'offset' and 'limit' query
+        parameters (the 'Link' header points to the next page) and include file
+        checksums when requested with the 'checksum' query parameter ('md5',
+        'sha1' or 'sha256').
+        Example:
+          wget 'http://my.machine/builds/?format=json&limit=100&checksum=sha256'
+    MARKDOWN
+        When set to 'true' Markdown files ('.md' and '.markdown') are served as
+        HTML to browsers (requests accepting 'text/html') and the README.md
+        file of a directory is rendered beneath its listing. The Markdown
+        source is served for other requests and for the 'raw' query parameter
+        (e.g. 'http://127.0.0.1/docs/guide.md?raw'). Raw HTML within Markdown
+        files is escaped. Default value is 'false'.
+    MARKDOWN_CSS
+        URL of a stylesheet linked from rendered Markdown files in place of the
+        built-in styles (e.g. '/assets/docs.css').
+    MARKDOWN_TEMPLATE
+        Path to a Go 'html/template' file used to render Markdown files. The
+        template is executed with the URL path, title (the first level 1
+        heading or the file name), rendered content, stylesheet URL and URL of
+        the Markdown source. If not supplied, the built-in template is used.
+    MEMORY_CACHE_BYTES
+        The combined size in bytes of the small, recently requested files held
+        in memory, which are then served without reading the folder. Each mount
+        and virtual host has a cache of its own. If not supplied or set to '0',
+        files aren't cached.
+    MEMORY_CACHE_FILE_BYTES
+        The size in bytes of the largest file held in memory when
+        MEMORY_CACHE_BYTES is set. If set to '0', files are only limited by
+        MEMORY_CACHE_BYTES. Default value is '1048576' (1 MiB).
+    MEMORY_CACHE_INTERVAL
+        How often a file held in memory is checked for changes to its
+        modification time or size, as a duration (e.g. '500ms' or '1m'). If set
+        to '0s', files are checked on every request, which still avoids reading
+        them. Default value is '1s'.
+    METADATA_CACHE
+        When set to 'true' the file information and directory contents of
+        local folders, including files that don't exist, are cached and shared
+        by every request. On Linux, folders are watched with inotify and cached
+        metadata is invalidated as files change. Elsewhere, or if a folder
+        can't be watched, cached metadata expires after
+        METADATA_CACHE_INTERVAL. Default value is 'false'.
+    METADATA_CACHE_INTERVAL
+        How long cached metadata is kept when a folder isn't watched, as a
+        duration (e.g. '500ms' or '1m'). Default value is '1s'.
     PORT
         The port used for binding. If not supplied, defaults to port '8080'.
+    PRELOAD
+        When set to 'true' the folders are read when the server starts, for
+        content that doesn't change while served (such as a read-only container
+        image). The file information, directory contents and entity tags of all
+        files are kept, and gzip compressed variants of text and other
+        compressible files are served to clients accepting 'gzip'. A summary is
+        logged when the server starts. Default value is 'false'.
+    PRELOAD_MEMORY
+        When set to 'true' (and PRELOAD is 'true') the content of every file is
+        held in memory too. Default value is 'false'.
+    REDIRECTS
+        The path to a rules file, in the format of '_redirects' files, of
+        redirects and rewrites applied to requests before files are served. Each
+        line is 'FROM [QUERY...] TO [STATUS[!]] [Host=PATTERN,...]'. FROM is a
+        URL path where ':name' segments are placeholders and a final '*' is the
+        ':splat' placeholder, QUERY are 'name=value' query parameters to match
+        (a ':name' value is a placeholder) and STATUS is 301 (the default),
+        302, 307, 308 or 200 for a rewrite served from the TO path. The first
+        matching rule is applied, unless the path names an existing file and
+        the status isn't followed by '!'. The file is reloaded when changed. If
+        not supplied, no rules are applied.
+        Example file:
+          /old.html          /new.html
+          /blog/:year/*      /news/:year/:splat  308
+          /store  id=:id     /products/:id       302
+          /app/*             /app/index.html     200
+          /*                 https://example.com/:splat  301!  Host=old.example.com
     REFERRERS
         A comma-separated list of acceped Referrers based on the 'Referer' HTTP
         header. If incoming header value is not in the list, a 403 HTTP error is
@@ -61,18 +267,69 @@ ENVIRONMENT VARIABLES
         Examples:
           REFERRERS='http://localhost,https://some.site,http://other.site:8080'
           REFERRERS=',http://localhost,https://some.site,http://other.site:8080'
+    RELOAD_INTERVAL
+        How often the configuration file is checked for changes to its
+        modification time, as a duration (e.g. '5s' or '1m'), reloading the
+        configuration when it changed (see RELOADING). If not supplied or set to
+        '0s', the configuration is only reloaded on SIGHUP. Default value is
+        '0s'.
     ALLOW_INDEX
-        When set to 'true' the index.html file in the folder(not include the 
-        sub folders) will be served. And the file list will not be served. 
+        When set to 'true' the index file (see INDEX_FILES) in the folder(not
+        include the sub folders) will be served. And the file list will not be
+        served. 
         For example, if the client requests  'http://127.0.0.1/' the 'index.html'
         file in the root of the directory being served is returned. Default value
         is 'true'.
+    S3_ACCESS_KEY
+    S3_SECRET_KEY
+        Credentials used to sign requests to object storage when BACKEND is
+        's3'. If not supplied, requests are anonymous.
+    S3_BUCKET
+        The name of the bucket to serve when BACKEND is 's3'. Required.
+    S3_ENDPOINT
+        The URL of the S3-compatible object storage service. Default value is
+        'https://s3.amazonaws.com'.
+        Example:
+          S3_ENDPOINT='http://minio.local:9000'
+    S3_PATH_STYLE
+        When set to 'true' the bucket is addressed in the URL path (e.g.
+        'http://minio.local:9000/bucket/key') rather than the hostname (e.g.
+        'https://bucket.s3.amazonaws.com/key'), as required by many
+        self-hosted services. Default value is 'false'.
+    S3_PREFIX
+        The prefix of the keys of the objects to serve. For example, with the
+        prefix 'sites/docs' the object 'sites/docs/index.html' is retrieved
+        with 'http://127.0.0.1/index.html'. If not supplied, the whole bucket
+        is served.
+    S3_REGION
+        The region used to sign requests. Default value is 'us-east-1'.
+    S3_TIMEOUT
+        How long connecting to object storage and waiting for the response to
+        a request may take when BACKEND is 's3', as a duration (e.g. '10s').
+        Transferring the contents of objects isn't limited, so that large
+        files can be served to slow clients. Default value is '30s'.
+    SERVE_ARCHIVES
+        When set to 'true' zip, tar and gzipped tar archives ('.zip', '.tar',
+        '.tar.gz' and '.tgz') within FOLDER are served as directories when
+        requested with a trailing slash. For example, 'index.html' within
+        'docs.zip' is retrieved with 'http://127.0.0.1/docs.zip/index.html'
+        while 'http://127.0.0.1/docs.zip' retrieves the archive itself. Range
+        requests are supported and, if SHOW_LISTING is 'true', directories
+        within archives are listed like all other directories. To serve the
+        contents of an archive as FOLDER see BACKEND. Default value is 'false'.
     SHOW_LISTING
         Automatically serve the index file for the directory if requested. For
         example, if the client requests 'http://127.0.0.1/' the 'index.html'
         file in the root of the directory being served is returned. If the value
         is set to 'false', the same request will return a 'NOT FOUND'. Default
         value is 'true'.
+    SHUTDOWN_TIMEOUT
+        How long active requests are waited for when the server receives
+        SIGTERM or SIGINT, as a duration (e.g. '10s' or '1m'). New connections
+        are refused while waiting, remaining connections are closed afterwards
+        and the server exits with status 0. Keep it below the grace period of
+        the orchestrator (30 seconds by default in Kubernetes). If set to '0s',
+        connections are closed immediately. Default value is '25s'.
     TLS_CERT
         Path to the TLS certificate file to serve files using HTTPS. If supplied
         then TLS_KEY must also be supplied. If not supplied, contents will be
@@ -85,6 +342,17 @@ ENVIRONMENT VARIABLES
         The minimum TLS version to use. If not supplied, defaults to TLS1.0.
         Acceptable values are 'TLS10', 'TLS11', 'TLS12' and 'TLS13' for TLS1.0,
         TLS1.1, TLS1.2 and TLS1.3, respectively. Values are not case-sensitive.
+    TRAILING_SLASH
+        How trailing slashes of the URL paths of directories (and, with
+        CLEAN_URLS, pages) are normalized. Set to 'add' to permanently redirect
+        paths without a trailing slash or 'remove' to permanently redirect paths
+        with one, serving directories without the slash. If not supplied, paths
+        are served as requested.
+    UNKNOWN_HOSTS
+        When virtual hosts are configured, the status code returned for
+        requests with a host that doesn't match any virtual host. Set to '404'
+        for 'NOT FOUND' or '421' for 'MISDIRECTED REQUEST'. If not supplied,
+        the top-level site is served.
     URL_PREFIX
         The prefix to use in the URL path. If supplied, then the prefix must
         start with a forward-slash and NOT end with a forward-slash. If not
@@ -120,8 +388,75 @@ CONFIGURATION FILE
     referrers:
       - http://localhost
       - https://mydomain.com
+    error-pages:
+      - code: 404
+        file: errors/404.html
+      - code: 404
+        file: errors/docs-404.html
+        prefix: /docs
+    mime-types:
+      .webmanifest: application/manifest+json
+      .log: text/plain
+    charsets:
+      .txt: iso-8859-1
+    mounts:
+      - url-prefix: /downloads
+        folder: /srv/downloads
+        show-listing: true
+        cache-control: no-cache
+      - url-prefix: /docs
+        folder: /srv/docs.zip
+        access-key: docs-key
+    virtual-hosts:
+      - hosts:
+          - docs.example.com
+          - "*.docs.example.com"
+        folder: /srv/docs
+        tls-cert: /etc/server/docs.pem
+        tls-key: /etc/server/docs.key
+      - hosts:
+          - assets.example.com
+        folder: /srv/assets
+        cache-control: public, max-age=86400
+    unknown-hosts: "404"
     ----------------------------------------------------------------------------
 
+    Mounts can only be set in the YAML configuration file. Each mount serves a
+    local folder, archive file or comma-separated list of folders at a URL path
+    prefix, with the longest matching prefix taking precedence over shorter
+    ones and over FOLDER. The settings 'show-listing', 'allow-index', 'cors',
+    'access-key' and 'cache-control' of a mount default to the top-level
+    values when not set. A mount can have its own 'redirects' rules file, with
+    paths including the URL prefix. BACKEND only applies to FOLDER.
+
+    Virtual hosts can only be set in the YAML configuration file. Each virtual
+    host serves a local folder, archive file or comma-separated list of folders
+    for requests with a 'Host' header matching one of its host names. A host
+    name starting with '*.' matches every subdomain. Exact host names take
+    precedence over wildcards. The URL prefix of a virtual host defaults to no
+    prefix and the other settings default to the top-level values. A virtual
+    host with its own TLS certificate (requires TLS_CERT and TLS_KEY for the
+    default certificate) is presented that certificate using SNI, and requests
+    for a host that wasn't presented the certificate of the connection return
+    'MISDIRECTED REQUEST'. Requests for unknown hosts are served by the
+    top-level site, unless UNKNOWN_HOSTS is set. Mounts apply to the top-level
+    site only, while error pages apply to every site.
+
+    Content types can only be overridden in the YAML configuration file.
+    'mime-types' maps file extensions to content types, taking precedence over
+    the built-in table, and 'charsets' sets the charset of the content types
+    of file extensions. Text types without a charset are served as 'utf-8'.
+
+RELOADING
+    When the server receives SIGHUP (or, with RELOAD_INTERVAL, when the
+    configuration file changes) the configuration file and environment
+    variables are loaded again and the handlers of every site are replaced
+    without interrupting requests. The changed settings are logged. If the new
+    configuration isn't valid, the current configuration is kept and the error
+    is logged. Changes to HOST, PORT, TLS_CERT, TLS_KEY, TLS_MIN_VERS,
+    SHUTDOWN_TIMEOUT and RELOAD_INTERVAL take effect when the server is
+    restarted.
+
 USAGE
     FILE LAYOUT
        /var/www/sub/my.file
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/halverneus/static-file-server/config"
+	"github.com/halverneus/static-file-server/handle"
+	"github.com/halverneus/static-file-server/storage"
+)
+
+var (
+	// metadataCaches of the active handler, which stop watching their folders
+	// when the handler is replaced.
+	metadataCaches []*storage.MetadataFS
+
+	// This assignment is for unit testing.
+	notifyReload = signal.Notify
+)
+
+// restartSettings are the settings of the listener, which only take effect
+// when the server is restarted.
+var restartSettings = map[string]bool{
+	"host":             true,
+	"port":             true,
+	"tls-cert":         true,
+	"tls-key":          true,
+	"tls-min-vers":     true,
+	"shutdown-timeout": true,
+	"reload-interval":  true,
+}
+
+// watchReloads reloads the configuration when SIGHUP is received or, if an
+// interval is configured, when the modification time of the configuration file
+// changes. The returned function stops watching, waiting for a reload in
+// progress to complete.
+func watchReloads() (stop func()) {
+	signals := make(chan os.Signal, 1)
+	notifyReload(signals, syscall.SIGHUP)
+
+	filename := config.File()
+	var ticker *time.Ticker
+	var ticks <-chan time.Time
+	if 0 < len(filename) && 0 < config.Get.ReloadIntvl {
+		ticker = time.NewTicker(config.Get.ReloadIntvl)
+		ticks = ticker.C
+	}
+	modTime := fileModTime(filename)
+
+	done, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-done:
+				return
+			case received := <-signals:
+				log.Printf("Received %v, reloading the configuration\n", received)
+				reload()
+			case <-ticks:
+				// Files that can't be read, such as while being replaced, are
+				// checked again later.
+				if changed := fileModTime(filename); !changed.IsZero() && !changed.Equal(modTime) {
+					modTime = changed
+					log.Printf("Configuration file %s changed, reloading it\n", filename)
+					reload()
+				}
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		if nil != ticker {
+			ticker.Stop()
+		}
+		close(done)
+		<-stopped
+	}
+}
+
+// reload the configuration and replace the active handler and its settings. If
+// the reloaded configuration isn't valid, or its handler can't be created, the
+// current configuration, handler and settings are kept.
+func reload() {
+	previousCaches := metadataCaches
+	metadataCaches = nil
+
+	var settings *handle.Settings
+	var handler http.HandlerFunc
+	changes, err := config.Reload(func() (err error) {
+		settings, handler, err = selectHandler()
+		return
+	})
+	if nil != err {
+		closeMetadataCaches(metadataCaches)
+		metadataCaches = previousCaches
+		log.Printf("Keeping the current configuration as reloading it failed: %v\n", err)
+		return
+	}
+	handle.Activate(settings, handler)
+	closeMetadataCaches(previousCaches)
+
+	log.Printf("Reloaded the configuration (changed settings: %d)\n", len(changes))
+	for _, change := range changes {
+		if restartSettings[change.Setting] {
+			log.Printf("Changed %v (takes effect when restarted)\n", change)
+		} else {
+			log.Printf("Changed %v\n", change)
+		}
+	}
+	if config.Get.Debug {
+		config.Log()
+	}
+}
+
+// closeMetadataCaches stops the metadata caches from watching their folders.
+func closeMetadataCaches(caches []*storage.MetadataFS) {
+	for _, cache := range caches {
+		cache.Close()
+	}
+}
+
+// fileModTime returns the modification time of the file or the zero time if
+// it can't be read.
+func fileModTime(filename string) time.Time {
+	if 0 == len(filename) {
+		return time.Time{}
+	}
+	stat, err := os.Stat(filename)
+	if nil != err {
+		return time.Time{}
+	}
+	return stat.ModTime()
+}
@@ -0,0 +1,243 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/halverneus/static-file-server/config"
+	"github.com/halverneus/static-file-server/handle"
+)
+
+func TestReload(t *testing.T) {
+	root := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(root, "page.html"), []byte("page"), 0600); nil != err {
+		t.Fatalf("While writing file got %v", err)
+	}
+	filename := filepath.Join(t.TempDir(), "config.yml")
+	write := func(contents string) {
+		if err := ioutil.WriteFile(filename, []byte("folder: "+root+"\n"+contents), 0600); nil != err {
+			t.Fatalf("While writing configuration file got %v", err)
+		}
+	}
+	defer func() {
+		notifyReload = signal.Notify
+		config.Get.Folder = "/web"
+		config.Get.Referrers = nil
+		config.Get.MetaCache = false
+	}()
+
+	// Capture the channel notified of signals so the test can send them.
+	signals := make(chan chan<- os.Signal, 1)
+	notifyReload = func(c chan<- os.Signal, sig ...os.Signal) {
+		signals <- c
+	}
+
+	write("metadata-cache: true\n")
+	if err := config.Load(filename); nil != err {
+		t.Fatalf("While loading configuration got %v", err)
+	}
+	settings, handler, err := handlerSelector()
+	if nil != err {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	handle.Activate(settings, handler)
+	stop := watchReloads()
+	notify := <-signals
+
+	request := func() int {
+		w := httptest.NewRecorder()
+		handle.ServeActive(w, httptest.NewRequest("GET", "http://localhost/page.html", nil))
+		return w.Code
+	}
+	awaitCode := func(expected int) int {
+		code := request()
+		for start := time.Now(); expected != code && time.Since(start) < 5*time.Second; code = request() {
+			time.Sleep(10 * time.Millisecond)
+		}
+		return code
+	}
+	if code := request(); http.StatusOK != code {
+		t.Errorf("Before reloading expected status code of %d but got %d", http.StatusOK, code)
+	}
+
+	// Reloading replaces the handler and the metadata caches of the previous
+	// handler.
+	previousCaches := metadataCaches
+	write("metadata-cache: true\nreferrers: [https://allowed.example.com]\n")
+	notify <- syscall.SIGHUP
+	if code := awaitCode(http.StatusForbidden); http.StatusForbidden != code {
+		t.Errorf("After reloading expected status code of %d but got %d", http.StatusForbidden, code)
+	}
+	stop()
+	if 1 != len(metadataCaches) || previousCaches[0] == metadataCaches[0] {
+		t.Errorf("After reloading expected a new metadata cache but got %v", metadataCaches)
+	}
+
+	// Invalid configurations keep the current handler.
+	write("referrers: []\npreload-memory: true\n")
+	reload()
+	if code := request(); http.StatusForbidden != code {
+		t.Errorf("After an invalid reload expected status code of %d but got %d", http.StatusForbidden, code)
+	}
+	if 0 == len(config.Get.Referrers) {
+		t.Error("After an invalid reload expected the previous configuration")
+	}
+}
+
+func TestReloadConfigFile(t *testing.T) {
+	root := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(root, "page.html"), []byte("page"), 0600); nil != err {
+		t.Fatalf("While writing file got %v", err)
+	}
+	filename := filepath.Join(t.TempDir(), "config.yml")
+	write := func(contents string, modTime time.Time) {
+		contents = "folder: " + root + "\nreload-interval: 10ms\n" + contents
+		if err := ioutil.WriteFile(filename, []byte(contents), 0600); nil != err {
+			t.Fatalf("While writing configuration file got %v", err)
+		}
+		if err := os.Chtimes(filename, modTime, modTime); nil != err {
+			t.Fatalf("While setting modification time got %v", err)
+		}
+	}
+	defer func() {
+		notifyReload = signal.Notify
+		config.Get.Folder = "/web"
+		config.Get.Referrers = nil
+		config.Get.ReloadIntvl = 0
+	}()
+	notifyReload = func(chan<- os.Signal, ...os.Signal) {}
+
+	start := time.Now().Add(-time.Hour)
+	write("", start)
+	if err := config.Load(filename); nil != err {
+		t.Fatalf("While loading configuration got %v", err)
+	}
+	settings, handler, err := handlerSelector()
+	if nil != err {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	handle.Activate(settings, handler)
+	stop := watchReloads()
+	defer stop()
+
+	// The configuration is reloaded once the file is modified.
+	write("referrers: [https://allowed.example.com]\n", start.Add(time.Minute))
+	code := 0
+	for begin := time.Now(); http.StatusForbidden != code && time.Since(begin) < 5*time.Second; {
+		time.Sleep(10 * time.Millisecond)
+		w := httptest.NewRecorder()
+		handle.ServeActive(w, httptest.NewRequest("GET", "http://localhost/page.html", nil))
+		code = w.Code
+	}
+	if http.StatusForbidden != code {
+		t.Errorf("After modifying the file expected status code of %d but got %d", http.StatusForbidden, code)
+	}
+}
+
+func TestReloadSettings(t *testing.T) {
+	root := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(root, "file.qq"), []byte("qq"), 0600); nil != err {
+		t.Fatalf("While writing file got %v", err)
+	}
+	filename := filepath.Join(t.TempDir(), "config.yml")
+	write := func(contents string) {
+		if err := ioutil.WriteFile(filename, []byte("folder: "+root+"\n"+contents), 0600); nil != err {
+			t.Fatalf("While writing configuration file got %v", err)
+		}
+	}
+	defer func() {
+		config.Get.Folder = "/web"
+		config.Get.MimeTypes = nil
+		config.Get.Sniffing = true
+	}()
+
+	write("mime-types:\n  .qq: application/x-qq\n")
+	if err := config.Load(filename); nil != err {
+		t.Fatalf("While loading configuration got %v", err)
+	}
+	settings, handler, err := handlerSelector()
+	if nil != err {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	handle.Activate(settings, handler)
+	contentType := func() string {
+		w := httptest.NewRecorder()
+		handle.ServeActive(w, httptest.NewRequest("GET", "http://localhost/file.qq", nil))
+		return w.Header().Get("Content-Type")
+	}
+	if result := contentType(); "application/x-qq" != result {
+		t.Errorf("Before reloading expected content type 'application/x-qq' but got '%s'", result)
+	}
+
+	// Settings of failed reloads aren't applied.
+	write("mime-types:\n  .qq: application/x-other\npreload-memory: true\n")
+	reload()
+	if result := contentType(); "application/x-qq" != result {
+		t.Errorf("After an invalid reload expected content type 'application/x-qq' but got '%s'", result)
+	}
+
+	// Settings removed from the configuration are removed from the handler.
+	write("content-sniffing: false\n")
+	reload()
+	if result := contentType(); "application/octet-stream" != result {
+		t.Errorf("After removing the content type expected 'application/octet-stream' but got '%s'", result)
+	}
+}
+
+func TestRunReload(t *testing.T) {
+	root := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(root, "page.html"), []byte("page"), 0600); nil != err {
+		t.Fatalf("While writing file got %v", err)
+	}
+	filename := filepath.Join(t.TempDir(), "config.yml")
+	write := func(contents string) {
+		if err := ioutil.WriteFile(filename, []byte("folder: "+root+"\n"+contents), 0600); nil != err {
+			t.Fatalf("While writing configuration file got %v", err)
+		}
+	}
+	defer func() {
+		notifyReload = signal.Notify
+		selectListener = listenerSelector
+		config.Get.Folder = "/web"
+		config.Get.Port = 8080
+		config.Get.Referrers = nil
+	}()
+
+	write("port: 8081\n")
+	if err := config.Load(filename); nil != err {
+		t.Fatalf("While loading configuration got %v", err)
+	}
+
+	// Reload as soon as reloads are watched, changing the port after the
+	// listener is selected.
+	write("port: 8082\nreferrers: [https://allowed.example.com]\n")
+	notifyReload = func(c chan<- os.Signal, sig ...os.Signal) {
+		reload()
+	}
+	var binding string
+	selectListener = func() handle.ListenerFunc {
+		return func(listening string, handler http.HandlerFunc) error {
+			binding = listening
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest("GET", "http://localhost/page.html", nil))
+			if http.StatusForbidden != w.Code {
+				t.Errorf("After reloading expected status code of %d but got %d", http.StatusForbidden, w.Code)
+			}
+			return nil
+		}
+	}
+
+	if err := Run(); nil != err {
+		t.Errorf("Expected no error but got %v", err)
+	}
+	if ":8081" != binding {
+		t.Errorf("Expected the binding of the configuration served at start ':8081' but got '%s'", binding)
+	}
+}
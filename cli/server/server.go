@@ -1,41 +1,359 @@
 package server
 
 import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
 	"fmt"
+	"io/fs"
+	"log"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
 
 	"github.com/halverneus/static-file-server/config"
 	"github.com/halverneus/static-file-server/handle"
+	"github.com/halverneus/static-file-server/storage"
 )
 
 var (
 	// Values to be overridden to simplify unit testing.
-	selectHandler  = handlerSelector
-	selectListener = listenerSelector
+	selectHandler    = handlerSelector
+	selectListener   = listenerSelector
+	selectFileSystem = fileSystemSelector
 )
 
+// UseFileSystem to serve files from in place of the configured storage
+// backend, such as content embedded in the binary.
+func UseFileSystem(fsys fs.FS) {
+	selectFileSystem = func() (fs.FS, error) {
+		return fsys, nil
+	}
+}
+
 // Run server.
 func Run() error {
 	if config.Get.Debug {
 		config.Log()
 	}
 	// Choose and set the appropriate, optimized static file serving function.
-	handler := selectHandler()
+	settings, handler, err := selectHandler()
+	if nil != err {
+		return err
+	}
 
 	// Serve files over HTTP or HTTPS based on paths to TLS files being
-	// provided.
+	// provided. The listener and binding are selected before reloads are
+	// watched, as reloads replace the configuration.
 	listener := selectListener()
-
 	binding := fmt.Sprintf("%s:%d", config.Get.Host, config.Get.Port)
-	return listener(binding, handler)
+
+	// Replace the handler when the configuration is reloaded.
+	handle.Activate(settings, handler)
+	stop := watchReloads()
+	defer stop()
+
+	return listener(binding, handle.ServeActive)
 }
 
-// handlerSelector returns the appropriate request handler based on
-// configuration.
-func handlerSelector() (handler http.HandlerFunc) {
+// site is a folder served at a URL path prefix with its own settings.
+type site struct {
+	folder       string
+	urlPrefix    string
+	showListing  bool
+	allowIndex   bool
+	cors         bool
+	accessKey    string
+	cacheControl string
+	redirects    string
+}
+
+// topSite returns the site of the top-level configuration.
+func topSite() site {
+	return site{
+		folder:       config.Get.Folder,
+		urlPrefix:    config.Get.URLPrefix,
+		showListing:  config.Get.ShowListing,
+		allowIndex:   config.Get.AllowIndex,
+		cors:         config.Get.Cors,
+		accessKey:    config.Get.AccessKey,
+		cacheControl: config.Get.CacheControl,
+		redirects:    config.Get.Redirects,
+	}
+}
+
+// override the settings of the site with those that are set.
+func (s site) override(
+	showListing, allowIndex, cors *bool, accessKey, cacheControl string,
+) site {
+	if nil != showListing {
+		s.showListing = *showListing
+	}
+	if nil != allowIndex {
+		s.allowIndex = *allowIndex
+	}
+	if nil != cors {
+		s.cors = *cors
+	}
+	if "" != accessKey {
+		s.accessKey = accessKey
+	}
+	if "" != cacheControl {
+		s.cacheControl = cacheControl
+	}
+	return s
+}
+
+// handlerSelector returns the appropriate request handler, and the settings it
+// serves requests with, based on configuration.
+func handlerSelector() (settings *handle.Settings, handler http.HandlerFunc, err error) {
+	// The settings are activated together with the handler, so that requests
+	// are never served with the settings of another configuration.
+	settings = handle.NewSettings()
+
+	// Serve the configured index files for directories.
+	settings.SetIndexFiles(config.Get.IndexFiles)
+
+	// Serve files with the built-in and configured content types.
+	if err = settings.SetContentTypes(config.Get.MimeTypes, config.Get.Charsets); nil != err {
+		return
+	}
+	settings.SetContentSniffing(config.Get.Sniffing)
+
+	// If Markdown is rendered, render README files beneath listings too.
+	settings.SetListingReadme(config.Get.Markdown)
+
+	// Serve files from the configured storage backend.
+	fsys, err := selectFileSystem()
+	if nil != err {
+		return
+	}
+	handler, err = siteHandler(fsys, topSite(), settings)
+	if nil != err {
+		return
+	}
+
+	// If configured, serve the folders of mounts at their URL prefixes, with
+	// the longest matching prefix taking precedence.
+	if 0 != len(config.Get.Mounts) {
+		mounts := make([]handle.Mount, len(config.Get.Mounts))
+		for index, mount := range config.Get.Mounts {
+			if mounts[index], err = mountHandler(mount, settings); nil != err {
+				return
+			}
+		}
+		handler = handle.WithMounts(handler, mounts)
+	}
+
+	// If configured, serve the sites of virtual hosts for requests with a
+	// matching host, with the certificates of the virtual hosts selected
+	// using SNI.
+	if 0 != len(config.Get.VirtualHosts) {
+		hosts := make([]handle.VirtualHost, len(config.Get.VirtualHosts))
+		for index, host := range config.Get.VirtualHosts {
+			if hosts[index], err = virtualHostHandler(host, settings); nil != err {
+				return
+			}
+		}
+		// Validation limits unknown hosts to being unset (serving the
+		// top-level site) or a status code.
+		unknownCode, _ := strconv.Atoi(config.Get.UnknownHosts)
+		handler = handle.WithVirtualHosts(handler, hosts, unknownCode)
+		settings.SetVirtualHosts(hosts)
+	}
+
+	// If configured, replace the body of error responses with error pages.
+	if 0 != len(config.Get.ErrorPages) {
+		handler = handle.WithErrorPages(handler, errorPages())
+	}
+
+	return
+}
+
+// mountHandler returns the handler of the mount, with settings that aren't set
+// inherited from the top-level configuration.
+func mountHandler(mount config.Mount, settings *handle.Settings) (handle.Mount, error) {
+	fsys, err := folderFileSystem(mount.Folder, "")
+	if nil != err {
+		return handle.Mount{}, err
+	}
+
+	mountSite := topSite().override(
+		mount.ShowListing, mount.AllowIndex, mount.Cors,
+		mount.AccessKey, mount.CacheControl,
+	)
+	mountSite.folder = mount.Folder
+	mountSite.urlPrefix, mountSite.redirects = mount.URLPrefix, mount.Redirects
+
+	handler, err := siteHandler(fsys, mountSite, settings)
+	return handle.Mount{Prefix: mount.URLPrefix, Handler: handler}, err
+}
+
+// virtualHostHandler returns the handler and certificate of the virtual host,
+// with settings that aren't set inherited from the top-level configuration.
+func virtualHostHandler(host config.VirtualHost, settings *handle.Settings) (handle.VirtualHost, error) {
+	virtualHost := handle.VirtualHost{Patterns: host.Hosts}
+
+	fsys, err := folderFileSystem(host.Folder, "")
+	if nil != err {
+		return virtualHost, err
+	}
+
+	hostSite := topSite().override(
+		host.ShowListing, host.AllowIndex, host.Cors,
+		host.AccessKey, host.CacheControl,
+	)
+	hostSite.folder = host.Folder
+	hostSite.urlPrefix, hostSite.redirects = host.URLPrefix, host.Redirects
+
+	if virtualHost.Handler, err = siteHandler(fsys, hostSite, settings); nil != err {
+		return virtualHost, err
+	}
+
+	// Without a certificate of its own, the default certificate is presented.
+	if 0 < len(host.TLSCert) {
+		certificate, err := tls.LoadX509KeyPair(host.TLSCert, host.TLSKey)
+		if nil != err {
+			return virtualHost, err
+		}
+		virtualHost.Certificate = &certificate
+	}
+	return virtualHost, nil
+}
+
+// siteHandler returns the request handler serving the file system for the
+// site with the settings.
+func siteHandler(fsys fs.FS, s site, settings *handle.Settings) (handler http.HandlerFunc, err error) {
 	var serveFileHandler handle.FileServerFunc
 
-	serveFileHandler = http.ServeFile
+	// If configured, preload the content, which mustn't change while it is
+	// served, including gzip compressed variants of files with compressible
+	// content types.
+	var gzipper storage.Gzipper
+	if config.Get.Preload {
+		start := time.Now()
+		preloaded, err := storage.Preload(fsys, config.Get.PreloadMemory, settings.TypeByExtension)
+		if nil != err {
+			return nil, err
+		}
+		stats := preloaded.Stats()
+		log.Printf(
+			"Preloaded %d files (%d bytes, %d gzipped to %d bytes) of %s in %v\n",
+			stats.Files, stats.Bytes, stats.Gzipped, stats.GzippedBytes, s.folder,
+			time.Since(start).Round(time.Millisecond),
+		)
+		fsys, gzipper = preloaded, preloaded
+	}
+
+	// If configured, hold small, recently requested files in memory.
+	if 0 < config.Get.MemCacheBytes {
+		fsys = storage.Cache(fsys, storage.CacheLimits{
+			MaxBytes:     int64(config.Get.MemCacheBytes),
+			MaxFileBytes: int64(config.Get.MemCacheFile),
+			Interval:     config.Get.MemIntvl,
+		})
+	}
+
+	// If configured, apply the custom headers of '_headers' files, which are
+	// never served themselves.
+	var headers *handle.Headers
+	if config.Get.HeadersFiles {
+		headers = handle.NewHeaders(fsys)
+		fsys = storage.Hide(fsys, handle.HeadersFilename)
+	}
+
+	serveFileHandler = handle.ServeFS(fsys)
+
+	// Serve the gzip compressed variants of preloaded files, if accepted.
+	if nil != gzipper {
+		serveFileHandler = handle.WithPrecompressed(serveFileHandler, fsys, gzipper)
+	}
+
+	// If listings are shown, render them with the built-in or configured
+	// template.
+	listingTmpl := handle.DefaultListingTemplate
+	if s.showListing && 0 < len(config.Get.ListingTmpl) {
+		if listingTmpl, err = handle.ParseListingTemplate(config.Get.ListingTmpl); nil != err {
+			return
+		}
+	}
+
+	// If configured, serve the contents of archives as directories, which are
+	// listed like all other directories.
+	if config.Get.ServeArchives {
+		serveArchive := handle.ServeFS
+		if s.showListing {
+			serveArchive = func(archive fs.FS) handle.FileServerFunc {
+				return handle.WithListing(
+					handle.ServeFS(archive), archive, listingTmpl, s.urlPrefix,
+				)
+			}
+		}
+		serveFileHandler = handle.WithArchives(
+			serveFileHandler, fsys, storage.NewArchives(fsys), serveArchive,
+		)
+	}
+
+	if s.showListing {
+		serveFileHandler = handle.WithListing(
+			serveFileHandler, fsys, listingTmpl, s.urlPrefix,
+		)
+
+		// If configured, allow directories to be downloaded as archives.
+		if config.Get.Archives {
+			serveFileHandler = handle.WithDirectoryArchives(
+				serveFileHandler,
+				fsys,
+				handle.ArchiveLimits{
+					MaxBytes: config.Get.ArchiveBytes,
+					MaxFiles: config.Get.ArchiveFiles,
+				},
+			)
+		}
+	}
+
+	// If configured, set the digest headers of files and serve checksum
+	// sidecars of files without one.
+	if config.Get.Digests {
+		serveFileHandler = handle.WithDigests(
+			serveFileHandler, handle.NewDigests(fsys),
+		)
+	}
+
+	// If configured, resize images to the allowed sizes, caching the resized
+	// images in the configured directory.
+	if 0 != len(config.Get.ImageSizes) {
+		var images *handle.Images
+		if images, err = imageResizer(s.folder); nil != err {
+			return
+		}
+		serveFileHandler = handle.WithImages(serveFileHandler, fsys, images)
+	}
+
+	// If configured, render Markdown files as HTML for browsers with the
+	// built-in or configured template.
+	if config.Get.Markdown {
+		tmpl := handle.DefaultMarkdownTemplate
+		if 0 < len(config.Get.MarkdownTmpl) {
+			if tmpl, err = handle.ParseMarkdownTemplate(config.Get.MarkdownTmpl); nil != err {
+				return
+			}
+		}
+		serveFileHandler = handle.WithMarkdown(
+			serveFileHandler, fsys, tmpl, config.Get.MarkdownCSS,
+		)
+	}
+
+	// Serve files as attachments when requested or when they match the
+	// configured patterns.
+	serveFileHandler = handle.WithDownloads(serveFileHandler, config.Get.Downloads)
+
+	if nil != headers {
+		serveFileHandler = handle.WithHeaders(serveFileHandler, headers)
+	}
+
 	if config.Get.Debug {
 		serveFileHandler = handle.WithLogging(serveFileHandler)
 	}
@@ -47,40 +365,158 @@ func handlerSelector() (handler http.HandlerFunc) {
 	}
 
 	// Choose and set the appropriate, optimized static file serving function.
-	if 0 == len(config.Get.URLPrefix) {
-		handler = handle.Basic(serveFileHandler, config.Get.Folder)
+	if 0 == len(s.urlPrefix) {
+		handler = handle.Basic(serveFileHandler)
 	} else {
-		handler = handle.Prefix(
-			serveFileHandler,
-			config.Get.Folder,
-			config.Get.URLPrefix,
-		)
+		handler = handle.Prefix(serveFileHandler, s.urlPrefix)
 	}
 
 	// Determine whether index files should hidden.
-	if !config.Get.ShowListing {
-		if config.Get.AllowIndex {
-			handler = handle.PreventListings(handler, config.Get.Folder, config.Get.URLPrefix)
+	if !s.showListing {
+		if s.allowIndex {
+			handler = handle.PreventListings(handler, fsys, s.urlPrefix)
 		} else {
 			handler = handle.IgnoreIndex(handler)
 		}
 	}
+
+	// If configured, resolve clean URLs and normalize trailing slashes before
+	// listings are prevented or ignored.
+	if config.Get.CleanURLs || "" != config.Get.TrailingSlash {
+		handler = handle.WithCleanURLs(
+			handler, fsys, s.urlPrefix, config.Get.CleanURLs, trailingSlash(),
+		)
+	}
+
+	// If configured, redirect or rewrite requests matching the rules, which
+	// are reloaded when the file changes.
+	if "" != s.redirects {
+		var rules *handle.RulesFile
+		if rules, err = handle.LoadRules(s.redirects); nil != err {
+			return
+		}
+		handler = handle.WithRules(handler, fsys, s.urlPrefix, rules.Rules)
+	}
+
 	// If configured, apply wildcard CORS support.
-	if config.Get.Cors {
+	if s.cors {
 		handler = handle.AddCorsWildcardHeaders(handler)
 	}
 
+	// If configured, set the caching policy of successful responses.
+	if "" != s.cacheControl {
+		handler = handle.WithCacheControl(handler, s.cacheControl)
+	}
+
 	// If configured, apply key code access control.
-	if "" != config.Get.AccessKey {
-		handler = handle.AddAccessKey(handler, config.Get.AccessKey)
+	if "" != s.accessKey {
+		handler = handle.AddAccessKey(handler, s.accessKey)
 	}
 
 	return
 }
 
+// trailingSlash returns how trailing slashes are normalized.
+func trailingSlash() handle.TrailingSlash {
+	switch config.Get.TrailingSlash {
+	case "add":
+		return handle.AddTrailingSlash
+	case "remove":
+		return handle.RemoveTrailingSlash
+	}
+	return handle.KeepTrailingSlash
+}
+
+// fileSystemSelector returns the file system of the configured storage
+// backend.
+func fileSystemSelector() (fs.FS, error) {
+	if config.Get.Backend == "s3" {
+		return storage.NewS3(storage.S3Config{
+			Endpoint:  config.Get.S3Endpoint,
+			Region:    config.Get.S3Region,
+			Bucket:    config.Get.S3Bucket,
+			Prefix:    config.Get.S3Prefix,
+			AccessKey: config.Get.S3AccessKey,
+			SecretKey: config.Get.S3SecretKey,
+			PathStyle: config.Get.S3PathStyle,
+			Timeout:   config.Get.S3Timeout,
+		})
+	}
+
+	return folderFileSystem(config.Get.Folder, config.Get.Backend)
+}
+
+// folderFileSystem returns the file system of the comma-separated list of
+// folders, with each folder as a layer of an overlay searched in order. If the
+// backend is 'archive', or not set and the folder is a regular file with the
+// extension of an archive, the folder is served from the archive. Otherwise,
+// the folder (including a directory named like an archive) is served from the
+// local file system.
+func folderFileSystem(folder, backend string) (fs.FS, error) {
+	folders := config.SplitFolders(folder)
+	layers := make([]fs.FS, len(folders))
+	for index, folder := range folders {
+		isArchive := backend == "archive"
+		if backend == "" && storage.IsArchive(folder) {
+			stat, err := os.Stat(folder)
+			if nil != err {
+				return nil, err
+			}
+			isArchive = stat.Mode().IsRegular()
+		}
+		if !isArchive {
+			layers[index] = localFileSystem(folder)
+			continue
+		}
+		layer, err := storage.LocalArchive(folder)
+		if nil != err {
+			return nil, err
+		}
+		layers[index] = layer
+	}
+	if len(layers) == 1 {
+		return layers[0], nil
+	}
+	return storage.Overlay(layers...), nil
+}
+
+// localFileSystem returns the file system of the folder on the local file
+// system. If configured, the metadata of files is cached, invalidated as the
+// folder changes or, if the folder can't be watched, after the interval.
+func localFileSystem(folder string) fs.FS {
+	if !config.Get.MetaCache {
+		return storage.Local(folder)
+	}
+	metadata := storage.Metadata(storage.Local(folder), config.Get.MetaIntvl)
+	if err := metadata.Watch(folder); nil != err {
+		log.Printf(
+			"Caching metadata of %s for %v as it can't be watched: %v\n",
+			folder, config.Get.MetaIntvl, err,
+		)
+	}
+	metadataCaches = append(metadataCaches, metadata)
+	return metadata
+}
+
+// errorPages returns the configured error pages for use by the handler.
+func errorPages() []handle.ErrorPage {
+	pages := make([]handle.ErrorPage, len(config.Get.ErrorPages))
+	for index, page := range config.Get.ErrorPages {
+		pages[index] = handle.ErrorPage{
+			Code:     page.Code,
+			Prefix:   page.Prefix,
+			Filename: page.Locate(config.Folders()),
+		}
+	}
+	return pages
+}
+
 // listenerSelector returns the appropriate listener handler based on
 // configuration.
 func listenerSelector() (listener handle.ListenerFunc) {
+	// Wait for active requests when shutting down.
+	handle.SetShutdownTimeout(config.Get.Shutdown)
+
 	// Serve files over HTTP or HTTPS based on paths to TLS files being
 	// provided.
 	if 0 < len(config.Get.TLSCert) {
@@ -94,3 +530,26 @@ func listenerSelector() (listener handle.ListenerFunc) {
 	}
 	return
 }
+
+// imageResizer returns the resizer of images to the configured sizes. Images of
+// the folder are cached in a directory of their own within the configured cache
+// directory, which is created if it doesn't exist.
+func imageResizer(folder string) (*handle.Images, error) {
+	sizes := make([]handle.ImageSize, len(config.Get.ImageSizes))
+	for index, size := range config.Get.ImageSizes {
+		width, height, err := config.ParseImageSize(size)
+		if nil != err {
+			return nil, err
+		}
+		sizes[index] = handle.ImageSize{Width: width, Height: height}
+	}
+	var cacheDir string
+	if 0 < len(config.Get.ImageCache) {
+		sum := sha256.Sum256([]byte(folder))
+		cacheDir = filepath.Join(config.Get.ImageCache, hex.EncodeToString(sum[:8]))
+		if err := os.MkdirAll(cacheDir, 0755); nil != err {
+			return nil, err
+		}
+	}
+	return handle.NewImages(sizes, cacheDir, int64(config.Get.ImageCacheMax)), nil
+}
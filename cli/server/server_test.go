@@ -1,12 +1,31 @@
 package server
 
 import (
+	"archive/zip"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
 	"errors"
+	"image"
+	"image/png"
+	"io/fs"
+	"io/ioutil"
+	"math/big"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/halverneus/static-file-server/config"
 	"github.com/halverneus/static-file-server/handle"
+	"github.com/halverneus/static-file-server/storage"
 )
 
 func TestRun(t *testing.T) {
@@ -26,6 +45,26 @@ func TestRun(t *testing.T) {
 	if err := Run(); listenerError != err {
 		t.Errorf("With debug expected %v but got %v", listenerError, err)
 	}
+
+	handlerError := errors.New("handler")
+	selectHandler = func() (*handle.Settings, http.HandlerFunc, error) {
+		return nil, nil, handlerError
+	}
+	defer func() { selectHandler = handlerSelector }()
+	if err := Run(); handlerError != err {
+		t.Errorf("With handler error expected %v but got %v", handlerError, err)
+	}
+}
+
+// activateHandler activates the handler of the configuration with its settings
+// and returns the function serving requests with the active handler.
+func activateHandler() (http.HandlerFunc, error) {
+	settings, handler, err := handlerSelector()
+	if nil != err {
+		return nil, err
+	}
+	handle.Activate(settings, handler)
+	return handle.ServeActive, nil
 }
 
 func TestHandlerSelector(t *testing.T) {
@@ -35,6 +74,8 @@ func TestHandlerSelector(t *testing.T) {
 	var ignoreReferrer []string
 	testReferrer := []string{"http://localhost"}
 	testAccessKey := "access-key"
+	var ignoreErrorPages []config.ErrorPage
+	testErrorPages := []config.ErrorPage{{Code: 404, File: "404.html"}}
 
 	testCases := []struct {
 		name      string
@@ -45,47 +86,50 @@ func TestHandlerSelector(t *testing.T) {
 		refer     []string
 		cors      bool
 		accessKey string
+		errPages  []config.ErrorPage
 	}{
-		{"Basic handler w/o debug", testFolder, "", true, false, ignoreReferrer, false, ""},
-		{"Prefix handler w/o debug", testFolder, testPrefix, true, false, ignoreReferrer, false, ""},
-		{"Basic and hide listing handler w/o debug", testFolder, "", false, false, ignoreReferrer, false, ""},
-		{"Prefix and hide listing handler w/o debug", testFolder, testPrefix, false, false, ignoreReferrer, false, ""},
-		{"Basic handler w/debug", testFolder, "", true, true, ignoreReferrer, false, ""},
-		{"Prefix handler w/debug", testFolder, testPrefix, true, true, ignoreReferrer, false, ""},
-		{"Basic and hide listing handler w/debug", testFolder, "", false, true, ignoreReferrer, false, ""},
-		{"Prefix and hide listing handler w/debug", testFolder, testPrefix, false, true, ignoreReferrer, false, ""},
-		{"Basic handler w/o debug w/refer", testFolder, "", true, false, testReferrer, false, ""},
-		{"Prefix handler w/o debug w/refer", testFolder, testPrefix, true, false, testReferrer, false, ""},
-		{"Basic and hide listing handler w/o debug w/refer", testFolder, "", false, false, testReferrer, false, ""},
-		{"Prefix and hide listing handler w/o debug w/refer", testFolder, testPrefix, false, false, testReferrer, false, ""},
-		{"Basic handler w/debug w/refer w/o cors", testFolder, "", true, true, testReferrer, false, ""},
-		{"Prefix handler w/debug w/refer w/o cors", testFolder, testPrefix, true, true, testReferrer, false, ""},
-		{"Basic and hide listing handler w/debug w/refer w/o cors", testFolder, "", false, true, testReferrer, false, ""},
-		{"Prefix and hide listing handler w/debug w/refer w/o cors", testFolder, testPrefix, false, true, testReferrer, false, ""},
-		{"Basic handler w/debug w/refer w/cors", testFolder, "", true, true, testReferrer, true, ""},
-		{"Prefix handler w/debug w/refer w/cors", testFolder, testPrefix, true, true, testReferrer, true, ""},
-		{"Basic and hide listing handler w/debug w/refer w/cors", testFolder, "", false, true, testReferrer, true, ""},
-		{"Prefix and hide listing handler w/debug w/refer w/cors", testFolder, testPrefix, false, true, testReferrer, true, ""},
-		{"Access Key and Basic handler w/o debug", testFolder, "", true, false, ignoreReferrer, false, testAccessKey},
-		{"Access Key and Prefix handler w/o debug", testFolder, testPrefix, true, false, ignoreReferrer, false, testAccessKey},
-		{"Access Key and Basic and hide listing handler w/o debug", testFolder, "", false, false, ignoreReferrer, false, testAccessKey},
-		{"Access Key and Prefix and hide listing handler w/o debug", testFolder, testPrefix, false, false, ignoreReferrer, false, testAccessKey},
-		{"Access Key and Basic handler w/debug", testFolder, "", true, true, ignoreReferrer, false, testAccessKey},
-		{"Access Key and Prefix handler w/debug", testFolder, testPrefix, true, true, ignoreReferrer, false, testAccessKey},
-		{"Access Key and Basic and hide listing handler w/debug", testFolder, "", false, true, ignoreReferrer, false, testAccessKey},
-		{"Access Key and Prefix and hide listing handler w/debug", testFolder, testPrefix, false, true, ignoreReferrer, false, testAccessKey},
-		{"Access Key and Basic handler w/o debug w/refer", testFolder, "", true, false, testReferrer, false, testAccessKey},
-		{"Access Key and Prefix handler w/o debug w/refer", testFolder, testPrefix, true, false, testReferrer, false, testAccessKey},
-		{"Access Key and Basic and hide listing handler w/o debug w/refer", testFolder, "", false, false, testReferrer, false, testAccessKey},
-		{"Access Key and Prefix and hide listing handler w/o debug w/refer", testFolder, testPrefix, false, false, testReferrer, false, testAccessKey},
-		{"Access Key and Basic handler w/debug w/refer w/o cors", testFolder, "", true, true, testReferrer, false, testAccessKey},
-		{"Access Key and Prefix handler w/debug w/refer w/o cors", testFolder, testPrefix, true, true, testReferrer, false, testAccessKey},
-		{"Access Key and Basic and hide listing handler w/debug w/refer w/o cors", testFolder, "", false, true, testReferrer, false, testAccessKey},
-		{"Access Key and Prefix and hide listing handler w/debug w/refer w/o cors", testFolder, testPrefix, false, true, testReferrer, false, testAccessKey},
-		{"Access Key and Basic handler w/debug w/refer w/cors", testFolder, "", true, true, testReferrer, true, testAccessKey},
-		{"Access Key and Prefix handler w/debug w/refer w/cors", testFolder, testPrefix, true, true, testReferrer, true, testAccessKey},
-		{"Access Key and Basic and hide listing handler w/debug w/refer w/cors", testFolder, "", false, true, testReferrer, true, testAccessKey},
-		{"Access Key and Prefix and hide listing handler w/debug w/refer w/cors", testFolder, testPrefix, false, true, testReferrer, true, testAccessKey},
+		{"Basic handler w/o debug", testFolder, "", true, false, ignoreReferrer, false, "", ignoreErrorPages},
+		{"Prefix handler w/o debug", testFolder, testPrefix, true, false, ignoreReferrer, false, "", ignoreErrorPages},
+		{"Basic and hide listing handler w/o debug", testFolder, "", false, false, ignoreReferrer, false, "", ignoreErrorPages},
+		{"Prefix and hide listing handler w/o debug", testFolder, testPrefix, false, false, ignoreReferrer, false, "", ignoreErrorPages},
+		{"Basic handler w/debug", testFolder, "", true, true, ignoreReferrer, false, "", ignoreErrorPages},
+		{"Prefix handler w/debug", testFolder, testPrefix, true, true, ignoreReferrer, false, "", ignoreErrorPages},
+		{"Basic and hide listing handler w/debug", testFolder, "", false, true, ignoreReferrer, false, "", ignoreErrorPages},
+		{"Prefix and hide listing handler w/debug", testFolder, testPrefix, false, true, ignoreReferrer, false, "", ignoreErrorPages},
+		{"Basic handler w/o debug w/refer", testFolder, "", true, false, testReferrer, false, "", ignoreErrorPages},
+		{"Prefix handler w/o debug w/refer", testFolder, testPrefix, true, false, testReferrer, false, "", ignoreErrorPages},
+		{"Basic and hide listing handler w/o debug w/refer", testFolder, "", false, false, testReferrer, false, "", ignoreErrorPages},
+		{"Prefix and hide listing handler w/o debug w/refer", testFolder, testPrefix, false, false, testReferrer, false, "", ignoreErrorPages},
+		{"Basic handler w/debug w/refer w/o cors", testFolder, "", true, true, testReferrer, false, "", ignoreErrorPages},
+		{"Prefix handler w/debug w/refer w/o cors", testFolder, testPrefix, true, true, testReferrer, false, "", ignoreErrorPages},
+		{"Basic and hide listing handler w/debug w/refer w/o cors", testFolder, "", false, true, testReferrer, false, "", ignoreErrorPages},
+		{"Prefix and hide listing handler w/debug w/refer w/o cors", testFolder, testPrefix, false, true, testReferrer, false, "", ignoreErrorPages},
+		{"Basic handler w/debug w/refer w/cors", testFolder, "", true, true, testReferrer, true, "", ignoreErrorPages},
+		{"Prefix handler w/debug w/refer w/cors", testFolder, testPrefix, true, true, testReferrer, true, "", ignoreErrorPages},
+		{"Basic and hide listing handler w/debug w/refer w/cors", testFolder, "", false, true, testReferrer, true, "", ignoreErrorPages},
+		{"Prefix and hide listing handler w/debug w/refer w/cors", testFolder, testPrefix, false, true, testReferrer, true, "", ignoreErrorPages},
+		{"Access Key and Basic handler w/o debug", testFolder, "", true, false, ignoreReferrer, false, testAccessKey, ignoreErrorPages},
+		{"Access Key and Prefix handler w/o debug", testFolder, testPrefix, true, false, ignoreReferrer, false, testAccessKey, ignoreErrorPages},
+		{"Access Key and Basic and hide listing handler w/o debug", testFolder, "", false, false, ignoreReferrer, false, testAccessKey, ignoreErrorPages},
+		{"Access Key and Prefix and hide listing handler w/o debug", testFolder, testPrefix, false, false, ignoreReferrer, false, testAccessKey, ignoreErrorPages},
+		{"Access Key and Basic handler w/debug", testFolder, "", true, true, ignoreReferrer, false, testAccessKey, ignoreErrorPages},
+		{"Access Key and Prefix handler w/debug", testFolder, testPrefix, true, true, ignoreReferrer, false, testAccessKey, ignoreErrorPages},
+		{"Access Key and Basic and hide listing handler w/debug", testFolder, "", false, true, ignoreReferrer, false, testAccessKey, ignoreErrorPages},
+		{"Access Key and Prefix and hide listing handler w/debug", testFolder, testPrefix, false, true, ignoreReferrer, false, testAccessKey, ignoreErrorPages},
+		{"Access Key and Basic handler w/o debug w/refer", testFolder, "", true, false, testReferrer, false, testAccessKey, ignoreErrorPages},
+		{"Access Key and Prefix handler w/o debug w/refer", testFolder, testPrefix, true, false, testReferrer, false, testAccessKey, ignoreErrorPages},
+		{"Access Key and Basic and hide listing handler w/o debug w/refer", testFolder, "", false, false, testReferrer, false, testAccessKey, ignoreErrorPages},
+		{"Access Key and Prefix and hide listing handler w/o debug w/refer", testFolder, testPrefix, false, false, testReferrer, false, testAccessKey, ignoreErrorPages},
+		{"Access Key and Basic handler w/debug w/refer w/o cors", testFolder, "", true, true, testReferrer, false, testAccessKey, ignoreErrorPages},
+		{"Access Key and Prefix handler w/debug w/refer w/o cors", testFolder, testPrefix, true, true, testReferrer, false, testAccessKey, ignoreErrorPages},
+		{"Access Key and Basic and hide listing handler w/debug w/refer w/o cors", testFolder, "", false, true, testReferrer, false, testAccessKey, ignoreErrorPages},
+		{"Access Key and Prefix and hide listing handler w/debug w/refer w/o cors", testFolder, testPrefix, false, true, testReferrer, false, testAccessKey, ignoreErrorPages},
+		{"Access Key and Basic handler w/debug w/refer w/cors", testFolder, "", true, true, testReferrer, true, testAccessKey, ignoreErrorPages},
+		{"Access Key and Prefix handler w/debug w/refer w/cors", testFolder, testPrefix, true, true, testReferrer, true, testAccessKey, ignoreErrorPages},
+		{"Access Key and Basic and hide listing handler w/debug w/refer w/cors", testFolder, "", false, true, testReferrer, true, testAccessKey, ignoreErrorPages},
+		{"Access Key and Prefix and hide listing handler w/debug w/refer w/cors", testFolder, testPrefix, false, true, testReferrer, true, testAccessKey, ignoreErrorPages},
+		{"Error pages and Basic handler", testFolder, "", true, false, ignoreReferrer, false, "", testErrorPages},
+		{"Error pages and Prefix handler w/debug w/refer w/cors", testFolder, testPrefix, true, true, testReferrer, true, testAccessKey, testErrorPages},
 	}
 
 	for _, tc := range testCases {
@@ -97,12 +141,1200 @@ func TestHandlerSelector(t *testing.T) {
 			config.Get.Referrers = tc.refer
 			config.Get.Cors = tc.cors
 			config.Get.AccessKey = tc.accessKey
+			config.Get.ErrorPages = tc.errPages
+
+			if _, _, err := handlerSelector(); nil != err {
+				t.Errorf("Expected no error but got %v", err)
+			}
+		})
+	}
+}
+
+func TestHandlerSelectorListingTemplate(t *testing.T) {
+	goodTmpl := filepath.Join(t.TempDir(), "listing.tmpl")
+	badTmpl := filepath.Join(t.TempDir(), "bad.tmpl")
+	if err := ioutil.WriteFile(goodTmpl, []byte(`{{.Path}}`), 0600); nil != err {
+		t.Fatalf("While writing template got %v", err)
+	}
+	if err := ioutil.WriteFile(badTmpl, []byte(`{{.Path`), 0600); nil != err {
+		t.Fatalf("While writing template got %v", err)
+	}
+
+	testCases := []struct {
+		name    string
+		listing bool
+		tmpl    string
+		isError bool
+	}{
+		{"Default template", true, "", false},
+		{"Custom template", true, goodTmpl, false},
+		{"Bad template", true, badTmpl, true},
+		{"Missing template", true, "should/never/exist.tmpl", true},
+		{"Missing template w/o listing", false, "should/never/exist.tmpl", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config.Get.ShowListing = tc.listing
+			config.Get.ListingTmpl = tc.tmpl
+
+			_, _, err := handlerSelector()
+			hasError := nil != err
+			if hasError && !tc.isError {
+				t.Errorf("Expected no error but got %v", err)
+			}
+			if !hasError && tc.isError {
+				t.Error("Expected an error but got no error")
+			}
+		})
+	}
+	config.Get.ListingTmpl = ""
+}
+
+func TestHandlerSelectorArchives(t *testing.T) {
+	// This test only exercises function branches.
+	testCases := []struct {
+		name     string
+		listing  bool
+		archives bool
+	}{
+		{"Archives w/listing", true, true},
+		{"Archives w/o listing", false, true},
+		{"No archives w/listing", true, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config.Get.ShowListing = tc.listing
+			config.Get.Archives = tc.archives
+			config.Get.ArchiveBytes = 1024
+			config.Get.ArchiveFiles = 10
+			if _, _, err := handlerSelector(); nil != err {
+				t.Errorf("Expected no error but got %v", err)
+			}
+		})
+	}
+	config.Get.Archives = false
+}
+
+func TestHandlerSelectorServeArchives(t *testing.T) {
+	root := t.TempDir()
+	file, err := os.Create(filepath.Join(root, "docs.zip"))
+	if nil != err {
+		t.Fatalf("While creating archive got %v", err)
+	}
+	writer := zip.NewWriter(file)
+	for name, contents := range map[string]string{
+		"a.txt":           "a",
+		"b.txt":           "b",
+		"site/index.html": "site",
+	} {
+		if entry, err := writer.Create(name); nil != err {
+			t.Fatalf("While creating archive entry got %v", err)
+		} else {
+			entry.Write([]byte(contents))
+		}
+	}
+	writer.Close()
+	file.Close()
+
+	config.Get.Debug = false
+	config.Get.Folder = root
+	config.Get.URLPrefix = ""
+	config.Get.Referrers = nil
+	config.Get.Cors = false
+	config.Get.AccessKey = ""
+	config.Get.ErrorPages = nil
+	config.Get.ServeArchives = true
+	defer func() {
+		config.Get.Folder = "/web"
+		config.Get.ShowListing = true
+		config.Get.AllowIndex = true
+		config.Get.ServeArchives = false
+	}()
+
+	testCases := []struct {
+		name     string
+		listing  bool
+		index    bool
+		path     string
+		code     int
+		contents string
+	}{
+		{"Listing", true, true, "/docs.zip/", http.StatusOK, `<a href="?order=asc&amp;sort=size">`},
+		{"JSON listing", true, true, "/docs.zip/?format=json&sort=name&order=desc&limit=1", http.StatusOK, `"total":3`},
+		{"JSON listing sorted", true, true, "/docs.zip/?format=json&sort=name&order=desc&limit=1", http.StatusOK, `"name":"site"`},
+		{"CSV listing", true, true, "/docs.zip/?format=csv", http.StatusOK, "a.txt,file,1,"},
+		{"Index", true, true, "/docs.zip/site/", http.StatusOK, "site"},
+		{"File", false, true, "/docs.zip/a.txt", http.StatusOK, "a"},
+		{"No listing", false, true, "/docs.zip/", http.StatusNotFound, "404 page not found\n"},
+		{"No index", false, false, "/docs.zip/site/", http.StatusNotFound, "404 page not found\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config.Get.ShowListing = tc.listing
+			config.Get.AllowIndex = tc.index
+			handler, err := activateHandler()
+			if nil != err {
+				t.Fatalf("Expected no error but got %v", err)
+			}
+
+			fullpath := "http://localhost" + tc.path
+			req := httptest.NewRequest("GET", fullpath, nil)
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			resp := w.Result()
+			body, _ := ioutil.ReadAll(resp.Body)
+			if tc.code != resp.StatusCode {
+				t.Errorf(
+					"While retrieving %s expected status code of %d but got %d",
+					fullpath, tc.code, resp.StatusCode,
+				)
+			}
+			if !strings.Contains(string(body), tc.contents) {
+				t.Errorf(
+					"While retrieving %s expected contents with '%s' but got '%s'",
+					fullpath, tc.contents, body,
+				)
+			}
+		})
+	}
+}
+
+func TestFileSystemSelector(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "docs.zip")
+	file, err := os.Create(archive)
+	if nil != err {
+		t.Fatalf("While creating archive got %v", err)
+	}
+	writer := zip.NewWriter(file)
+	if entry, err := writer.Create("index.html"); nil != err {
+		t.Fatalf("While creating archive entry got %v", err)
+	} else {
+		entry.Write([]byte("archived"))
+	}
+	writer.Close()
+	file.Close()
+	folderArchive := filepath.Join(dir, "site.zip")
+	if err := os.Mkdir(folderArchive, 0700); nil != err {
+		t.Fatalf("While creating folder got %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(folderArchive, "index.html"), []byte("site"), 0600); nil != err {
+		t.Fatalf("While writing file got %v", err)
+	}
+
+	testCases := []struct {
+		name    string
+		folder  string
+		backend string
+		index   bool
+		isError bool
+	}{
+		{"Local folder", dir, "", false, false},
+		{"Local backend", dir, "local", false, false},
+		{"Archive as folder", archive, "", true, false},
+		{"Archive backend", archive, "archive", true, false},
+		{"Folder named like an archive", folderArchive, "", true, false},
+		{"Missing archive", filepath.Join(dir, "missing.zip"), "", false, true},
+		{"Not an archive", dir, "archive", false, true},
+		{"Folders", dir + "," + archive, "", true, false},
+		{"Folders w/missing archive", dir + "," + filepath.Join(dir, "missing.zip"), "", false, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config.Get.Folder = tc.folder
+			config.Get.Backend = tc.backend
+			fsys, err := fileSystemSelector()
+			hasError := nil != err
+			if hasError && !tc.isError {
+				t.Fatalf("Expected no error but got %v", err)
+			}
+			if !hasError && tc.isError {
+				t.Fatal("Expected an error but got no error")
+			}
+			if hasError {
+				return
+			}
+			_, err = fs.Stat(fsys, "index.html")
+			if hasIndex := nil == err; tc.index != hasIndex {
+				t.Errorf("Expected index of %t but got %t", tc.index, hasIndex)
+			}
+		})
+	}
+	config.Get.Folder = "/web"
+	config.Get.Backend = ""
+
+	selectFileSystem = func() (fs.FS, error) {
+		return nil, errors.New("backend")
+	}
+	defer func() { selectFileSystem = fileSystemSelector }()
+	if _, _, err := handlerSelector(); nil == err {
+		t.Error("With backend error expected an error but got nil")
+	}
+}
+
+func TestFileSystemSelectorS3(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if "/bucket/site/index.html" != r.URL.Path {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeContent(w, r, "index.html", time.Time{}, strings.NewReader("stored"))
+	}))
+	defer server.Close()
+
+	testCases := []struct {
+		name     string
+		endpoint string
+		bucket   string
+		isError  bool
+	}{
+		{"S3 backend", server.URL, "bucket", false},
+		{"S3 backend w/o bucket", server.URL, "", true},
+		{"S3 backend w/bad endpoint", "localhost", "bucket", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config.Get.Backend = "s3"
+			config.Get.S3Endpoint = tc.endpoint
+			config.Get.S3Bucket = tc.bucket
+			config.Get.S3Prefix = "site"
+			config.Get.S3PathStyle = true
+			fsys, err := fileSystemSelector()
+			hasError := nil != err
+			if hasError && !tc.isError {
+				t.Fatalf("Expected no error but got %v", err)
+			}
+			if !hasError && tc.isError {
+				t.Fatal("Expected an error but got no error")
+			}
+			if hasError {
+				return
+			}
+			if contents, err := fs.ReadFile(fsys, "index.html"); nil != err || "stored" != string(contents) {
+				t.Errorf("Expected 'stored' but got '%s' (%v)", contents, err)
+			}
+		})
+	}
+	config.Get.Backend = ""
+	config.Get.S3Endpoint = ""
+	config.Get.S3Bucket = ""
+	config.Get.S3Prefix = ""
+	config.Get.S3PathStyle = false
+}
+
+func TestHandlerSelectorMounts(t *testing.T) {
+	root, docs, assets := t.TempDir(), t.TempDir(), t.TempDir()
+	files := map[string]string{
+		filepath.Join(root, "index.html"):        "root",
+		filepath.Join(docs, "guide.txt"):         "guide",
+		filepath.Join(docs, "api", "index.html"): "api",
+		filepath.Join(assets, "style.css"):       "style",
+	}
+	for filename, contents := range files {
+		os.MkdirAll(filepath.Dir(filename), 0700)
+		if err := ioutil.WriteFile(filename, []byte(contents), 0600); nil != err {
+			t.Fatalf("While writing file got %v", err)
+		}
+	}
+	hide := false
+
+	config.Get.Debug = false
+	config.Get.Folder = root
+	config.Get.ShowListing = true
+	config.Get.URLPrefix = ""
+	config.Get.Referrers = nil
+	config.Get.Cors = false
+	config.Get.AccessKey = ""
+	config.Get.ErrorPages = nil
+	config.Get.CacheControl = "no-cache"
+	config.Get.Mounts = []config.Mount{
+		{URLPrefix: "/docs", Folder: docs, ShowListing: &hide, CacheControl: "max-age=60"},
+		{URLPrefix: "/docs/assets", Folder: assets, AccessKey: "key"},
+	}
+	defer func() {
+		config.Get.Folder = "/web"
+		config.Get.CacheControl = ""
+		config.Get.Mounts = nil
+	}()
+
+	handler, err := activateHandler()
+	if nil != err {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	testCases := []struct {
+		name         string
+		path         string
+		code         int
+		contents     string
+		cacheControl string
+	}{
+		{"Root", "/", http.StatusOK, "root", "no-cache"},
+		{"Mounted file", "/docs/guide.txt", http.StatusOK, "guide", "max-age=60"},
+		{"Mounted index", "/docs/api/", http.StatusOK, "api", "max-age=60"},
+		{"Mounted listing hidden", "/docs/", http.StatusNotFound, "404 page not found\n", ""},
+		{"Mount redirect", "/docs", http.StatusMovedPermanently, "", ""},
+		{"Longest mount w/o key", "/docs/assets/style.css", http.StatusNotFound, "404 page not found\n", ""},
+		{"Longest mount w/key", "/docs/assets/style.css?key=key", http.StatusOK, "style", "no-cache"},
+		{"Not in root", "/guide.txt", http.StatusNotFound, "404 page not found\n", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fullpath := "http://localhost" + tc.path
+			req := httptest.NewRequest("GET", fullpath, nil)
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			resp := w.Result()
+			body, _ := ioutil.ReadAll(resp.Body)
+			if tc.code != resp.StatusCode {
+				t.Errorf(
+					"While retrieving %s expected status code of %d but got %d",
+					fullpath, tc.code, resp.StatusCode,
+				)
+			}
+			if tc.code != http.StatusMovedPermanently && tc.contents != string(body) {
+				t.Errorf(
+					"While retrieving %s expected contents '%s' but got '%s'",
+					fullpath, tc.contents, body,
+				)
+			}
+			if cacheControl := resp.Header.Get("Cache-Control"); tc.cacheControl != cacheControl {
+				t.Errorf(
+					"While retrieving %s expected Cache-Control '%s' but got '%s'",
+					fullpath, tc.cacheControl, cacheControl,
+				)
+			}
+		})
+	}
+
+	config.Get.Mounts = []config.Mount{{URLPrefix: "/docs", Folder: filepath.Join(docs, "missing.zip")}}
+	if _, _, err := handlerSelector(); nil == err {
+		t.Error("With missing mount archive expected an error but got nil")
+	}
+}
+
+func TestHandlerSelectorVirtualHosts(t *testing.T) {
+	root, docs := t.TempDir(), t.TempDir()
+	files := map[string]string{
+		filepath.Join(root, "index.html"): "root",
+		filepath.Join(docs, "index.html"): "docs",
+		filepath.Join(docs, "guide.txt"):  "guide",
+	}
+	for filename, contents := range files {
+		if err := ioutil.WriteFile(filename, []byte(contents), 0600); nil != err {
+			t.Fatalf("While writing file got %v", err)
+		}
+	}
+	cert, key := writeCertificate(t, root)
+
+	config.Get.Debug = false
+	config.Get.Folder = root
+	config.Get.URLPrefix = ""
+	config.Get.Referrers = nil
+	config.Get.AccessKey = ""
+	config.Get.ErrorPages = nil
+	config.Get.VirtualHosts = []config.VirtualHost{
+		{Hosts: []string{"docs.example.com"}, Folder: docs, URLPrefix: "/docs", TLSCert: cert, TLSKey: key},
+	}
+	defer func() {
+		config.Get.Folder = "/web"
+		config.Get.VirtualHosts = nil
+		config.Get.UnknownHosts = ""
+		handle.Activate(handle.NewSettings(), nil)
+	}()
+
+	testCases := []struct {
+		name     string
+		host     string
+		path     string
+		unknown  string
+		code     int
+		contents string
+	}{
+		{"Virtual host", "docs.example.com", "/docs/guide.txt", "", http.StatusOK, "guide"},
+		{"Virtual host w/port", "docs.example.com:8080", "/docs/", "", http.StatusOK, "docs"},
+		{"Virtual host w/o prefix", "docs.example.com", "/guide.txt", "", http.StatusNotFound, "404 page not found\n"},
+		{"Unknown host", "www.example.com", "/", "", http.StatusOK, "root"},
+		{"Unknown host not found", "www.example.com", "/", "404", http.StatusNotFound, "404 page not found\n"},
+		{"Unknown host misdirected", "www.example.com", "/", "421", http.StatusMisdirectedRequest, "Misdirected Request\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config.Get.UnknownHosts = tc.unknown
+			handler, err := activateHandler()
+			if nil != err {
+				t.Fatalf("Expected no error but got %v", err)
+			}
+
+			fullpath := "http://" + tc.host + tc.path
+			req := httptest.NewRequest("GET", fullpath, nil)
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			resp := w.Result()
+			body, _ := ioutil.ReadAll(resp.Body)
+			if tc.code != resp.StatusCode {
+				t.Errorf(
+					"While retrieving %s expected status code of %d but got %d",
+					fullpath, tc.code, resp.StatusCode,
+				)
+			}
+			if tc.contents != string(body) {
+				t.Errorf(
+					"While retrieving %s expected contents '%s' but got '%s'",
+					fullpath, tc.contents, body,
+				)
+			}
+		})
+	}
+
+	config.Get.VirtualHosts[0].TLSKey = filepath.Join(root, "index.html")
+	if _, _, err := handlerSelector(); nil == err {
+		t.Error("With invalid virtual host key expected an error but got nil")
+	}
+}
+
+// writeCertificate writes a self-signed certificate and key to the folder and
+// returns their paths.
+func writeCertificate(t *testing.T, folder string) (cert, key string) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if nil != err {
+		t.Fatalf("While generating key got %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		DNSNames:     []string{"docs.example.com"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+	if nil != err {
+		t.Fatalf("While creating certificate got %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(privateKey)
+	if nil != err {
+		t.Fatalf("While marshalling key got %v", err)
+	}
+
+	cert, key = filepath.Join(folder, "docs.pem"), filepath.Join(folder, "docs.key")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := ioutil.WriteFile(cert, certPEM, 0600); nil != err {
+		t.Fatalf("While writing certificate got %v", err)
+	}
+	if err := ioutil.WriteFile(key, keyPEM, 0600); nil != err {
+		t.Fatalf("While writing key got %v", err)
+	}
+	return
+}
+
+func TestHandlerSelectorRedirects(t *testing.T) {
+	root := t.TempDir()
+	redirects := filepath.Join(root, "_redirects")
+	files := map[string]string{
+		filepath.Join(root, "index.html"): "root",
+		redirects:                         "/old /new.html 302\n/app/* /my/prefix/ 200",
+	}
+	for filename, contents := range files {
+		if err := ioutil.WriteFile(filename, []byte(contents), 0600); nil != err {
+			t.Fatalf("While writing file got %v", err)
+		}
+	}
+
+	config.Get.Debug = false
+	config.Get.Folder = root
+	config.Get.URLPrefix = "/my/prefix"
+	config.Get.Referrers = nil
+	config.Get.AccessKey = ""
+	config.Get.ErrorPages = nil
+	config.Get.Redirects = redirects
+	defer func() {
+		config.Get.Folder = "/web"
+		config.Get.URLPrefix = ""
+		config.Get.Redirects = ""
+	}()
+
+	handler, err := activateHandler()
+	if nil != err {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	testCases := []struct {
+		path     string
+		code     int
+		location string
+		contents string
+	}{
+		{"/old", http.StatusFound, "/new.html", ""},
+		{"/app/page", http.StatusOK, "", "root"},
+		{"/my/prefix/", http.StatusOK, "", "root"},
+	}
+
+	for _, tc := range testCases {
+		fullpath := "http://localhost" + tc.path
+		req := httptest.NewRequest("GET", fullpath, nil)
+		w := httptest.NewRecorder()
+
+		handler(w, req)
+
+		if tc.code != w.Code {
+			t.Errorf("While retrieving %s expected status code of %d but got %d", fullpath, tc.code, w.Code)
+		}
+		if location := w.Header().Get("Location"); tc.location != location {
+			t.Errorf("While retrieving %s expected location '%s' but got '%s'", fullpath, tc.location, location)
+		}
+		if tc.code == http.StatusOK && tc.contents != w.Body.String() {
+			t.Errorf("While retrieving %s expected contents '%s' but got '%s'", fullpath, tc.contents, w.Body.String())
+		}
+	}
+
+	if err := ioutil.WriteFile(redirects, []byte("/old"), 0600); nil != err {
+		t.Fatalf("While writing file got %v", err)
+	}
+	if _, _, err := handlerSelector(); nil == err {
+		t.Error("With invalid rules expected an error but got nil")
+	}
+}
+
+func TestHandlerSelectorHeadersFiles(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		filepath.Join(root, "index.html"): "root",
+		filepath.Join(root, "_headers"):   "/*\n  X-Frame-Options: DENY\n  Cache-Control: no-store",
+	}
+	for filename, contents := range files {
+		if err := ioutil.WriteFile(filename, []byte(contents), 0600); nil != err {
+			t.Fatalf("While writing file got %v", err)
+		}
+	}
+
+	config.Get.Debug = false
+	config.Get.Folder = root
+	config.Get.ShowListing = true
+	config.Get.URLPrefix = ""
+	config.Get.Referrers = nil
+	config.Get.AccessKey = ""
+	config.Get.ErrorPages = nil
+	config.Get.CacheControl = "max-age=60"
+	config.Get.HeadersFiles = true
+	defer func() {
+		config.Get.Folder = "/web"
+		config.Get.CacheControl = ""
+		config.Get.HeadersFiles = false
+	}()
 
-			handlerSelector()
+	handler, err := activateHandler()
+	if nil != err {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	testCases := []struct {
+		path     string
+		code     int
+		frame    string
+		contains string
+		excludes string
+	}{
+		{"/", http.StatusOK, "DENY", "root", ""},
+		{"/_headers", http.StatusNotFound, "DENY", "", "X-Frame-Options"},
+	}
+
+	for _, tc := range testCases {
+		fullpath := "http://localhost" + tc.path
+		req := httptest.NewRequest("GET", fullpath, nil)
+		w := httptest.NewRecorder()
+
+		handler(w, req)
+
+		if tc.code != w.Code {
+			t.Errorf("While retrieving %s expected status code of %d but got %d", fullpath, tc.code, w.Code)
+		}
+		if frame := w.Header().Get("X-Frame-Options"); tc.frame != frame {
+			t.Errorf("While retrieving %s expected X-Frame-Options '%s' but got '%s'", fullpath, tc.frame, frame)
+		}
+		if body := w.Body.String(); !strings.Contains(body, tc.contains) ||
+			("" != tc.excludes && strings.Contains(body, tc.excludes)) {
+			t.Errorf("While retrieving %s got unexpected contents '%s'", fullpath, body)
+		}
+	}
+
+	// The custom Cache-Control takes precedence over the configured value.
+	req := httptest.NewRequest("GET", "http://localhost/", nil)
+	w := httptest.NewRecorder()
+	handler(w, req)
+	if cacheControl := w.Header().Get("Cache-Control"); "no-store" != cacheControl {
+		t.Errorf("Expected Cache-Control 'no-store' but got '%s'", cacheControl)
+	}
+
+	// Listings leave out the headers files.
+	os.Remove(filepath.Join(root, "index.html"))
+	handler, err = activateHandler()
+	if nil != err {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	req = httptest.NewRequest("GET", "http://localhost/", nil)
+	w = httptest.NewRecorder()
+	handler(w, req)
+	if body := w.Body.String(); strings.Contains(body, "_headers") {
+		t.Errorf("Expected listing without '_headers' but got '%s'", body)
+	}
+}
+
+func TestHandlerSelectorCleanURLs(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "docs"), 0700)
+	files := map[string]string{
+		filepath.Join(root, "about.html"):         "about",
+		filepath.Join(root, "docs", "index.html"): "docs",
+	}
+	for filename, contents := range files {
+		if err := ioutil.WriteFile(filename, []byte(contents), 0600); nil != err {
+			t.Fatalf("While writing file got %v", err)
+		}
+	}
+
+	config.Get.Debug = false
+	config.Get.Folder = root
+	config.Get.URLPrefix = "/site"
+	config.Get.Referrers = nil
+	config.Get.AccessKey = ""
+	config.Get.ErrorPages = nil
+	config.Get.CleanURLs = true
+	config.Get.TrailingSlash = "remove"
+	defer func() {
+		config.Get.Folder = "/web"
+		config.Get.URLPrefix = ""
+		config.Get.ShowListing = true
+		config.Get.AllowIndex = true
+		config.Get.CleanURLs = false
+		config.Get.TrailingSlash = ""
+	}()
+
+	testCases := []struct {
+		name       string
+		allowIndex bool
+		path       string
+		code       int
+		location   string
+		contents   string
+	}{
+		{"Clean page", true, "/site/about", http.StatusOK, "", "about"},
+		{"Page redirect", true, "/site/about.html", http.StatusMovedPermanently, "/site/about", ""},
+		{"Slash redirect", true, "/site/docs/", http.StatusMovedPermanently, "/site/docs", ""},
+		{"Dir index", true, "/site/docs", http.StatusOK, "", "docs"},
+		{"Dir index ignored", false, "/site/docs", http.StatusNotFound, "", "404 page not found\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config.Get.ShowListing = false
+			config.Get.AllowIndex = tc.allowIndex
+			handler, err := activateHandler()
+			if nil != err {
+				t.Fatalf("Expected no error but got %v", err)
+			}
+
+			fullpath := "http://localhost" + tc.path
+			req := httptest.NewRequest("GET", fullpath, nil)
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			if tc.code != w.Code {
+				t.Errorf("While retrieving %s expected status code of %d but got %d", fullpath, tc.code, w.Code)
+			}
+			if location := w.Header().Get("Location"); tc.location != location {
+				t.Errorf("While retrieving %s expected location '%s' but got '%s'", fullpath, tc.location, location)
+			}
+			if tc.code != http.StatusMovedPermanently && tc.contents != w.Body.String() {
+				t.Errorf("While retrieving %s expected contents '%s' but got '%s'", fullpath, tc.contents, w.Body.String())
+			}
 		})
 	}
 }
 
+func TestHandlerSelectorContentTypes(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		filepath.Join(root, "app.wasm"): "\x00asm",
+		filepath.Join(root, "data.qq"):  "qq",
+		filepath.Join(root, "notes"):    "notes",
+	}
+	for filename, contents := range files {
+		if err := ioutil.WriteFile(filename, []byte(contents), 0600); nil != err {
+			t.Fatalf("While writing file got %v", err)
+		}
+	}
+
+	config.Get.Debug = false
+	config.Get.Folder = root
+	config.Get.URLPrefix = ""
+	config.Get.Referrers = nil
+	config.Get.AccessKey = ""
+	config.Get.ErrorPages = nil
+	config.Get.MimeTypes = map[string]string{".qq": "application/x-qq"}
+	config.Get.Charsets = map[string]string{".qq": "utf-8"}
+	config.Get.Sniffing = false
+	defer func() {
+		config.Get.Folder = "/web"
+		config.Get.MimeTypes = nil
+		config.Get.Charsets = nil
+		config.Get.Sniffing = true
+		handle.Activate(handle.NewSettings(), nil)
+	}()
+
+	handler, err := activateHandler()
+	if nil != err {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	testCases := map[string]string{
+		"/app.wasm": "application/wasm",
+		"/data.qq":  "application/x-qq; charset=utf-8",
+		"/notes":    "application/octet-stream",
+	}
+	for path, contentType := range testCases {
+		fullpath := "http://localhost" + path
+		req := httptest.NewRequest("GET", fullpath, nil)
+		w := httptest.NewRecorder()
+
+		handler(w, req)
+
+		if result := w.Header().Get("Content-Type"); contentType != result {
+			t.Errorf("While retrieving %s expected content type '%s' but got '%s'", fullpath, contentType, result)
+		}
+	}
+
+	config.Get.Charsets = map[string]string{".unknown": "utf-8"}
+	if _, _, err := handlerSelector(); nil == err {
+		t.Error("With a charset of an unknown extension expected an error but got nil")
+	}
+}
+
+func TestHandlerSelectorDownloads(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "reports"), 0700)
+	files := map[string]string{
+		filepath.Join(root, "notes.txt"):           "notes",
+		filepath.Join(root, "reports", "2024.csv"): "2024",
+	}
+	for filename, contents := range files {
+		if err := ioutil.WriteFile(filename, []byte(contents), 0600); nil != err {
+			t.Fatalf("While writing file got %v", err)
+		}
+	}
+
+	config.Get.Debug = false
+	config.Get.Folder = root
+	config.Get.URLPrefix = "/site"
+	config.Get.Referrers = nil
+	config.Get.AccessKey = ""
+	config.Get.ErrorPages = nil
+	config.Get.Downloads = []string{"/reports/*"}
+	defer func() {
+		config.Get.Folder = "/web"
+		config.Get.URLPrefix = ""
+		config.Get.Downloads = nil
+	}()
+
+	handler, err := activateHandler()
+	if nil != err {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	testCases := map[string]string{
+		"/site/notes.txt":                 "",
+		"/site/notes.txt?download":        `attachment; filename="notes.txt"`,
+		"/site/notes.txt?filename=a.txt":  `attachment; filename="a.txt"`,
+		"/site/reports/2024.csv":          `attachment; filename="2024.csv"`,
+		"/site/reports/2025.csv?download": "",
+	}
+	for path, disposition := range testCases {
+		fullpath := "http://localhost" + path
+		req := httptest.NewRequest("GET", fullpath, nil)
+		w := httptest.NewRecorder()
+
+		handler(w, req)
+
+		if result := w.Header().Get("Content-Disposition"); disposition != result {
+			t.Errorf("While retrieving %s expected disposition '%s' but got '%s'", fullpath, disposition, result)
+		}
+	}
+}
+
+func TestHandlerSelectorDigests(t *testing.T) {
+	root := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(root, "build.tgz"), []byte("hello"), 0600); nil != err {
+		t.Fatalf("While writing file got %v", err)
+	}
+
+	config.Get.Debug = false
+	config.Get.Folder = root
+	config.Get.URLPrefix = ""
+	config.Get.Referrers = nil
+	config.Get.AccessKey = ""
+	config.Get.ErrorPages = nil
+	config.Get.Digests = true
+	defer func() {
+		config.Get.Folder = "/web"
+		config.Get.Digests = false
+	}()
+
+	handler, err := activateHandler()
+	if nil != err {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "http://localhost/build.tgz", nil)
+	w := httptest.NewRecorder()
+	handler(w, req)
+	expected := "sha-256=:LPJNul+wow4m6DsqxbninhsWHlwfp0JecwQzYpOLmCQ=:"
+	if result := w.Header().Get("Repr-Digest"); expected != result {
+		t.Errorf("Expected Repr-Digest '%s' but got '%s'", expected, result)
+	}
+
+	req = httptest.NewRequest("GET", "http://localhost/build.tgz.sha256?download", nil)
+	w = httptest.NewRecorder()
+	handler(w, req)
+	expected = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824  build.tgz\n"
+	if result := w.Body.String(); expected != result {
+		t.Errorf("Expected sidecar '%s' but got '%s'", expected, result)
+	}
+	expected = `attachment; filename="build.tgz.sha256"`
+	if result := w.Header().Get("Content-Disposition"); expected != result {
+		t.Errorf("Expected sidecar disposition '%s' but got '%s'", expected, result)
+	}
+}
+
+func TestHandlerSelectorMarkdown(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "docs"), 0700)
+	files := map[string]string{
+		filepath.Join(root, "docs", "guide.md"):  "# Guide",
+		filepath.Join(root, "docs", "README.md"): "# Read me",
+		filepath.Join(root, "page.tmpl"):         "<main>{{.Content}}</main>",
+	}
+	for filename, contents := range files {
+		if err := ioutil.WriteFile(filename, []byte(contents), 0600); nil != err {
+			t.Fatalf("While writing file got %v", err)
+		}
+	}
+
+	config.Get.Debug = false
+	config.Get.Folder = root
+	config.Get.URLPrefix = ""
+	config.Get.Referrers = nil
+	config.Get.AccessKey = ""
+	config.Get.ErrorPages = nil
+	config.Get.ShowListing = true
+	config.Get.Markdown = true
+	config.Get.MarkdownTmpl = filepath.Join(root, "page.tmpl")
+	defer func() {
+		config.Get.Folder = "/web"
+		config.Get.Markdown = false
+		config.Get.MarkdownTmpl = ""
+		handle.Activate(handle.NewSettings(), nil)
+	}()
+
+	handler, err := activateHandler()
+	if nil != err {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	testCases := []struct {
+		path     string
+		accept   string
+		contents string
+	}{
+		{"/docs/guide.md", "text/html", `<main><h1 id="guide">Guide</h1>` + "\n</main>"},
+		{"/docs/guide.md", "*/*", "# Guide"},
+		{"/docs/", "text/html", `<h1 id="read-me">Read me</h1>`},
+	}
+	for _, tc := range testCases {
+		fullpath := "http://localhost" + tc.path
+		req := httptest.NewRequest("GET", fullpath, nil)
+		req.Header.Set("Accept", tc.accept)
+		w := httptest.NewRecorder()
+
+		handler(w, req)
+
+		if !strings.Contains(w.Body.String(), tc.contents) {
+			t.Errorf("While retrieving %s expected contents with '%s' but got '%s'", fullpath, tc.contents, w.Body.String())
+		}
+	}
+
+	config.Get.MarkdownTmpl = filepath.Join(root, "missing.tmpl")
+	if _, _, err := handlerSelector(); nil == err {
+		t.Error("With a missing Markdown template expected an error but got nil")
+	}
+}
+
+func TestHandlerSelectorImages(t *testing.T) {
+	root, cache := t.TempDir(), t.TempDir()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 400, 200))); nil != err {
+		t.Fatalf("While encoding image got %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "photo.png"), buf.Bytes(), 0600); nil != err {
+		t.Fatalf("While writing file got %v", err)
+	}
+
+	config.Get.Debug = false
+	config.Get.Folder = root
+	config.Get.URLPrefix = ""
+	config.Get.Referrers = nil
+	config.Get.AccessKey = ""
+	config.Get.ErrorPages = nil
+	config.Get.ShowListing = true
+	config.Get.ImageSizes = []string{"200x0"}
+	config.Get.ImageCache = filepath.Join(cache, "images")
+	defer func() {
+		config.Get.Folder = "/web"
+		config.Get.ImageSizes = nil
+		config.Get.ImageCache = ""
+	}()
+
+	handler, err := activateHandler()
+	if nil != err {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	testCases := []struct {
+		path string
+		code int
+	}{
+		{"/photo.png?w=200", http.StatusOK},
+		{"/photo.png?w=100", http.StatusBadRequest},
+		{"/photo.png?format=gif", http.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		fullpath := "http://localhost" + tc.path
+		req := httptest.NewRequest("GET", fullpath, nil)
+		w := httptest.NewRecorder()
+
+		handler(w, req)
+
+		if tc.code != w.Code {
+			t.Errorf("While retrieving %s expected status code of %d but got %d", fullpath, tc.code, w.Code)
+		}
+	}
+
+	entries, err := ioutil.ReadDir(config.Get.ImageCache)
+	if nil != err || 1 != len(entries) {
+		t.Errorf("Expected the image cache to be created with a directory for the folder but got %v", err)
+	}
+}
+
+func TestHandlerSelectorMemoryCache(t *testing.T) {
+	root := t.TempDir()
+	filename := filepath.Join(root, "index.html")
+	if err := ioutil.WriteFile(filename, []byte("cached"), 0600); nil != err {
+		t.Fatalf("While writing file got %v", err)
+	}
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	os.Chtimes(filename, modTime, modTime)
+
+	config.Get.Debug = false
+	config.Get.Folder = root
+	config.Get.URLPrefix = ""
+	config.Get.Referrers = nil
+	config.Get.AccessKey = ""
+	config.Get.ErrorPages = nil
+	config.Get.ShowListing = true
+	config.Get.MemCacheBytes = 1024
+	config.Get.MemIntvl = time.Hour
+	defer func() {
+		config.Get.Folder = "/web"
+		config.Get.MemCacheBytes = 0
+		config.Get.MemIntvl = 0
+	}()
+
+	handler, err := activateHandler()
+	if nil != err {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	request := func() string {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", "http://localhost/", nil))
+		return w.Body.String()
+	}
+
+	// The file is served from memory until the check interval passes, even
+	// though it changed.
+	request()
+	if err := ioutil.WriteFile(filename, []byte("change"), 0600); nil != err {
+		t.Fatalf("While writing file got %v", err)
+	}
+	os.Chtimes(filename, modTime, modTime)
+	if contents := request(); "cached" != contents {
+		t.Errorf("Expected contents 'cached' from memory but got '%s'", contents)
+	}
+}
+
+func TestHandlerSelectorMetadataCache(t *testing.T) {
+	root := t.TempDir()
+
+	config.Get.Debug = false
+	config.Get.Folder = root
+	config.Get.URLPrefix = ""
+	config.Get.Referrers = nil
+	config.Get.AccessKey = ""
+	config.Get.ErrorPages = nil
+	config.Get.ShowListing = true
+	config.Get.MetaCache = true
+	config.Get.MetaIntvl = 10 * time.Millisecond
+	defer func() {
+		config.Get.Folder = "/web"
+		config.Get.MetaCache = false
+		config.Get.MetaIntvl = 0
+	}()
+
+	handler, err := activateHandler()
+	if nil != err {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	request := func() int {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", "http://localhost/page.html", nil))
+		return w.Code
+	}
+
+	// A missing file is served once added, when the change is seen or the
+	// cached metadata expires.
+	if code := request(); http.StatusNotFound != code {
+		t.Errorf("While retrieving a missing file expected status code of %d but got %d", http.StatusNotFound, code)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "page.html"), []byte("page"), 0600); nil != err {
+		t.Fatalf("While writing file got %v", err)
+	}
+	code := request()
+	for start := time.Now(); http.StatusOK != code && time.Since(start) < 5*time.Second; code = request() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if http.StatusOK != code {
+		t.Errorf("While retrieving an added file expected status code of %d but got %d", http.StatusOK, code)
+	}
+}
+
+func TestHandlerSelectorPreload(t *testing.T) {
+	root := t.TempDir()
+	page := strings.Repeat("<p>preloaded</p>", 100)
+	if err := ioutil.WriteFile(filepath.Join(root, "index.html"), []byte(page), 0600); nil != err {
+		t.Fatalf("While writing file got %v", err)
+	}
+
+	config.Get.Debug = false
+	config.Get.Folder = root
+	config.Get.URLPrefix = ""
+	config.Get.Referrers = nil
+	config.Get.AccessKey = ""
+	config.Get.ErrorPages = nil
+	config.Get.ShowListing = true
+	config.Get.Preload = true
+	config.Get.PreloadMemory = true
+	defer func() {
+		config.Get.Folder = "/web"
+		config.Get.Preload = false
+		config.Get.PreloadMemory = false
+	}()
+
+	handler, err := activateHandler()
+	if nil != err {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	// Removing the file doesn't affect content held in memory.
+	os.Remove(filepath.Join(root, "index.html"))
+	testCases := []struct {
+		encoding string
+		expected string
+	}{
+		{"gzip", "gzip"},
+		{"", ""},
+	}
+	for _, tc := range testCases {
+		req := httptest.NewRequest("GET", "http://localhost/", nil)
+		req.Header.Set("Accept-Encoding", tc.encoding)
+		w := httptest.NewRecorder()
+
+		handler(w, req)
+
+		if http.StatusOK != w.Code {
+			t.Errorf("With encoding '%s' expected status code of %d but got %d", tc.encoding, http.StatusOK, w.Code)
+		}
+		if encoding := w.Header().Get("Content-Encoding"); tc.expected != encoding {
+			t.Errorf("With encoding '%s' expected content encoding '%s' but got '%s'", tc.encoding, tc.expected, encoding)
+		}
+		if "" == w.Header().Get("ETag") {
+			t.Errorf("With encoding '%s' expected an entity tag but got none", tc.encoding)
+		}
+	}
+}
+
+func TestUseFileSystem(t *testing.T) {
+	buildTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	fsys, err := storage.Embedded(fstest.MapFS{
+		"index.html": {Data: []byte("embedded")},
+	}, buildTime)
+	if nil != err {
+		t.Fatalf("While embedding content got %v", err)
+	}
+
+	config.Get.Debug = false
+	config.Get.Folder = "/missing"
+	config.Get.ShowListing = true
+	config.Get.URLPrefix = ""
+	config.Get.Referrers = nil
+	config.Get.AccessKey = ""
+	config.Get.ErrorPages = nil
+	UseFileSystem(fsys)
+	defer func() {
+		config.Get.Folder = "/web"
+		selectFileSystem = fileSystemSelector
+	}()
+
+	handler, err := activateHandler()
+	if nil != err {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "http://localhost/", nil)
+	w := httptest.NewRecorder()
+	handler(w, req)
+	resp := w.Result()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if http.StatusOK != resp.StatusCode || "embedded" != string(body) {
+		t.Errorf("Expected embedded index but got %d '%s'", resp.StatusCode, body)
+	}
+	if modified := resp.Header.Get("Last-Modified"); buildTime.Format(http.TimeFormat) != modified {
+		t.Errorf("Expected Last-Modified of the build time but got '%s'", modified)
+	}
+	etag := resp.Header.Get("ETag")
+	if "" == etag {
+		t.Fatal("Expected an ETag but got none")
+	}
+
+	req = httptest.NewRequest("GET", "http://localhost/", nil)
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	handler(w, req)
+	if http.StatusNotModified != w.Code {
+		t.Errorf("With matching ETag expected status code of %d but got %d", http.StatusNotModified, w.Code)
+	}
+}
+
 func TestListenerSelector(t *testing.T) {
 	// This test only exercises function branches.
 	testCert := "file.crt"
@@ -6,9 +6,14 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"mime"
+	"net/url"
 	"os"
+	"path"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	yaml "gopkg.in/yaml.v3"
 )
@@ -16,53 +21,288 @@ import (
 var (
 	// Get the desired configuration value.
 	Get struct {
-		Cors          bool     `yaml:"cors"`
-		Debug         bool     `yaml:"debug"`
-		Folder        string   `yaml:"folder"`
-		Host          string   `yaml:"host"`
-		Port          uint16   `yaml:"port"`
-		AllowIndex    bool     `yaml:"allow-index"`
-		ShowListing   bool     `yaml:"show-listing"`
-		TLSCert       string   `yaml:"tls-cert"`
-		TLSKey        string   `yaml:"tls-key"`
-		TLSMinVers    uint16   `yaml:"-"`
-		TLSMinVersStr string   `yaml:"tls-min-vers"`
-		URLPrefix     string   `yaml:"url-prefix"`
-		Referrers     []string `yaml:"referrers"`
-		AccessKey     string   `yaml:"access-key"`
+		Cors          bool              `yaml:"cors"`
+		Debug         bool              `yaml:"debug"`
+		Folder        string            `yaml:"folder"`
+		Host          string            `yaml:"host"`
+		Port          uint16            `yaml:"port"`
+		AllowIndex    bool              `yaml:"allow-index"`
+		ShowListing   bool              `yaml:"show-listing"`
+		TLSCert       string            `yaml:"tls-cert"`
+		TLSKey        string            `yaml:"tls-key"`
+		TLSMinVers    uint16            `yaml:"-"`
+		TLSMinVersStr string            `yaml:"tls-min-vers"`
+		URLPrefix     string            `yaml:"url-prefix"`
+		Referrers     []string          `yaml:"referrers"`
+		AccessKey     string            `yaml:"access-key"`
+		ErrorPages    []ErrorPage       `yaml:"error-pages"`
+		ListingTmpl   string            `yaml:"listing-template"`
+		Archives      bool              `yaml:"archive-downloads"`
+		ArchiveBytes  uint64            `yaml:"archive-max-bytes"`
+		ArchiveFiles  uint64            `yaml:"archive-max-files"`
+		ServeArchives bool              `yaml:"serve-archives"`
+		Backend       string            `yaml:"backend"`
+		S3Endpoint    string            `yaml:"s3-endpoint"`
+		S3Region      string            `yaml:"s3-region"`
+		S3Bucket      string            `yaml:"s3-bucket"`
+		S3Prefix      string            `yaml:"s3-prefix"`
+		S3AccessKey   string            `yaml:"s3-access-key"`
+		S3SecretKey   string            `yaml:"s3-secret-key"`
+		S3PathStyle   bool              `yaml:"s3-path-style"`
+		S3Timeout     time.Duration     `yaml:"-"`
+		S3TimeoutStr  string            `yaml:"s3-timeout"`
+		CacheControl  string            `yaml:"cache-control"`
+		Mounts        []Mount           `yaml:"mounts"`
+		VirtualHosts  []VirtualHost     `yaml:"virtual-hosts"`
+		UnknownHosts  string            `yaml:"unknown-hosts"`
+		Redirects     string            `yaml:"redirects"`
+		HeadersFiles  bool              `yaml:"headers-files"`
+		CleanURLs     bool              `yaml:"clean-urls"`
+		TrailingSlash string            `yaml:"trailing-slash"`
+		IndexFiles    []string          `yaml:"index-files"`
+		MimeTypes     map[string]string `yaml:"mime-types"`
+		Charsets      map[string]string `yaml:"charsets"`
+		Sniffing      bool              `yaml:"content-sniffing"`
+		Downloads     []string          `yaml:"downloads"`
+		Digests       bool              `yaml:"digests"`
+		Markdown      bool              `yaml:"markdown"`
+		MarkdownTmpl  string            `yaml:"markdown-template"`
+		MarkdownCSS   string            `yaml:"markdown-css"`
+		ImageSizes    []string          `yaml:"image-sizes"`
+		ImageCache    string            `yaml:"image-cache"`
+		ImageCacheMax uint64            `yaml:"image-cache-bytes"`
+		MemCacheBytes uint64            `yaml:"memory-cache-bytes"`
+		MemCacheFile  uint64            `yaml:"memory-cache-file-bytes"`
+		MemIntvl      time.Duration     `yaml:"-"`
+		MemIntvlStr   string            `yaml:"memory-cache-interval"`
+		MetaCache     bool              `yaml:"metadata-cache"`
+		MetaIntvl     time.Duration     `yaml:"-"`
+		MetaIntvlStr  string            `yaml:"metadata-cache-interval"`
+		Preload       bool              `yaml:"preload"`
+		PreloadMemory bool              `yaml:"preload-memory"`
+		Shutdown      time.Duration     `yaml:"-"`
+		ShutdownStr   string            `yaml:"shutdown-timeout"`
+		ReloadIntvl   time.Duration     `yaml:"-"`
+		ReloadStr     string            `yaml:"reload-interval"`
 	}
 )
 
+// ErrorPage used in place of the default body of an HTTP error response.
+type ErrorPage struct {
+	Code   int    `yaml:"code"`
+	File   string `yaml:"file"`
+	Prefix string `yaml:"prefix,omitempty"`
+}
+
+// Path to the error page file. A relative path is relative to the folder.
+func (page ErrorPage) Path(folder string) string {
+	if filepath.IsAbs(page.File) {
+		return page.File
+	}
+	return filepath.Join(folder, page.File)
+}
+
+// Locate the error page file within the folders. A relative path is relative to
+// the first folder containing the file or, if none do, the first folder.
+func (page ErrorPage) Locate(folders []string) string {
+	for _, folder := range folders {
+		filename := page.Path(folder)
+		if _, err := os.Stat(filename); nil == err {
+			return filename
+		}
+	}
+	return page.Path(folders[0])
+}
+
+// Mount serves the folder, or comma-separated list of folders, at the URL path
+// prefix. Settings that are not set, other than the rules file, are inherited
+// from the top-level configuration.
+type Mount struct {
+	URLPrefix    string `yaml:"url-prefix"`
+	Folder       string `yaml:"folder"`
+	ShowListing  *bool  `yaml:"show-listing,omitempty"`
+	AllowIndex   *bool  `yaml:"allow-index,omitempty"`
+	Cors         *bool  `yaml:"cors,omitempty"`
+	AccessKey    string `yaml:"access-key,omitempty"`
+	CacheControl string `yaml:"cache-control,omitempty"`
+	Redirects    string `yaml:"redirects,omitempty"`
+}
+
+// VirtualHost serves a site for requests with a host matching one of the host
+// name patterns. Settings that are not set, other than the URL path prefix,
+// rules file and TLS certificate, are inherited from the top-level
+// configuration.
+type VirtualHost struct {
+	Hosts        []string `yaml:"hosts"`
+	Folder       string   `yaml:"folder"`
+	URLPrefix    string   `yaml:"url-prefix,omitempty"`
+	ShowListing  *bool    `yaml:"show-listing,omitempty"`
+	AllowIndex   *bool    `yaml:"allow-index,omitempty"`
+	Cors         *bool    `yaml:"cors,omitempty"`
+	AccessKey    string   `yaml:"access-key,omitempty"`
+	CacheControl string   `yaml:"cache-control,omitempty"`
+	Redirects    string   `yaml:"redirects,omitempty"`
+	TLSCert      string   `yaml:"tls-cert,omitempty"`
+	TLSKey       string   `yaml:"tls-key,omitempty"`
+}
+
+// Folders returns the comma-separated list of folders in the folder value, in
+// the order they are searched for files.
+func Folders() []string {
+	return SplitFolders(Get.Folder)
+}
+
+// SplitFolders returns the folders of the comma-separated list, in order.
+func SplitFolders(value string) []string {
+	var folders []string
+	for _, folder := range strings.Split(value, ",") {
+		if folder = strings.TrimSpace(folder); folder != "" {
+			folders = append(folders, folder)
+		}
+	}
+	if len(folders) == 0 {
+		return []string{value}
+	}
+	return folders
+}
+
+// maxImageSize is the largest width or height of resized images.
+const maxImageSize = 10000
+
+// ParseImageSize returns the width and height of the image size, formatted as
+// the width and height in pixels separated by an 'x' (such as '200x200'). A zero
+// width or height is scaled to keep the aspect ratio of the image, but not both.
+func ParseImageSize(value string) (width, height int, err error) {
+	parts := strings.Split(strings.TrimSpace(value), "x")
+	if len(parts) != 2 {
+		return 0, 0, errors.New("is not formatted as 'WIDTHxHEIGHT'")
+	}
+	if width, err = strconv.Atoi(parts[0]); nil != err || width < 0 || maxImageSize < width {
+		return 0, 0, fmt.Errorf("has a width that is not between 0 and %d", maxImageSize)
+	}
+	if height, err = strconv.Atoi(parts[1]); nil != err || height < 0 || maxImageSize < height {
+		return 0, 0, fmt.Errorf("has a height that is not between 0 and %d", maxImageSize)
+	}
+	if width == 0 && height == 0 {
+		return 0, 0, errors.New("has neither a width nor a height")
+	}
+	return width, height, nil
+}
+
 const (
-	corsKey        = "CORS"
-	debugKey       = "DEBUG"
-	folderKey      = "FOLDER"
-	hostKey        = "HOST"
-	portKey        = "PORT"
-	referrersKey   = "REFERRERS"
-	allowIndexKey  = "ALLOW_INDEX"
-	showListingKey = "SHOW_LISTING"
-	tlsCertKey     = "TLS_CERT"
-	tlsKeyKey      = "TLS_KEY"
-	tlsMinVersKey  = "TLS_MIN_VERS"
-	urlPrefixKey   = "URL_PREFIX"
-	accessKeyKey   = "ACCESS_KEY"
+	corsKey          = "CORS"
+	debugKey         = "DEBUG"
+	folderKey        = "FOLDER"
+	hostKey          = "HOST"
+	portKey          = "PORT"
+	referrersKey     = "REFERRERS"
+	allowIndexKey    = "ALLOW_INDEX"
+	showListingKey   = "SHOW_LISTING"
+	tlsCertKey       = "TLS_CERT"
+	tlsKeyKey        = "TLS_KEY"
+	tlsMinVersKey    = "TLS_MIN_VERS"
+	urlPrefixKey     = "URL_PREFIX"
+	accessKeyKey     = "ACCESS_KEY"
+	errorPagesKey    = "ERROR_PAGES"
+	listingTmplKey   = "LISTING_TEMPLATE"
+	archivesKey      = "ARCHIVE_DOWNLOADS"
+	archiveBytesKey  = "ARCHIVE_MAX_BYTES"
+	archiveFilesKey  = "ARCHIVE_MAX_FILES"
+	serveArchivesKey = "SERVE_ARCHIVES"
+	backendKey       = "BACKEND"
+	s3EndpointKey    = "S3_ENDPOINT"
+	s3RegionKey      = "S3_REGION"
+	s3BucketKey      = "S3_BUCKET"
+	s3PrefixKey      = "S3_PREFIX"
+	s3AccessKeyKey   = "S3_ACCESS_KEY"
+	s3SecretKeyKey   = "S3_SECRET_KEY"
+	s3PathStyleKey   = "S3_PATH_STYLE"
+	s3TimeoutKey     = "S3_TIMEOUT"
+	cacheControlKey  = "CACHE_CONTROL"
+	unknownHostsKey  = "UNKNOWN_HOSTS"
+	redirectsKey     = "REDIRECTS"
+	headersFilesKey  = "HEADERS_FILES"
+	cleanURLsKey     = "CLEAN_URLS"
+	trailingSlashKey = "TRAILING_SLASH"
+	indexFilesKey    = "INDEX_FILES"
+	sniffingKey      = "CONTENT_SNIFFING"
+	downloadsKey     = "DOWNLOADS"
+	digestsKey       = "DIGESTS"
+	markdownKey      = "MARKDOWN"
+	markdownTmplKey  = "MARKDOWN_TEMPLATE"
+	markdownCSSKey   = "MARKDOWN_CSS"
+	imageSizesKey    = "IMAGE_SIZES"
+	imageCacheKey    = "IMAGE_CACHE"
+	imageCacheMaxKey = "IMAGE_CACHE_BYTES"
+	memCacheBytesKey = "MEMORY_CACHE_BYTES"
+	memCacheFileKey  = "MEMORY_CACHE_FILE_BYTES"
+	memCacheIntvlKey = "MEMORY_CACHE_INTERVAL"
+	metaCacheKey     = "METADATA_CACHE"
+	metaIntvlKey     = "METADATA_CACHE_INTERVAL"
+	preloadKey       = "PRELOAD"
+	preloadMemoryKey = "PRELOAD_MEMORY"
+	shutdownKey      = "SHUTDOWN_TIMEOUT"
+	reloadIntvlKey   = "RELOAD_INTERVAL"
 )
 
 var (
-	defaultDebug       = false
-	defaultFolder      = "/web"
-	defaultHost        = ""
-	defaultPort        = uint16(8080)
-	defaultReferrers   = []string{}
-	defaultAllowIndex  = true
-	defaultShowListing = true
-	defaultTLSCert     = ""
-	defaultTLSKey      = ""
-	defaultTLSMinVers  = ""
-	defaultURLPrefix   = ""
-	defaultCors        = false
-	defaultAccessKey   = ""
+	defaultDebug         = false
+	defaultFolder        = "/web"
+	defaultHost          = ""
+	defaultPort          = uint16(8080)
+	defaultReferrers     = []string{}
+	defaultAllowIndex    = true
+	defaultShowListing   = true
+	defaultTLSCert       = ""
+	defaultTLSKey        = ""
+	defaultTLSMinVers    = ""
+	defaultURLPrefix     = ""
+	defaultCors          = false
+	defaultAccessKey     = ""
+	defaultErrorPages    = []ErrorPage{}
+	defaultListingTmpl   = ""
+	defaultArchives      = false
+	defaultArchiveBytes  = uint64(0)
+	defaultArchiveFiles  = uint64(0)
+	defaultServeArchives = false
+	defaultBackend       = ""
+	defaultS3Endpoint    = "https://s3.amazonaws.com"
+	defaultS3Region      = "us-east-1"
+	defaultS3Bucket      = ""
+	defaultS3Prefix      = ""
+	defaultS3AccessKey   = ""
+	defaultS3SecretKey   = ""
+	defaultS3PathStyle   = false
+	defaultS3Timeout     = "30s"
+	defaultCacheControl  = ""
+	defaultMounts        = []Mount{}
+	defaultVirtualHosts  = []VirtualHost{}
+	defaultUnknownHosts  = ""
+	defaultRedirects     = ""
+	defaultHeadersFiles  = false
+	defaultCleanURLs     = false
+	defaultTrailingSlash = ""
+	defaultIndexFiles    = []string{"index.html"}
+	defaultMimeTypes     = map[string]string{}
+	defaultCharsets      = map[string]string{}
+	defaultSniffing      = true
+	defaultDownloads     = []string{}
+	defaultDigests       = false
+	defaultMarkdown      = false
+	defaultMarkdownTmpl  = ""
+	defaultMarkdownCSS   = ""
+	defaultImageSizes    = []string{}
+	defaultImageCache    = ""
+	defaultImageCacheMax = uint64(1024 * 1024 * 1024)
+	defaultMemCacheBytes = uint64(0)
+	defaultMemCacheFile  = uint64(1024 * 1024)
+	defaultMemIntvl      = "1s"
+	defaultMetaCache     = false
+	defaultMetaIntvl     = "1s"
+	defaultPreload       = false
+	defaultPreloadMemory = false
+	defaultShutdown      = "25s"
+	defaultReloadIntvl   = "0s"
 )
 
 func init() {
@@ -84,10 +324,58 @@ func setDefaults() {
 	Get.URLPrefix = defaultURLPrefix
 	Get.Cors = defaultCors
 	Get.AccessKey = defaultAccessKey
+	Get.ErrorPages = defaultErrorPages
+	Get.ListingTmpl = defaultListingTmpl
+	Get.Archives = defaultArchives
+	Get.ArchiveBytes = defaultArchiveBytes
+	Get.ArchiveFiles = defaultArchiveFiles
+	Get.ServeArchives = defaultServeArchives
+	Get.Backend = defaultBackend
+	Get.S3Endpoint = defaultS3Endpoint
+	Get.S3Region = defaultS3Region
+	Get.S3Bucket = defaultS3Bucket
+	Get.S3Prefix = defaultS3Prefix
+	Get.S3AccessKey = defaultS3AccessKey
+	Get.S3SecretKey = defaultS3SecretKey
+	Get.S3PathStyle = defaultS3PathStyle
+	Get.S3TimeoutStr = defaultS3Timeout
+	Get.CacheControl = defaultCacheControl
+	Get.Mounts = defaultMounts
+	Get.VirtualHosts = defaultVirtualHosts
+	Get.UnknownHosts = defaultUnknownHosts
+	Get.Redirects = defaultRedirects
+	Get.HeadersFiles = defaultHeadersFiles
+	Get.CleanURLs = defaultCleanURLs
+	Get.TrailingSlash = defaultTrailingSlash
+	Get.IndexFiles = defaultIndexFiles
+	// Maps are copied, as configuration files are decoded into the existing
+	// maps.
+	Get.MimeTypes = copyStrMap(defaultMimeTypes)
+	Get.Charsets = copyStrMap(defaultCharsets)
+	Get.Sniffing = defaultSniffing
+	Get.Downloads = defaultDownloads
+	Get.Digests = defaultDigests
+	Get.Markdown = defaultMarkdown
+	Get.MarkdownTmpl = defaultMarkdownTmpl
+	Get.MarkdownCSS = defaultMarkdownCSS
+	Get.ImageSizes = defaultImageSizes
+	Get.ImageCache = defaultImageCache
+	Get.ImageCacheMax = defaultImageCacheMax
+	Get.MemCacheBytes = defaultMemCacheBytes
+	Get.MemCacheFile = defaultMemCacheFile
+	Get.MemIntvlStr = defaultMemIntvl
+	Get.MetaCache = defaultMetaCache
+	Get.MetaIntvlStr = defaultMetaIntvl
+	Get.Preload = defaultPreload
+	Get.PreloadMemory = defaultPreloadMemory
+	Get.ShutdownStr = defaultShutdown
+	Get.ReloadStr = defaultReloadIntvl
 }
 
 // Load the configuration file.
 func Load(filename string) (err error) {
+	loadedFile = filename
+
 	// If no filename provided, assign envvars.
 	if filename == "" {
 		overrideWithEnvVars()
@@ -111,9 +399,15 @@ func Load(filename string) (err error) {
 
 // Log the current configuration.
 func Log() {
+	// Keep the secret key for object storage out of the logs.
+	logged := Get
+	if 0 < len(logged.S3SecretKey) {
+		logged.S3SecretKey = "********"
+	}
+
 	// YAML marshalling should never error, but if it could, the result is that
 	// the contents of the configuration are not logged.
-	contents, _ := yaml.Marshal(&Get)
+	contents, _ := yaml.Marshal(&logged)
 
 	// Log the configuration.
 	fmt.Println("Using the following configuration:")
@@ -136,6 +430,46 @@ func overrideWithEnvVars() {
 	Get.URLPrefix = envAsStr(urlPrefixKey, Get.URLPrefix)
 	Get.Referrers = envAsStrSlice(referrersKey, Get.Referrers)
 	Get.AccessKey = envAsStr(accessKeyKey, Get.AccessKey)
+	Get.ErrorPages = envAsErrorPages(errorPagesKey, Get.ErrorPages)
+	Get.ListingTmpl = envAsStr(listingTmplKey, Get.ListingTmpl)
+	Get.Archives = envAsBool(archivesKey, Get.Archives)
+	Get.ArchiveBytes = envAsUint64(archiveBytesKey, Get.ArchiveBytes)
+	Get.ArchiveFiles = envAsUint64(archiveFilesKey, Get.ArchiveFiles)
+	Get.ServeArchives = envAsBool(serveArchivesKey, Get.ServeArchives)
+	Get.Backend = envAsStr(backendKey, Get.Backend)
+	Get.S3Endpoint = envAsStr(s3EndpointKey, Get.S3Endpoint)
+	Get.S3Region = envAsStr(s3RegionKey, Get.S3Region)
+	Get.S3Bucket = envAsStr(s3BucketKey, Get.S3Bucket)
+	Get.S3Prefix = envAsStr(s3PrefixKey, Get.S3Prefix)
+	Get.S3AccessKey = envAsStr(s3AccessKeyKey, Get.S3AccessKey)
+	Get.S3SecretKey = envAsStr(s3SecretKeyKey, Get.S3SecretKey)
+	Get.S3PathStyle = envAsBool(s3PathStyleKey, Get.S3PathStyle)
+	Get.S3TimeoutStr = envAsStr(s3TimeoutKey, Get.S3TimeoutStr)
+	Get.CacheControl = envAsStr(cacheControlKey, Get.CacheControl)
+	Get.UnknownHosts = envAsStr(unknownHostsKey, Get.UnknownHosts)
+	Get.Redirects = envAsStr(redirectsKey, Get.Redirects)
+	Get.HeadersFiles = envAsBool(headersFilesKey, Get.HeadersFiles)
+	Get.CleanURLs = envAsBool(cleanURLsKey, Get.CleanURLs)
+	Get.TrailingSlash = envAsStr(trailingSlashKey, Get.TrailingSlash)
+	Get.IndexFiles = envAsStrSlice(indexFilesKey, Get.IndexFiles)
+	Get.Sniffing = envAsBool(sniffingKey, Get.Sniffing)
+	Get.Downloads = envAsStrSlice(downloadsKey, Get.Downloads)
+	Get.Digests = envAsBool(digestsKey, Get.Digests)
+	Get.Markdown = envAsBool(markdownKey, Get.Markdown)
+	Get.MarkdownTmpl = envAsStr(markdownTmplKey, Get.MarkdownTmpl)
+	Get.MarkdownCSS = envAsStr(markdownCSSKey, Get.MarkdownCSS)
+	Get.ImageSizes = envAsStrSlice(imageSizesKey, Get.ImageSizes)
+	Get.ImageCache = envAsStr(imageCacheKey, Get.ImageCache)
+	Get.ImageCacheMax = envAsUint64(imageCacheMaxKey, Get.ImageCacheMax)
+	Get.MemCacheBytes = envAsUint64(memCacheBytesKey, Get.MemCacheBytes)
+	Get.MemCacheFile = envAsUint64(memCacheFileKey, Get.MemCacheFile)
+	Get.MemIntvlStr = envAsStr(memCacheIntvlKey, Get.MemIntvlStr)
+	Get.MetaCache = envAsBool(metaCacheKey, Get.MetaCache)
+	Get.MetaIntvlStr = envAsStr(metaIntvlKey, Get.MetaIntvlStr)
+	Get.Preload = envAsBool(preloadKey, Get.Preload)
+	Get.PreloadMemory = envAsBool(preloadMemoryKey, Get.PreloadMemory)
+	Get.ShutdownStr = envAsStr(shutdownKey, Get.ShutdownStr)
+	Get.ReloadStr = envAsStr(reloadIntvlKey, Get.ReloadStr)
 }
 
 // validate the configuration.
@@ -200,9 +534,289 @@ func validate() error {
 		return fmt.Errorf(msg, Get.URLPrefix)
 	}
 
+	// Verify each mount has a folder and a properly formatted URL path prefix
+	// that is not used by another mount.
+	prefixes := make(map[string]bool, len(Get.Mounts))
+	for _, mount := range Get.Mounts {
+		if !strings.HasPrefix(mount.URLPrefix, "/") || strings.HasSuffix(mount.URLPrefix, "/") {
+			msg := "value for 'mounts' has an entry with URL prefix '%s' but the " +
+				"value must start with '/' and not end with '/' (e.g. '/my/prefix')"
+			return fmt.Errorf(msg, mount.URLPrefix)
+		}
+		if prefixes[mount.URLPrefix] {
+			msg := "value for 'mounts' has more than one entry with URL prefix '%s'"
+			return fmt.Errorf(msg, mount.URLPrefix)
+		}
+		prefixes[mount.URLPrefix] = true
+		if len(mount.Folder) == 0 {
+			msg := "value for 'mounts' has an entry with URL prefix '%s' without a folder"
+			return fmt.Errorf(msg, mount.URLPrefix)
+		}
+	}
+
+	// Verify each virtual host has a folder, valid host name patterns that are
+	// not used by another virtual host and, if set, a properly formatted URL
+	// path prefix and complete TLS certificate.
+	patterns := make(map[string]bool)
+	for _, host := range Get.VirtualHosts {
+		if len(host.Hosts) == 0 {
+			msg := "value for 'virtual-hosts' has an entry for folder '%s' without hosts"
+			return fmt.Errorf(msg, host.Folder)
+		}
+		for _, pattern := range host.Hosts {
+			pattern = strings.ToLower(pattern)
+			if name := strings.TrimPrefix(pattern, "*."); len(name) == 0 ||
+				strings.ContainsAny(name, "*/") {
+				msg := "value for 'virtual-hosts' has an entry with host '%s' but " +
+					"the value must be a host name, optionally starting with '*.' " +
+					"(e.g. 'docs.example.com' or '*.example.com')"
+				return fmt.Errorf(msg, pattern)
+			}
+			if patterns[pattern] {
+				msg := "value for 'virtual-hosts' has more than one entry with host '%s'"
+				return fmt.Errorf(msg, pattern)
+			}
+			patterns[pattern] = true
+		}
+		if len(host.Folder) == 0 {
+			msg := "value for 'virtual-hosts' has an entry for host '%s' without a folder"
+			return fmt.Errorf(msg, host.Hosts[0])
+		}
+		if 0 < len(host.URLPrefix) &&
+			(!strings.HasPrefix(host.URLPrefix, "/") || strings.HasSuffix(host.URLPrefix, "/")) {
+			msg := "value for 'virtual-hosts' has an entry with URL prefix '%s' but " +
+				"the value must start with '/' and not end with '/' (e.g. '/my/prefix')"
+			return fmt.Errorf(msg, host.URLPrefix)
+		}
+		if 0 < len(host.TLSCert) || 0 < len(host.TLSKey) {
+			if len(host.TLSCert) == 0 || len(host.TLSKey) == 0 {
+				msg := "value for 'virtual-hosts' has an entry for host '%s' with " +
+					"only one of 'tls-cert' and 'tls-key' set"
+				return fmt.Errorf(msg, host.Hosts[0])
+			}
+			if !useTLS {
+				msg := "value for 'virtual-hosts' has an entry for host '%s' with a " +
+					"TLS certificate but 'TLS_CERT' and 'TLS_KEY' are not set"
+				return fmt.Errorf(msg, host.Hosts[0])
+			}
+			for _, filename := range []string{host.TLSCert, host.TLSKey} {
+				if _, err := os.Stat(filename); nil != err {
+					msg := "value for 'virtual-hosts' is set with filename '%s' that returns %v"
+					return fmt.Errorf(msg, filename, err)
+				}
+			}
+		}
+	}
+
+	// Verify unknown hosts, if set, are served a known status code.
+	switch Get.UnknownHosts {
+	case "", "404", "421":
+	default:
+		msg := "value for 'UNKNOWN_HOSTS' is set to '%s' but must be '404' or '421'"
+		return fmt.Errorf(msg, Get.UnknownHosts)
+	}
+
+	// Verify trailing slashes, if set, are added or removed.
+	switch Get.TrailingSlash {
+	case "", "add", "remove":
+	default:
+		msg := "value for 'TRAILING_SLASH' is set to '%s' but must be 'add' or 'remove'"
+		return fmt.Errorf(msg, Get.TrailingSlash)
+	}
+
+	// Verify at least one index file is set and that each is a file name.
+	if len(Get.IndexFiles) == 0 {
+		return errors.New("value for 'INDEX_FILES' must have at least one file name")
+	}
+	for _, name := range Get.IndexFiles {
+		if name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+			msg := "value for 'INDEX_FILES' has an entry '%s' that is not a file name"
+			return fmt.Errorf(msg, name)
+		}
+	}
+
+	// Verify content types and charsets are set for file extensions and that
+	// the content types are valid.
+	for ext, contentType := range Get.MimeTypes {
+		if !strings.HasPrefix(ext, ".") {
+			msg := "value for 'mime-types' has an entry '%s' that is not a file extension"
+			return fmt.Errorf(msg, ext)
+		}
+		if _, _, err := mime.ParseMediaType(contentType); nil != err {
+			msg := "value for 'mime-types' has an entry for '%s' with content type '%s' that returns %v"
+			return fmt.Errorf(msg, ext, contentType, err)
+		}
+	}
+	for ext, charset := range Get.Charsets {
+		if !strings.HasPrefix(ext, ".") {
+			msg := "value for 'charsets' has an entry '%s' that is not a file extension"
+			return fmt.Errorf(msg, ext)
+		}
+		if charset == "" {
+			msg := "value for 'charsets' has an entry for '%s' without a charset"
+			return fmt.Errorf(msg, ext)
+		}
+	}
+
+	// Verify the patterns of files served as downloads are valid.
+	for _, pattern := range Get.Downloads {
+		if _, err := path.Match(pattern, ""); nil != err || pattern == "" {
+			msg := "value for 'DOWNLOADS' has an entry '%s' that is not a valid pattern"
+			return fmt.Errorf(msg, pattern)
+		}
+	}
+
+	// Verify the allowed sizes of resized images are valid.
+	for _, size := range Get.ImageSizes {
+		if _, _, err := ParseImageSize(size); nil != err {
+			msg := "value for 'IMAGE_SIZES' has an entry '%s' that %v"
+			return fmt.Errorf(msg, size, err)
+		}
+	}
+
+	// Verify the intervals of the caches are durations that aren't negative.
+	var err error
+	if Get.MemIntvl, err = durationValue(memCacheIntvlKey, Get.MemIntvlStr); nil != err {
+		return err
+	}
+	if Get.MetaIntvl, err = durationValue(metaIntvlKey, Get.MetaIntvlStr); nil != err {
+		return err
+	}
+
+	// Verify content is only held in memory if it is preloaded.
+	if Get.PreloadMemory && !Get.Preload {
+		return errors.New("value for 'PRELOAD_MEMORY' is 'true' but 'PRELOAD' is not")
+	}
+
+	// Verify the timeout of requests to object storage is a duration that
+	// isn't negative.
+	if Get.S3Timeout, err = durationValue(s3TimeoutKey, Get.S3TimeoutStr); nil != err {
+		return err
+	}
+
+	// Verify the time waited for active requests when shutting down is a
+	// duration that isn't negative.
+	if Get.Shutdown, err = durationValue(shutdownKey, Get.ShutdownStr); nil != err {
+		return err
+	}
+
+	// Verify the interval of checking the configuration file for changes is a
+	// duration that isn't negative.
+	if Get.ReloadIntvl, err = durationValue(reloadIntvlKey, Get.ReloadStr); nil != err {
+		return err
+	}
+
+	// Verify each error page is for an error status code and that the file
+	// exists. Relative paths are relative to the folders being served.
+	for _, page := range Get.ErrorPages {
+		if page.Code < 400 || page.Code > 599 {
+			msg := "value for 'ERROR_PAGES' has an entry with status code %d " +
+				"that is not an HTTP error status code (400-599)"
+			return fmt.Errorf(msg, page.Code)
+		}
+		if 0 < len(page.Prefix) && !strings.HasPrefix(page.Prefix, "/") {
+			msg := "value for 'ERROR_PAGES' has an entry with prefix '%s' " +
+				"that does not start with '/'"
+			return fmt.Errorf(msg, page.Prefix)
+		}
+		if len(page.File) == 0 {
+			msg := "value for 'ERROR_PAGES' has an entry for status code %d " +
+				"without a file"
+			return fmt.Errorf(msg, page.Code)
+		}
+		filename := page.Locate(Folders())
+		if _, err := os.Stat(filename); nil != err {
+			msg := "value for 'ERROR_PAGES' is set with filename '%s' that returns %v"
+			return fmt.Errorf(msg, filename, err)
+		}
+	}
+
+	// Verify the storage backend, if set, is known.
+	switch Get.Backend {
+	case "", "local", "archive":
+	case "s3":
+		// Verify the bucket is set, the endpoint is an HTTP(S) URL and the
+		// credentials, if any, are complete.
+		if len(Get.S3Bucket) == 0 {
+			return errors.New("value for 'S3_BUCKET' must be set when 'BACKEND' is 's3'")
+		}
+		if endpoint, err := url.Parse(Get.S3Endpoint); nil != err ||
+			(endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+			msg := "value for 'S3_ENDPOINT' is set to '%s' but must be an HTTP(S) URL"
+			return fmt.Errorf(msg, Get.S3Endpoint)
+		}
+		if (len(Get.S3AccessKey) == 0) != (len(Get.S3SecretKey) == 0) {
+			return errors.New("if value for either 'S3_ACCESS_KEY' or 'S3_SECRET_KEY' " +
+				"is set then the value for the other must also be set")
+		}
+		if 0 == Get.S3Timeout {
+			return errors.New("value for 'S3_TIMEOUT' must be longer than '0s' when 'BACKEND' is 's3'")
+		}
+	default:
+		msg := "value for 'BACKEND' is set to '%s' but must be 'local', 'archive' or 's3'"
+		return fmt.Errorf(msg, Get.Backend)
+	}
+
+	// If rules files are to be used, verify the files exist.
+	redirects := []string{Get.Redirects}
+	for _, mount := range Get.Mounts {
+		redirects = append(redirects, mount.Redirects)
+	}
+	for _, host := range Get.VirtualHosts {
+		redirects = append(redirects, host.Redirects)
+	}
+	for _, filename := range redirects {
+		if 0 < len(filename) {
+			if _, err := os.Stat(filename); nil != err {
+				msg := "value of REDIRECTS is set with filename '%s' that returns %v"
+				return fmt.Errorf(msg, filename, err)
+			}
+		}
+	}
+
+	// If a directory listing template is to be used, verify the file exists.
+	if 0 < len(Get.ListingTmpl) {
+		if _, err := os.Stat(Get.ListingTmpl); nil != err {
+			msg := "value of LISTING_TEMPLATE is set with filename '%s' that returns %v"
+			return fmt.Errorf(msg, Get.ListingTmpl, err)
+		}
+	}
+
+	// If a Markdown template is to be used, verify the file exists.
+	if 0 < len(Get.MarkdownTmpl) {
+		if _, err := os.Stat(Get.MarkdownTmpl); nil != err {
+			msg := "value of MARKDOWN_TEMPLATE is set with filename '%s' that returns %v"
+			return fmt.Errorf(msg, Get.MarkdownTmpl, err)
+		}
+	}
+
 	return nil
 }
 
+// durationValue returns the duration of the value of the setting with the key,
+// or '0' if the value isn't set.
+func durationValue(key, value string) (time.Duration, error) {
+	if 0 == len(value) {
+		return 0, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if nil != err || duration < 0 {
+		msg := "value for '%s' is set to '%s' but must be a duration such as " +
+			"'1s' or '500ms'"
+		return 0, fmt.Errorf(msg, key, value)
+	}
+	return duration, nil
+}
+
+// copyStrMap returns a copy of the map.
+func copyStrMap(values map[string]string) map[string]string {
+	copied := make(map[string]string, len(values))
+	for key, value := range values {
+		copied[key] = value
+	}
+	return copied
+}
+
 // envAsStr returns the value of the environment variable as a string if set.
 func envAsStr(key, fallback string) string {
 	if value := os.Getenv(key); value != "" {
@@ -220,6 +834,34 @@ func envAsStrSlice(key string, fallback []string) []string {
 	return fallback
 }
 
+// envAsErrorPages returns the value of the environment variable as a slice of
+// error pages if set. Each comma-separated entry is formatted as 'CODE=FILE'
+// (e.g. '404=errors/404.html').
+func envAsErrorPages(key string, fallback []ErrorPage) []ErrorPage {
+	valueStr := os.Getenv(key)
+	if valueStr == "" {
+		return fallback
+	}
+
+	pages := []ErrorPage{}
+	for _, entry := range strings.Split(valueStr, ",") {
+		parts := strings.SplitN(entry, "=", 2)
+		code, err := strconv.Atoi(parts[0])
+		if nil == err && len(parts) != 2 {
+			err = errors.New("missing '=FILE'")
+		}
+		if nil != err {
+			log.Printf(
+				"Invalid value for '%s' entry '%s': %v\nUsing fallback: %v",
+				key, entry, err, fallback,
+			)
+			return fallback
+		}
+		pages = append(pages, ErrorPage{Code: code, File: parts[1]})
+	}
+	return pages
+}
+
 // envAsUint16 returns the value of the environment variable as a uint16 if set.
 func envAsUint16(key string, fallback uint16) uint16 {
 	// Retrieve the string value of the environment variable. If not set,
@@ -243,6 +885,29 @@ func envAsUint16(key string, fallback uint16) uint16 {
 	return uint16(valueAsUint64)
 }
 
+// envAsUint64 returns the value of the environment variable as a uint64 if set.
+func envAsUint64(key string, fallback uint64) uint64 {
+	// Retrieve the string value of the environment variable. If not set,
+	// fallback is used.
+	valueStr := os.Getenv(key)
+	if valueStr == "" {
+		return fallback
+	}
+
+	// Parse the string into a uint64.
+	base := 10
+	bitSize := 64
+	value, err := strconv.ParseUint(valueStr, base, bitSize)
+	if nil != err {
+		log.Printf(
+			"Invalid value for '%s': %v\nUsing fallback: %d",
+			key, err, fallback,
+		)
+		return fallback
+	}
+	return value
+}
+
 // envAsBool returns the value for an environment variable or, if not set, a
 // fallback value as a boolean.
 func envAsBool(key string, fallback bool) bool {
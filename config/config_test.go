@@ -6,7 +6,9 @@ import (
 	"io/ioutil"
 	"os"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	yaml "gopkg.in/yaml.v3"
 )
@@ -74,6 +76,14 @@ func TestLog(t *testing.T) {
 		t.Errorf("While testing YAML marshalling for config Log() got %v", err)
 	}
 	Log()
+
+	// The secret key is masked in the log without changing the configuration.
+	Get.S3SecretKey = "secret"
+	Log()
+	if "secret" != Get.S3SecretKey {
+		t.Errorf("Expected secret key to be unchanged but got '%s'", Get.S3SecretKey)
+	}
+	Get.S3SecretKey = defaultS3SecretKey
 }
 
 func TestOverrideWithEnvvars(t *testing.T) {
@@ -205,6 +215,708 @@ func TestValidate(t *testing.T) {
 	}
 }
 
+func TestValidateErrorPages(t *testing.T) {
+	folder := "."
+	validPath := "config.go"
+	invalidPath := "should/never/exist.html"
+
+	testCases := []struct {
+		name    string
+		pages   []ErrorPage
+		isError bool
+	}{
+		{"No pages", []ErrorPage{}, false},
+		{"Valid page", []ErrorPage{{Code: 404, File: validPath}}, false},
+		{"Valid page w/prefix", []ErrorPage{{Code: 500, File: validPath, Prefix: "/my"}}, false},
+		{"Missing file", []ErrorPage{{Code: 404, File: invalidPath}}, true},
+		{"Empty file", []ErrorPage{{Code: 404}}, true},
+		{"Success code", []ErrorPage{{Code: 200, File: validPath}}, true},
+		{"Unknown code", []ErrorPage{{Code: 600, File: validPath}}, true},
+		{"Prefix missing leading /", []ErrorPage{{Code: 404, File: validPath, Prefix: "my"}}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			Get.Folder = folder
+			Get.ErrorPages = tc.pages
+			err := validate()
+			hasError := nil != err
+			if hasError && !tc.isError {
+				t.Errorf("Expected no error but got %v", err)
+			}
+			if !hasError && tc.isError {
+				t.Error("Expected an error but got no error")
+			}
+		})
+	}
+}
+
+func TestValidateMounts(t *testing.T) {
+	testCases := []struct {
+		name    string
+		mounts  []Mount
+		isError bool
+	}{
+		{"No mounts", []Mount{}, false},
+		{"Valid mounts", []Mount{{URLPrefix: "/docs", Folder: "/docs"}, {URLPrefix: "/docs/api", Folder: "/api"}}, false},
+		{"Missing folder", []Mount{{URLPrefix: "/docs"}}, true},
+		{"Missing prefix", []Mount{{Folder: "/docs"}}, true},
+		{"Prefix missing leading /", []Mount{{URLPrefix: "docs", Folder: "/docs"}}, true},
+		{"Prefix w/trailing /", []Mount{{URLPrefix: "/docs/", Folder: "/docs"}}, true},
+		{"Duplicate prefix", []Mount{{URLPrefix: "/docs", Folder: "/docs"}, {URLPrefix: "/docs", Folder: "/api"}}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			Get.Mounts = tc.mounts
+			err := validate()
+			hasError := nil != err
+			if hasError && !tc.isError {
+				t.Errorf("Expected no error but got %v", err)
+			}
+			if !hasError && tc.isError {
+				t.Error("Expected an error but got no error")
+			}
+		})
+	}
+}
+
+func TestMountsYAML(t *testing.T) {
+	contents := []byte(`
+mounts:
+  - url-prefix: /docs
+    folder: /srv/docs
+    show-listing: false
+    cache-control: no-cache
+  - url-prefix: /assets
+    folder: /srv/assets
+`)
+	setDefaults()
+	if err := yaml.Unmarshal(contents, &Get); nil != err {
+		t.Fatalf("While unmarshalling mounts expected nil but got %v", err)
+	}
+	if 2 != len(Get.Mounts) {
+		t.Fatalf("Expected 2 mounts but got %d", len(Get.Mounts))
+	}
+	docs, assets := Get.Mounts[0], Get.Mounts[1]
+	if "/docs" != docs.URLPrefix || "/srv/docs" != docs.Folder || "no-cache" != docs.CacheControl {
+		t.Errorf("Expected docs mount but got %+v", docs)
+	}
+	if nil == docs.ShowListing || *docs.ShowListing {
+		t.Errorf("Expected docs mount to hide listings but got %v", docs.ShowListing)
+	}
+	if nil != assets.ShowListing || nil != assets.AllowIndex || nil != assets.Cors {
+		t.Errorf("Expected assets mount to inherit settings but got %+v", assets)
+	}
+	setDefaults()
+}
+
+func TestValidateVirtualHosts(t *testing.T) {
+	validPath := "config.go"
+	docs := func(host VirtualHost) []VirtualHost {
+		host.Hosts = []string{"docs.example.com"}
+		if len(host.Folder) == 0 {
+			host.Folder = "/docs"
+		}
+		return []VirtualHost{host}
+	}
+
+	testCases := []struct {
+		name    string
+		hosts   []VirtualHost
+		tls     bool
+		unknown string
+		isError bool
+	}{
+		{"No hosts", []VirtualHost{}, false, "", false},
+		{"Valid hosts", []VirtualHost{
+			{Hosts: []string{"docs.example.com"}, Folder: "/docs"},
+			{Hosts: []string{"*.example.com", "example.com"}, Folder: "/www", URLPrefix: "/www"},
+		}, false, "", false},
+		{"Missing hosts", []VirtualHost{{Folder: "/docs"}}, false, "", true},
+		{"Missing folder", []VirtualHost{{Hosts: []string{"docs.example.com"}}}, false, "", true},
+		{"Empty host", []VirtualHost{{Hosts: []string{""}, Folder: "/docs"}}, false, "", true},
+		{"Empty wildcard", []VirtualHost{{Hosts: []string{"*."}, Folder: "/docs"}}, false, "", true},
+		{"Inner wildcard", []VirtualHost{{Hosts: []string{"docs.*.com"}, Folder: "/docs"}}, false, "", true},
+		{"Host w/path", []VirtualHost{{Hosts: []string{"example.com/docs"}, Folder: "/docs"}}, false, "", true},
+		{"Duplicate host", []VirtualHost{
+			{Hosts: []string{"docs.example.com"}, Folder: "/docs"},
+			{Hosts: []string{"DOCS.example.com"}, Folder: "/www"},
+		}, false, "", true},
+		{"Prefix w/trailing /", docs(VirtualHost{URLPrefix: "/docs/"}), false, "", true},
+		{"Certificate", docs(VirtualHost{TLSCert: validPath, TLSKey: validPath}), true, "", false},
+		{"Certificate w/o key", docs(VirtualHost{TLSCert: validPath}), true, "", true},
+		{"Certificate w/o TLS", docs(VirtualHost{TLSCert: validPath, TLSKey: validPath}), false, "", true},
+		{"Missing certificate", docs(VirtualHost{TLSCert: "missing.pem", TLSKey: validPath}), true, "", true},
+		{"Unknown not found", docs(VirtualHost{}), false, "404", false},
+		{"Unknown misdirected", docs(VirtualHost{}), false, "421", false},
+		{"Unknown invalid", docs(VirtualHost{}), false, "500", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			Get.VirtualHosts = tc.hosts
+			Get.UnknownHosts = tc.unknown
+			if tc.tls {
+				Get.TLSCert = validPath
+				Get.TLSKey = validPath
+			}
+			err := validate()
+			hasError := nil != err
+			if hasError && !tc.isError {
+				t.Errorf("Expected no error but got %v", err)
+			}
+			if !hasError && tc.isError {
+				t.Error("Expected an error but got no error")
+			}
+		})
+	}
+	setDefaults()
+}
+
+func TestVirtualHostsYAML(t *testing.T) {
+	contents := []byte(`
+unknown-hosts: "421"
+virtual-hosts:
+  - hosts: [docs.example.com, "*.docs.example.com"]
+    folder: /srv/docs
+    show-listing: false
+    tls-cert: /etc/docs.pem
+    tls-key: /etc/docs.key
+  - hosts: [assets.example.com]
+    folder: /srv/assets
+    access-key: secret
+`)
+	setDefaults()
+	if err := yaml.Unmarshal(contents, &Get); nil != err {
+		t.Fatalf("While unmarshalling virtual hosts expected nil but got %v", err)
+	}
+	if "421" != Get.UnknownHosts {
+		t.Errorf("Expected unknown hosts '421' but got '%s'", Get.UnknownHosts)
+	}
+	if 2 != len(Get.VirtualHosts) {
+		t.Fatalf("Expected 2 virtual hosts but got %d", len(Get.VirtualHosts))
+	}
+	docs, assets := Get.VirtualHosts[0], Get.VirtualHosts[1]
+	if 2 != len(docs.Hosts) || "*.docs.example.com" != docs.Hosts[1] ||
+		"/srv/docs" != docs.Folder || "/etc/docs.pem" != docs.TLSCert {
+		t.Errorf("Expected docs virtual host but got %+v", docs)
+	}
+	if nil == docs.ShowListing || *docs.ShowListing {
+		t.Errorf("Expected docs virtual host to hide listings but got %v", docs.ShowListing)
+	}
+	if "secret" != assets.AccessKey || nil != assets.ShowListing {
+		t.Errorf("Expected assets virtual host but got %+v", assets)
+	}
+	setDefaults()
+}
+
+func TestValidateListingTemplate(t *testing.T) {
+	testCases := []struct {
+		name    string
+		tmpl    string
+		isError bool
+	}{
+		{"No template", "", false},
+		{"Valid template", "config.go", false},
+		{"Missing template", "should/never/exist.tmpl", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			Get.ListingTmpl = tc.tmpl
+			err := validate()
+			hasError := nil != err
+			if hasError && !tc.isError {
+				t.Errorf("Expected no error but got %v", err)
+			}
+			if !hasError && tc.isError {
+				t.Error("Expected an error but got no error")
+			}
+		})
+	}
+}
+
+func TestValidateMarkdownTemplate(t *testing.T) {
+	testCases := []struct {
+		name    string
+		tmpl    string
+		isError bool
+	}{
+		{"No template", "", false},
+		{"Valid template", "config.go", false},
+		{"Missing template", "should/never/exist.tmpl", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			Get.MarkdownTmpl = tc.tmpl
+			err := validate()
+			hasError := nil != err
+			if hasError && !tc.isError {
+				t.Errorf("Expected no error but got %v", err)
+			}
+			if !hasError && tc.isError {
+				t.Error("Expected an error but got no error")
+			}
+		})
+	}
+}
+
+func TestValidateRedirects(t *testing.T) {
+	validPath := "config.go"
+	invalidPath := "should/never/exist.txt"
+
+	testCases := []struct {
+		name      string
+		redirects string
+		mount     string
+		host      string
+		isError   bool
+	}{
+		{"Not set", "", "", "", false},
+		{"Valid", validPath, validPath, validPath, false},
+		{"Missing", invalidPath, "", "", true},
+		{"Missing for mount", "", invalidPath, "", true},
+		{"Missing for virtual host", "", "", invalidPath, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			Get.Redirects = tc.redirects
+			Get.Mounts = []Mount{{URLPrefix: "/docs", Folder: "/docs", Redirects: tc.mount}}
+			Get.VirtualHosts = []VirtualHost{{Hosts: []string{"example.com"}, Folder: "/www", Redirects: tc.host}}
+			err := validate()
+			hasError := nil != err
+			if hasError && !tc.isError {
+				t.Errorf("Expected no error but got %v", err)
+			}
+			if !hasError && tc.isError {
+				t.Error("Expected an error but got no error")
+			}
+		})
+	}
+	setDefaults()
+}
+
+func TestValidateTrailingSlash(t *testing.T) {
+	testCases := []struct {
+		value   string
+		isError bool
+	}{
+		{"", false},
+		{"add", false},
+		{"remove", false},
+		{"keep", true},
+		{"Add", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.value, func(t *testing.T) {
+			setDefaults()
+			Get.TrailingSlash = tc.value
+			err := validate()
+			hasError := nil != err
+			if hasError && !tc.isError {
+				t.Errorf("Expected no error but got %v", err)
+			}
+			if !hasError && tc.isError {
+				t.Error("Expected an error but got no error")
+			}
+		})
+	}
+	setDefaults()
+}
+
+func TestValidateIndexFiles(t *testing.T) {
+	testCases := []struct {
+		name    string
+		value   []string
+		isError bool
+	}{
+		{"Default", []string{"index.html"}, false},
+		{"Several", []string{"index.html", "index.htm", "README.html"}, false},
+		{"None", []string{}, true},
+		{"Empty name", []string{"index.html", ""}, true},
+		{"Path", []string{"docs/index.html"}, true},
+		{"Parent", []string{".."}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			Get.IndexFiles = tc.value
+			err := validate()
+			hasError := nil != err
+			if hasError && !tc.isError {
+				t.Errorf("Expected no error but got %v", err)
+			}
+			if !hasError && tc.isError {
+				t.Error("Expected an error but got no error")
+			}
+		})
+	}
+	setDefaults()
+}
+
+func TestValidateContentTypes(t *testing.T) {
+	testCases := []struct {
+		name      string
+		mimeTypes map[string]string
+		charsets  map[string]string
+		isError   bool
+	}{
+		{"None", map[string]string{}, map[string]string{}, false},
+		{"Content types", map[string]string{".wasm": "application/wasm", ".txt": "text/plain; charset=utf-8"}, nil, false},
+		{"Charsets", nil, map[string]string{".txt": "iso-8859-1"}, false},
+		{"Extension without dot", map[string]string{"wasm": "application/wasm"}, nil, true},
+		{"Bad content type", map[string]string{".wasm": "application/"}, nil, true},
+		{"Charset extension without dot", nil, map[string]string{"txt": "utf-8"}, true},
+		{"Empty charset", nil, map[string]string{".txt": ""}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			Get.MimeTypes = tc.mimeTypes
+			Get.Charsets = tc.charsets
+			err := validate()
+			hasError := nil != err
+			if hasError && !tc.isError {
+				t.Errorf("Expected no error but got %v", err)
+			}
+			if !hasError && tc.isError {
+				t.Error("Expected an error but got no error")
+			}
+		})
+	}
+	setDefaults()
+}
+
+func TestValidateDownloads(t *testing.T) {
+	testCases := []struct {
+		name    string
+		value   []string
+		isError bool
+	}{
+		{"None", []string{}, false},
+		{"Patterns", []string{"*.pdf", "/reports/*", "application/*"}, false},
+		{"Empty pattern", []string{"*.pdf", ""}, true},
+		{"Bad pattern", []string{"[.pdf"}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			Get.Downloads = tc.value
+			err := validate()
+			hasError := nil != err
+			if hasError && !tc.isError {
+				t.Errorf("Expected no error but got %v", err)
+			}
+			if !hasError && tc.isError {
+				t.Error("Expected an error but got no error")
+			}
+		})
+	}
+	setDefaults()
+}
+
+func TestValidateImageSizes(t *testing.T) {
+	testCases := []struct {
+		name    string
+		value   []string
+		isError bool
+	}{
+		{"None", []string{}, false},
+		{"Sizes", []string{"200x200", "800x0", "0x400"}, false},
+		{"Missing height", []string{"200"}, true},
+		{"Not a number", []string{"wide x200"}, true},
+		{"Negative", []string{"-200x200"}, true},
+		{"Too large", []string{"20000x200"}, true},
+		{"Zero", []string{"0x0"}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			Get.ImageSizes = tc.value
+			err := validate()
+			hasError := nil != err
+			if hasError && !tc.isError {
+				t.Errorf("Expected no error but got %v", err)
+			}
+			if !hasError && tc.isError {
+				t.Error("Expected an error but got no error")
+			}
+		})
+	}
+	setDefaults()
+}
+
+func TestValidateCacheIntervals(t *testing.T) {
+	testCases := []struct {
+		name     string
+		value    string
+		interval time.Duration
+		isError  bool
+	}{
+		{"Not set", "", 0, false},
+		{"Seconds", "1s", time.Second, false},
+		{"Milliseconds", "250ms", 250 * time.Millisecond, false},
+		{"Zero", "0s", 0, false},
+		{"Negative", "-1s", 0, true},
+		{"No unit", "5", 0, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, field := range []*string{&Get.MemIntvlStr, &Get.MetaIntvlStr} {
+				setDefaults()
+				*field = tc.value
+				err := validate()
+				hasError := nil != err
+				if hasError && !tc.isError {
+					t.Errorf("Expected no error but got %v", err)
+				}
+				if !hasError && tc.isError {
+					t.Error("Expected an error but got no error")
+				}
+			}
+			if !tc.isError && (tc.interval != Get.MetaIntvl || time.Second != Get.MemIntvl) {
+				t.Errorf("Expected intervals %v and 1s but got %v and %v", tc.interval, Get.MetaIntvl, Get.MemIntvl)
+			}
+		})
+	}
+	setDefaults()
+}
+
+func TestValidateS3Timeout(t *testing.T) {
+	testCases := []struct {
+		name    string
+		backend string
+		value   string
+		timeout time.Duration
+		isError bool
+	}{
+		{"Default", "s3", defaultS3Timeout, 30 * time.Second, false},
+		{"Minutes", "s3", "2m", 2 * time.Minute, false},
+		{"Zero", "s3", "0s", 0, true},
+		{"Not set", "s3", "", 0, true},
+		{"Zero without S3", "local", "0s", 0, false},
+		{"Negative", "s3", "-1s", 0, true},
+		{"No unit", "local", "30", 0, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			Get.Backend = tc.backend
+			Get.S3Bucket = "bucket"
+			Get.S3TimeoutStr = tc.value
+			err := validate()
+			hasError := nil != err
+			if hasError && !tc.isError {
+				t.Errorf("Expected no error but got %v", err)
+			}
+			if !hasError && tc.isError {
+				t.Error("Expected an error but got no error")
+			}
+			if !tc.isError && tc.timeout != Get.S3Timeout {
+				t.Errorf("Expected timeout %v but got %v", tc.timeout, Get.S3Timeout)
+			}
+		})
+	}
+}
+
+func TestValidateShutdownTimeout(t *testing.T) {
+	testCases := []struct {
+		name    string
+		value   string
+		timeout time.Duration
+		isError bool
+	}{
+		{"Not set", "", 0, false},
+		{"Default", defaultShutdown, 25 * time.Second, false},
+		{"Minutes", "2m", 2 * time.Minute, false},
+		{"Zero", "0s", 0, false},
+		{"Negative", "-1s", 0, true},
+		{"No unit", "30", 0, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			Get.ShutdownStr = tc.value
+			err := validate()
+			hasError := nil != err
+			if hasError && !tc.isError {
+				t.Errorf("Expected no error but got %v", err)
+			}
+			if !hasError && tc.isError {
+				t.Error("Expected an error but got no error")
+			}
+			if !tc.isError && tc.timeout != Get.Shutdown {
+				t.Errorf("Expected timeout %v but got %v", tc.timeout, Get.Shutdown)
+			}
+		})
+	}
+	setDefaults()
+}
+
+func TestValidatePreload(t *testing.T) {
+	testCases := []struct {
+		name     string
+		preload  bool
+		inMemory bool
+		isError  bool
+	}{
+		{"Not preloaded", false, false, false},
+		{"Preloaded", true, false, false},
+		{"Preloaded in memory", true, true, false},
+		{"In memory only", false, true, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			Get.Preload = tc.preload
+			Get.PreloadMemory = tc.inMemory
+			err := validate()
+			hasError := nil != err
+			if hasError && !tc.isError {
+				t.Errorf("Expected no error but got %v", err)
+			}
+			if !hasError && tc.isError {
+				t.Error("Expected an error but got no error")
+			}
+		})
+	}
+	setDefaults()
+}
+
+func TestValidateBackend(t *testing.T) {
+	testCases := []struct {
+		name      string
+		backend   string
+		endpoint  string
+		bucket    string
+		accessKey string
+		secretKey string
+		isError   bool
+	}{
+		{"No backend", "", "", "", "", "", false},
+		{"Local backend", "local", "", "", "", "", false},
+		{"Archive backend", "archive", "", "", "", "", false},
+		{"Unknown backend", "floppy", "", "", "", "", true},
+		{"S3 backend", "s3", defaultS3Endpoint, "bucket", "", "", false},
+		{"S3 backend w/credentials", "s3", "http://localhost:9000", "bucket", "key", "secret", false},
+		{"S3 backend w/o bucket", "s3", defaultS3Endpoint, "", "", "", true},
+		{"S3 backend w/bad endpoint", "s3", "localhost:9000", "bucket", "", "", true},
+		{"S3 backend w/o secret key", "s3", defaultS3Endpoint, "bucket", "key", "", true},
+		{"S3 backend w/o access key", "s3", defaultS3Endpoint, "bucket", "", "secret", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			Get.Backend = tc.backend
+			Get.S3Endpoint = tc.endpoint
+			Get.S3Bucket = tc.bucket
+			Get.S3AccessKey = tc.accessKey
+			Get.S3SecretKey = tc.secretKey
+			err := validate()
+			hasError := nil != err
+			if hasError && !tc.isError {
+				t.Errorf("Expected no error but got %v", err)
+			}
+			if !hasError && tc.isError {
+				t.Error("Expected an error but got no error")
+			}
+		})
+	}
+}
+
+func TestErrorPagePath(t *testing.T) {
+	testCases := []struct {
+		name   string
+		folder string
+		file   string
+		result string
+	}{
+		{"Relative", "/web", "errors/404.html", "/web/errors/404.html"},
+		{"Absolute", "/web", "/etc/404.html", "/etc/404.html"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := ErrorPage{Code: 404, File: tc.file}.Path(tc.folder)
+			if tc.result != result {
+				t.Errorf(
+					"For %s in %s expected '%s' but got '%s'",
+					tc.file, tc.folder, tc.result, result,
+				)
+			}
+		})
+	}
+}
+
+func TestErrorPageLocate(t *testing.T) {
+	testCases := []struct {
+		name    string
+		folders []string
+		file    string
+		result  string
+	}{
+		{"First folder", []string{".", "/web"}, "config.go", "config.go"},
+		{"Later folder", []string{"/should/never/exist", "."}, "config.go", "config.go"},
+		{"Missing", []string{"/web", "."}, "missing.html", "/web/missing.html"},
+		{"Absolute", []string{"/web"}, "/etc/404.html", "/etc/404.html"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := ErrorPage{Code: 404, File: tc.file}.Locate(tc.folders)
+			if tc.result != result {
+				t.Errorf(
+					"For %s in %v expected '%s' but got '%s'",
+					tc.file, tc.folders, tc.result, result,
+				)
+			}
+		})
+	}
+}
+
+func TestFolders(t *testing.T) {
+	testCases := []struct {
+		name    string
+		folder  string
+		folders []string
+	}{
+		{"Single", "/web", []string{"/web"}},
+		{"List", "/team,/theme", []string{"/team", "/theme"}},
+		{"List w/spaces", " /team , /theme ,", []string{"/team", "/theme"}},
+		{"Empty", "", []string{""}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			Get.Folder = tc.folder
+			result := Folders()
+			if strings.Join(tc.folders, "|") != strings.Join(result, "|") {
+				t.Errorf("For '%s' expected %v but got %v", tc.folder, tc.folders, result)
+			}
+		})
+	}
+	Get.Folder = defaultFolder
+}
+
 func TestEnvAsStr(t *testing.T) {
 	sv := "STRING_VALUE"
 	fv := "FLOAT_VALUE"
@@ -348,6 +1060,48 @@ func TestEnvAsStrSlice(t *testing.T) {
 	}
 }
 
+func TestEnvAsErrorPages(t *testing.T) {
+	ov := "ONE_VALUE"
+	tv := "TWO_VALUE"
+	bcv := "BAD_CODE_VALUE"
+	mfv := "MISSING_FILE_VALUE"
+	uv := "UNSET_VALUE"
+
+	fbr := []ErrorPage{{Code: 500, File: "500.html"}}
+
+	os.Setenv(ov, "404=404.html")
+	os.Setenv(tv, "404=errors/404.html,403=/etc/403.html")
+	os.Setenv(bcv, "four=404.html")
+	os.Setenv(mfv, "404")
+
+	testCases := []struct {
+		name   string
+		key    string
+		result []ErrorPage
+	}{
+		{"One entry", ov, []ErrorPage{{Code: 404, File: "404.html"}}},
+		{"Two entries", tv, []ErrorPage{
+			{Code: 404, File: "errors/404.html"},
+			{Code: 403, File: "/etc/403.html"},
+		}},
+		{"Bad code", bcv, fbr},
+		{"Missing file", mfv, fbr},
+		{"Unset", uv, fbr},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := envAsErrorPages(tc.key, fbr)
+			if fmt.Sprint(tc.result) != fmt.Sprint(result) {
+				t.Errorf(
+					"For %s expected '%v' but got '%v'",
+					tc.key, tc.result, result,
+				)
+			}
+		})
+	}
+}
+
 func TestEnvAsUint16(t *testing.T) {
 	ubv := "UPPER_BOUNDS_VALUE"
 	lbv := "LOWER_BOUNDS_VALUE"
@@ -396,6 +1150,51 @@ func TestEnvAsUint16(t *testing.T) {
 	}
 }
 
+func TestEnvAsUint64(t *testing.T) {
+	ubv := "UPPER_BOUNDS_VALUE"
+	lbv := "LOWER_BOUNDS_VALUE"
+	hv := "HIGH_VALUE"
+	lv := "LOW_VALUE"
+	sv := "STRING_VALUE"
+	uv := "UNSET_VALUE"
+
+	fbr := uint64(666)                  // Fallback result
+	ubr := uint64(18446744073709551615) // Upper bounds result
+	lbr := uint64(0)                    // Lower bounds result
+
+	os.Setenv(ubv, "18446744073709551615")
+	os.Setenv(lbv, "0")
+	os.Setenv(hv, "18446744073709551616")
+	os.Setenv(lv, "-1")
+	os.Setenv(sv, "Cheese")
+
+	testCases := []struct {
+		name     string
+		key      string
+		fallback uint64
+		result   uint64
+	}{
+		{"Upper bounds", ubv, fbr, ubr},
+		{"Lower bounds", lbv, fbr, lbr},
+		{"Out-of-bounds high", hv, fbr, fbr},
+		{"Out-of-bounds low", lv, fbr, fbr},
+		{"String", sv, fbr, fbr},
+		{"Unset", uv, fbr, fbr},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := envAsUint64(tc.key, tc.fallback)
+			if tc.result != result {
+				t.Errorf(
+					"For %s with a %d fallback expected %d but got %d",
+					tc.key, tc.fallback, tc.result, result,
+				)
+			}
+		})
+	}
+}
+
 func TestEnvAsBool(t *testing.T) {
 	tv := "TRUE_VALUE"
 	fv := "FALSE_VALUE"
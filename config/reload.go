@@ -0,0 +1,119 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// secretSettings are the names of settings whose values are kept out of the
+// logs.
+var secretSettings = map[string]bool{
+	"access-key":    true,
+	"s3-access-key": true,
+	"s3-secret-key": true,
+}
+
+// loadedFile is the name of the configuration file that was loaded, if any.
+var loadedFile string
+
+// Change to a setting of the configuration.
+type Change struct {
+	// Setting is the name of the setting in configuration files.
+	Setting string
+	// Previous is the previous value of the setting, in YAML flow style.
+	Previous string
+	// Current is the current value of the setting, in YAML flow style.
+	Current string
+}
+
+// String returns the change as 'setting: previous -> current'.
+func (change Change) String() string {
+	return fmt.Sprintf("%s: %s -> %s", change.Setting, change.Previous, change.Current)
+}
+
+// File returns the name of the configuration file that was loaded or an empty
+// string if the configuration was only loaded from environment variables.
+func File() string {
+	return loadedFile
+}
+
+// Reload the configuration from the configuration file that was loaded and the
+// environment variables, then apply it. If the reloaded configuration isn't
+// valid, or applying it fails, the previous configuration is restored. The
+// settings that changed are returned.
+func Reload(apply func() error) (changes []Change, err error) {
+	previous := Get
+	setDefaults()
+	if err = Load(loadedFile); nil == err {
+		err = apply()
+	}
+	if nil != err {
+		Get = previous
+		return nil, err
+	}
+	return diff(previous, Get), nil
+}
+
+// diff returns the settings of the current configuration that differ from the
+// previous configuration.
+func diff(previous, current interface{}) (changes []Change) {
+	before, after := reflect.ValueOf(previous), reflect.ValueOf(current)
+	for index := 0; index < before.NumField(); index++ {
+		setting := strings.Split(before.Type().Field(index).Tag.Get("yaml"), ",")[0]
+		if setting == "-" {
+			continue
+		}
+		change := Change{
+			Setting:  setting,
+			Previous: flowValue(setting, before.Field(index).Interface()),
+			Current:  flowValue(setting, after.Field(index).Interface()),
+		}
+		if change.Previous != change.Current {
+			changes = append(changes, change)
+		}
+	}
+	return
+}
+
+// flowValue returns the value of the setting in YAML flow style, with the
+// values of secret settings masked.
+func flowValue(setting string, value interface{}) string {
+	var node yaml.Node
+	if err := node.Encode(value); nil != err {
+		return fmt.Sprint(value)
+	}
+	if secretSettings[setting] {
+		maskSecret(&node)
+	}
+	maskSecrets(&node)
+	node.Style = yaml.FlowStyle
+
+	// YAML marshalling should never error, as the node was encoded.
+	contents, _ := yaml.Marshal(&node)
+	return strings.TrimSpace(string(contents))
+}
+
+// maskSecrets masks the values of secret settings within the node, such as the
+// access keys of mounts.
+func maskSecrets(node *yaml.Node) {
+	if node.Kind == yaml.MappingNode {
+		for index := 0; index+1 < len(node.Content); index += 2 {
+			if secretSettings[node.Content[index].Value] {
+				maskSecret(node.Content[index+1])
+			}
+		}
+	}
+	for _, child := range node.Content {
+		maskSecrets(child)
+	}
+}
+
+// maskSecret masks the value of the node, if it is set.
+func maskSecret(node *yaml.Node) {
+	if node.Kind == yaml.ScalarNode && 0 < len(node.Value) {
+		node.SetString("********")
+	}
+}
@@ -0,0 +1,120 @@
+package config
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReload(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.yml")
+	write := func(contents string) {
+		if err := ioutil.WriteFile(filename, []byte(contents), 0600); nil != err {
+			t.Fatalf("While writing configuration file got %v", err)
+		}
+	}
+	defer setDefaults()
+
+	// Variables set by other tests would override the configuration file.
+	for _, key := range []string{tlsCertKey, tlsKeyKey, folderKey, portKey} {
+		t.Setenv(key, "")
+	}
+
+	write("referrers: [https://a.example.com]\nmime-types: {.ts: video/mp2t}\n")
+	setDefaults()
+	if err := Load(filename); nil != err {
+		t.Fatalf("While loading expected no error but got %v", err)
+	}
+	if filename != File() {
+		t.Errorf("While loading expected file %s but got %s", filename, File())
+	}
+
+	// The changed settings are returned after the configuration is applied.
+	write("referrers: [https://b.example.com]\naccess-key: secret\n")
+	applied := false
+	changes, err := Reload(func() error {
+		applied = true
+		return nil
+	})
+	if nil != err || !applied {
+		t.Fatalf("While reloading expected no error and to apply but got %v and %t", err, applied)
+	}
+	expected := []Change{
+		{"referrers", "['https://a.example.com']", "['https://b.example.com']"},
+		{"access-key", `""`, "'********'"},
+		{"mime-types", "{.ts: video/mp2t}", "{}"},
+	}
+	if !reflect.DeepEqual(expected, changes) {
+		t.Errorf("While reloading expected changes %v but got %v", expected, changes)
+	}
+
+	// Invalid configurations aren't applied and the previous configuration is
+	// kept.
+	write("referrers: [https://c.example.com]\npreload-memory: true\n")
+	changes, err = Reload(func() error {
+		t.Error("While reloading an invalid configuration expected not to apply")
+		return nil
+	})
+	if nil == err || nil != changes {
+		t.Errorf("While reloading an invalid configuration expected an error but got %v and %v", err, changes)
+	}
+	if "https://b.example.com" != Get.Referrers[0] || "secret" != Get.AccessKey {
+		t.Errorf("While reloading an invalid configuration expected the previous configuration but got %v", Get.Referrers)
+	}
+
+	// Configurations that fail to apply are restored.
+	write("referrers: [https://d.example.com]\n")
+	applyError := errors.New("apply")
+	if _, err = Reload(func() error { return applyError }); applyError != err {
+		t.Errorf("While reloading expected %v but got %v", applyError, err)
+	}
+	if "https://b.example.com" != Get.Referrers[0] {
+		t.Errorf("While failing to apply expected the previous configuration but got %v", Get.Referrers)
+	}
+}
+
+func TestDiffSecrets(t *testing.T) {
+	setDefaults()
+	defer setDefaults()
+	previous := Get
+	Get.S3SecretKey = "secret"
+	Get.Mounts = []Mount{{URLPrefix: "/private", Folder: "/srv", AccessKey: "secret"}}
+
+	expected := []Change{
+		{"s3-secret-key", `""`, "'********'"},
+		{"mounts", "[]", "[{url-prefix: /private, folder: /srv, access-key: '********'}]"},
+	}
+	if changes := diff(previous, Get); !reflect.DeepEqual(expected, changes) {
+		t.Errorf("Expected changes %v but got %v", expected, changes)
+	}
+}
+
+func TestValidateReloadInterval(t *testing.T) {
+	testCases := []struct {
+		name    string
+		value   string
+		isError bool
+	}{
+		{"Disabled", defaultReloadIntvl, false},
+		{"Seconds", "5s", false},
+		{"Negative", "-5s", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			Get.ReloadStr = tc.value
+			err := validate()
+			hasError := nil != err
+			if hasError && !tc.isError {
+				t.Errorf("Expected no error but got %v", err)
+			}
+			if !hasError && tc.isError {
+				t.Error("Expected an error but got no error")
+			}
+		})
+	}
+	setDefaults()
+}
@@ -0,0 +1,60 @@
+package handle
+
+import (
+	"io/fs"
+	"net/http"
+	"strings"
+
+	"github.com/halverneus/static-file-server/storage"
+)
+
+// WithArchives returns a function that serves the contents of zip and tar
+// archives as directories. If a segment of the requested name is an archive
+// file within the file system of the archives (e.g. 'docs.zip' in
+// '/docs.zip/index.html') then the remainder of the name is served from within
+// the archive with the function returned by serveArchive for the file system of
+// the archive (e.g. ServeFS, or ServeFS wrapped by WithListing to list its
+// directories as other directories are listed). Requests for the archive file
+// itself, without a trailing slash, and all other requests are passed to the
+// wrapped function.
+func WithArchives(
+	serveFile FileServerFunc,
+	fsys fs.FS,
+	archives *storage.Archives,
+	serveArchive func(fs.FS) FileServerFunc,
+) FileServerFunc {
+	return func(w http.ResponseWriter, r *http.Request, name string) {
+		if strings.Contains(r.URL.Path, "..") {
+			serveFile(w, r, name)
+			return
+		}
+		filename, inner, ok := splitArchive(fsys, name)
+		if !ok {
+			serveFile(w, r, name)
+			return
+		}
+
+		fsys, err := archives.Open(filename)
+		if nil != err {
+			http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		serveArchive(fsys)(w, r, inner)
+	}
+}
+
+// splitArchive splits the name into the name of an archive within the file
+// system and the name of a file within the archive. If the name doesn't contain
+// an archive followed by a slash then false is returned.
+func splitArchive(fsys fs.FS, name string) (archive, inner string, ok bool) {
+	for index := 0; index < len(name); index++ {
+		if name[index] != '/' || !storage.IsArchive(name[:index]) {
+			continue
+		}
+		archive = fsName(name[:index])
+		if stat, err := fs.Stat(fsys, archive); nil == err && stat.Mode().IsRegular() {
+			return archive, name[index:], true
+		}
+	}
+	return "", "", false
+}
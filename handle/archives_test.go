@@ -0,0 +1,106 @@
+package handle
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/halverneus/static-file-server/storage"
+)
+
+func TestWithArchives(t *testing.T) {
+	archiveName := "docs.zip"
+	filename := baseDir + archiveName
+	file, err := os.Create(filename)
+	if nil != err {
+		t.Fatalf("While creating archive got %v", err)
+	}
+	defer os.Remove(filename)
+	archive := zip.NewWriter(file)
+	for name, contents := range map[string]string{
+		tmpIndexName:   tmpIndex,
+		tmpSubFileName: tmpSubFile,
+		tmpNoIndexName: tmpSubDeepFile,
+	} {
+		writer, _ := archive.Create(name)
+		writer.Write([]byte(contents))
+	}
+	archive.Close()
+	file.Close()
+	raw, _ := ioutil.ReadFile(filename)
+
+	testCases := []struct {
+		name     string
+		path     string
+		rng      string
+		code     int
+		contents string
+	}{
+		{"Archive root", archiveName + "/", "", ok, tmpIndex},
+		{"Archive index", archiveName + "/" + tmpIndexName, "", redirect, nothing},
+		{"Archive file", archiveName + "/" + tmpSubFileName, "", ok, tmpSubFile},
+		{"Archive file range", archiveName + "/" + tmpSubFileName, "bytes=0-3", http.StatusPartialContent, tmpSubFile[:4]},
+		{"Archive listing", archiveName + "/" + tmpNoIndexDir, "", ok, listingRow},
+		{"Archive bad file", archiveName + "/" + tmpBadName, "", missing, notFound},
+		{"Archive itself", archiveName, "", ok, string(raw)},
+		{"Not an archive", tmpFileName, "", ok, tmpFile},
+		{"Missing archive", "missing.zip/" + tmpFileName, "", missing, notFound},
+	}
+
+	handler := Basic(WithArchives(serveLocal, localFS, storage.NewArchives(localFS), ServeFS))
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fullpath := "http://localhost/" + tc.path
+			req := httptest.NewRequest("GET", fullpath, nil)
+			if tc.rng != "" {
+				req.Header.Set("Range", tc.rng)
+			}
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			resp := w.Result()
+			body, err := ioutil.ReadAll(resp.Body)
+			if nil != err {
+				t.Errorf("While reading body got %v", err)
+			}
+			contents := string(body)
+			if tc.contents == listingRow && strings.Contains(contents, listingRow) {
+				contents = listingRow
+			}
+			if tc.code != resp.StatusCode {
+				t.Errorf(
+					"While retrieving %s expected status code of %d but got %d",
+					fullpath, tc.code, resp.StatusCode,
+				)
+			}
+			if tc.contents != contents {
+				t.Errorf(
+					"While retrieving %s expected contents '%s' but got '%s'",
+					fullpath, tc.contents, contents,
+				)
+			}
+		})
+	}
+}
+
+func TestWithArchivesBadArchive(t *testing.T) {
+	filename := baseDir + "bad.zip"
+	if err := ioutil.WriteFile(filename, []byte("not a zip"), 0600); nil != err {
+		t.Fatalf("While writing archive got %v", err)
+	}
+	defer os.Remove(filename)
+
+	handler := Basic(WithArchives(serveLocal, localFS, storage.NewArchives(localFS), ServeFS))
+	req := httptest.NewRequest("GET", "http://localhost/bad.zip/index.html", nil)
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	if code := w.Result().StatusCode; http.StatusInternalServerError != code {
+		t.Errorf("Expected status code of %d but got %d", http.StatusInternalServerError, code)
+	}
+}
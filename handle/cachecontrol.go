@@ -0,0 +1,43 @@
+package handle
+
+import (
+	"net/http"
+)
+
+// WithCacheControl returns a function that sets the 'Cache-Control' header of
+// successful and redirect responses to the value, unless the header was already
+// set (e.g. by a '_headers' file). Error responses are left without the header
+// so that they aren't cached along with the files.
+func WithCacheControl(serve http.HandlerFunc, value string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		serve(&cacheControlWriter{ResponseWriter: w, value: value}, r)
+	}
+}
+
+// cacheControlWriter sets the 'Cache-Control' header when the status code is
+// written.
+type cacheControlWriter struct {
+	http.ResponseWriter
+	value       string
+	wroteHeader bool
+}
+
+// WriteHeader sets the 'Cache-Control' header, unless the status code is an
+// error or the header is set, and sends the status code.
+func (cw *cacheControlWriter) WriteHeader(code int) {
+	if !cw.wroteHeader {
+		cw.wroteHeader = true
+		if code < http.StatusBadRequest && "" == cw.Header().Get("Cache-Control") {
+			cw.Header().Set("Cache-Control", cw.value)
+		}
+	}
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+// Write the body, sending 'OK' if the status code hasn't been written.
+func (cw *cacheControlWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	return cw.ResponseWriter.Write(b)
+}
@@ -0,0 +1,54 @@
+package handle
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWithCacheControl(t *testing.T) {
+	value := "public, max-age=3600"
+	handler := WithCacheControl(Basic(serveLocal), value)
+	custom := WithCacheControl(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		Basic(serveLocal)(w, r)
+	}, value)
+
+	testCases := []struct {
+		name    string
+		handler http.HandlerFunc
+		path    string
+		code    int
+		value   string
+	}{
+		{"Good file", handler, tmpFileName, ok, value},
+		{"Good dir", handler, subDir, ok, value},
+		{"Redirect", handler, tmpIndexName, redirect, value},
+		{"Bad file", handler, tmpBadName, missing, ""},
+		{"Already set", custom, tmpFileName, ok, "no-store"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fullpath := "http://localhost/" + tc.path
+			req := httptest.NewRequest("GET", fullpath, nil)
+			w := httptest.NewRecorder()
+
+			tc.handler(w, req)
+
+			resp := w.Result()
+			if tc.code != resp.StatusCode {
+				t.Errorf(
+					"While retrieving %s expected status code of %d but got %d",
+					fullpath, tc.code, resp.StatusCode,
+				)
+			}
+			if cacheControl := resp.Header.Get("Cache-Control"); tc.value != cacheControl {
+				t.Errorf(
+					"While retrieving %s expected Cache-Control '%s' but got '%s'",
+					fullpath, tc.value, cacheControl,
+				)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package handle
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// TrailingSlash is how trailing slashes of the URL paths of directories and
+// clean pages are normalized.
+type TrailingSlash int
+
+const (
+	// KeepTrailingSlash leaves URL paths as requested.
+	KeepTrailingSlash TrailingSlash = iota
+	// AddTrailingSlash redirects URL paths without a trailing slash.
+	AddTrailingSlash
+	// RemoveTrailingSlash redirects URL paths with a trailing slash.
+	RemoveTrailingSlash
+)
+
+// WithCleanURLs returns a function that normalizes the URL paths of pages and
+// directories of the file system served at the URL path prefix. If clean is
+// set, paths without an extension are served from the '.html' file of the same
+// name and paths of '.html' files are redirected to the path without the
+// extension. Directories and clean pages are redirected to add or remove the
+// trailing slash. Requests are passed on with the path of the file or, for
+// directories, the path with a trailing slash, so that listings are prevented
+// or ignored as they would be for the directory.
+func WithCleanURLs(
+	serve http.HandlerFunc, fsys fs.FS, urlPrefix string, clean bool, slash TrailingSlash,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, urlPrefix+"/") {
+			serve(w, r)
+			return
+		}
+		name := fsName(strings.TrimPrefix(r.URL.Path, urlPrefix))
+		if name == "." {
+			serve(w, r)
+			return
+		}
+		hasSlash := strings.HasSuffix(r.URL.Path, "/")
+		base := urlPrefix + "/" + name
+
+		var target string
+		stat, err := fs.Stat(fsys, name)
+		switch {
+		case nil == err && stat.IsDir():
+			if slash == KeepTrailingSlash {
+				serve(w, r)
+				return
+			}
+			target = base + "/"
+		case nil == err:
+			// Redirect to the clean path, unless it names another file or
+			// directory. Index files are served as named, or redirected to
+			// their directory by the file server.
+			if clean && !hasSlash && strings.HasSuffix(name, ".html") && !isIndexFile(path.Base(name)) {
+				page := strings.TrimSuffix(base, ".html")
+				if _, err := fs.Stat(fsys, strings.TrimSuffix(name, ".html")); errors.Is(err, fs.ErrNotExist) {
+					if slash == AddTrailingSlash {
+						page += "/"
+					}
+					redirectPath(w, r, page)
+					return
+				}
+			}
+			serve(w, r)
+			return
+		case clean && !strings.HasSuffix(name, ".html"):
+			stat, err := fs.Stat(fsys, name+".html")
+			if nil != err || stat.IsDir() {
+				serve(w, r)
+				return
+			}
+			target = base + ".html"
+		default:
+			serve(w, r)
+			return
+		}
+
+		switch {
+		case slash == AddTrailingSlash && !hasSlash:
+			redirectPath(w, r, base+"/")
+			return
+		case slash == RemoveTrailingSlash && hasSlash:
+			redirectPath(w, r, base)
+			return
+		}
+
+		rewritten := new(http.Request)
+		*rewritten = *r
+		rewritten.URL = new(url.URL)
+		*rewritten.URL = *r.URL
+		rewritten.URL.Path, rewritten.URL.RawPath = target, ""
+		serve(w, rewritten)
+	}
+}
+
+// redirectPath permanently redirects the request to the URL path, keeping the
+// query of the request.
+func redirectPath(w http.ResponseWriter, r *http.Request, urlPath string) {
+	location := &url.URL{Path: urlPath, RawQuery: r.URL.RawQuery}
+	http.Redirect(w, r, location.String(), http.StatusMovedPermanently)
+}
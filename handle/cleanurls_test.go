@@ -0,0 +1,96 @@
+package handle
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+func TestWithCleanURLs(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html":      {Data: []byte("home")},
+		"about.html":      {Data: []byte("about")},
+		"docs/index.html": {Data: []byte("docs")},
+		"docs/guide.html": {Data: []byte("guide")},
+		"blog.html":       {Data: []byte("blog page")},
+		"blog/index.html": {Data: []byte("blog dir")},
+		"files/notes.txt": {Data: []byte("notes")},
+		"style.css":       {Data: []byte("style")},
+	}
+	serve := func(prefix string) http.HandlerFunc {
+		if prefix == "" {
+			return PreventListings(Basic(ServeFS(fsys)), fsys, prefix)
+		}
+		return PreventListings(Prefix(ServeFS(fsys), prefix), fsys, prefix)
+	}
+
+	testCases := []struct {
+		name     string
+		clean    bool
+		slash    TrailingSlash
+		prefix   string
+		path     string
+		code     int
+		location string
+		contents string
+	}{
+		{"Keep page", false, KeepTrailingSlash, "", "/about.html", ok, "", "about"},
+		{"Keep no extension", false, KeepTrailingSlash, "", "/about", missing, "", ""},
+		{"Keep dir", false, KeepTrailingSlash, "", "/docs", redirect, "docs/", ""},
+		{"Clean page", true, KeepTrailingSlash, "", "/about", ok, "", "about"},
+		{"Clean page w/slash", true, KeepTrailingSlash, "", "/about/", ok, "", "about"},
+		{"Clean redirect", true, KeepTrailingSlash, "", "/about.html?a=1", redirect, "/about?a=1", ""},
+		{"Clean nested", true, KeepTrailingSlash, "", "/docs/guide", ok, "", "guide"},
+		{"Clean index", true, KeepTrailingSlash, "", "/docs/index.html", redirect, "./", ""},
+		{"Clean dir wins", true, KeepTrailingSlash, "", "/blog/", ok, "", "blog dir"},
+		{"Clean dir w/o slash", true, KeepTrailingSlash, "", "/blog", redirect, "blog/", ""},
+		{"Clean ambiguous page", true, KeepTrailingSlash, "", "/blog.html", ok, "", "blog page"},
+		{"Clean other file", true, KeepTrailingSlash, "", "/style.css", ok, "", "style"},
+		{"Clean missing", true, KeepTrailingSlash, "", "/missing", missing, "", ""},
+		{"Clean root", true, RemoveTrailingSlash, "", "/", ok, "", "home"},
+		{"Add page", true, AddTrailingSlash, "", "/about", redirect, "/about/", ""},
+		{"Add page w/slash", true, AddTrailingSlash, "", "/about/", ok, "", "about"},
+		{"Add redirect", true, AddTrailingSlash, "", "/about.html", redirect, "/about/", ""},
+		{"Add dir", false, AddTrailingSlash, "", "/docs?a=1", redirect, "/docs/?a=1", ""},
+		{"Add file", false, AddTrailingSlash, "", "/style.css", ok, "", "style"},
+		{"Remove page", true, RemoveTrailingSlash, "", "/about/", redirect, "/about", ""},
+		{"Remove dir", false, RemoveTrailingSlash, "", "/docs/", redirect, "/docs", ""},
+		{"Remove dir w/o slash", false, RemoveTrailingSlash, "", "/docs", ok, "", "docs"},
+		{"Remove dir w/o index", false, RemoveTrailingSlash, "", "/files", missing, "", ""},
+		{"Prefix clean page", true, RemoveTrailingSlash, "/my/prefix", "/my/prefix/about", ok, "", "about"},
+		{"Prefix redirect", true, RemoveTrailingSlash, "/my/prefix", "/my/prefix/docs/guide.html", redirect, "/my/prefix/docs/guide", ""},
+		{"Prefix dir", true, RemoveTrailingSlash, "/my/prefix", "/my/prefix/docs", ok, "", "docs"},
+		{"Outside prefix", true, RemoveTrailingSlash, "/my/prefix", "/about", missing, "", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := WithCleanURLs(serve(tc.prefix), fsys, tc.prefix, tc.clean, tc.slash)
+			fullpath := "http://localhost" + tc.path
+			req := httptest.NewRequest("GET", fullpath, nil)
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			if tc.code != w.Code {
+				t.Errorf(
+					"While retrieving %s expected status code of %d but got %d",
+					fullpath, tc.code, w.Code,
+				)
+			}
+			if location := w.Header().Get("Location"); tc.location != location {
+				t.Errorf(
+					"While retrieving %s expected location '%s' but got '%s'",
+					fullpath, tc.location, location,
+				)
+			}
+			if tc.code == ok && tc.contents != w.Body.String() {
+				t.Errorf(
+					"While retrieving %s expected contents '%s' but got '%s'",
+					fullpath, tc.contents, w.Body.String(),
+				)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package handle
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Digests are the SHA-256 and MD5 digests of the files of a file system. The
+// digests of a file are computed when first needed and computed again when the
+// modification time or size of the file changes.
+type Digests struct {
+	fsys  fs.FS
+	mutex sync.Mutex
+	files map[string]fileDigest
+}
+
+// fileDigest is the digests of a version of a file.
+type fileDigest struct {
+	modTime time.Time
+	size    int64
+	sha256  []byte
+	md5     []byte
+}
+
+// NewDigests returns the digests of the files in the file system.
+func NewDigests(fsys fs.FS) *Digests {
+	return &Digests{fsys: fsys, files: map[string]fileDigest{}}
+}
+
+// digest returns the digests of the named regular file.
+func (digests *Digests) digest(name string) (fileDigest, error) {
+	stat, err := fs.Stat(digests.fsys, name)
+	if nil != err {
+		return fileDigest{}, err
+	}
+	if !stat.Mode().IsRegular() {
+		return fileDigest{}, fmt.Errorf("%s is not a file", name)
+	}
+
+	digests.mutex.Lock()
+	digest, ok := digests.files[name]
+	digests.mutex.Unlock()
+	if ok && digest.modTime.Equal(stat.ModTime()) && digest.size == stat.Size() {
+		return digest, nil
+	}
+
+	// The file is read without holding the lock so that other files aren't
+	// kept waiting.
+	file, err := digests.fsys.Open(name)
+	if nil != err {
+		return fileDigest{}, err
+	}
+	defer file.Close()
+	sha256Hash, md5Hash := sha256.New(), md5.New()
+	if _, err := io.Copy(io.MultiWriter(sha256Hash, md5Hash), file); nil != err {
+		return fileDigest{}, err
+	}
+	digest = fileDigest{
+		modTime: stat.ModTime(),
+		size:    stat.Size(),
+		sha256:  sha256Hash.Sum(nil),
+		md5:     md5Hash.Sum(nil),
+	}
+
+	digests.mutex.Lock()
+	digests.files[name] = digest
+	digests.mutex.Unlock()
+	return digest, nil
+}
+
+// sidecarDigests are the extensions of checksum sidecar files and the digests
+// they contain.
+var sidecarDigests = map[string]func(fileDigest) []byte{
+	".sha256": func(digest fileDigest) []byte { return digest.sha256 },
+	".md5":    func(digest fileDigest) []byte { return digest.md5 },
+}
+
+// WithDigests returns a function that sets the 'Repr-Digest' (RFC 9530) and
+// 'Digest' (RFC 3230) headers of files to their SHA-256 digest. Requests for
+// a '.sha256' or '.md5' file that doesn't exist, where the file without the
+// extension does, are served a checksum sidecar in the format of 'sha256sum'
+// and 'md5sum' (e.g. '<hex digest>  file.tar.gz').
+func WithDigests(serveFile FileServerFunc, digests *Digests) FileServerFunc {
+	return func(w http.ResponseWriter, r *http.Request, name string) {
+		if strings.HasSuffix(name, "/") {
+			serveFile(w, r, name)
+			return
+		}
+		filename := fsName(name)
+
+		ext := path.Ext(filename)
+		if sum, ok := sidecarDigests[ext]; ok {
+			if _, err := fs.Stat(digests.fsys, filename); errors.Is(err, fs.ErrNotExist) {
+				original := strings.TrimSuffix(filename, ext)
+				if digest, err := digests.digest(original); nil == err {
+					sidecar := fmt.Sprintf("%s  %s\n", hex.EncodeToString(sum(digest)), path.Base(original))
+					w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+					http.ServeContent(w, r, path.Base(filename), digest.modTime, strings.NewReader(sidecar))
+					return
+				}
+			}
+		}
+
+		if digest, err := digests.digest(filename); nil == err {
+			encoded := base64.StdEncoding.EncodeToString(digest.sha256)
+			w.Header().Set("Repr-Digest", "sha-256=:"+encoded+":")
+			w.Header().Set("Digest", "SHA-256="+encoded)
+		}
+		serveFile(w, r, name)
+	}
+}
@@ -0,0 +1,99 @@
+package handle
+
+import (
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestWithDigests(t *testing.T) {
+	fsys := fstest.MapFS{
+		"hello.txt":        {Data: []byte("hello")},
+		"real.txt":         {Data: []byte("real")},
+		"real.txt.sha256":  {Data: []byte("provided")},
+		"dir/archive.tgz":  {Data: []byte("")},
+		"dir/sub/file.txt": {Data: []byte("file")},
+	}
+	handler := Basic(WithDigests(ServeFS(fsys), NewDigests(fsys)))
+
+	helloSHA256 := "LPJNul+wow4m6DsqxbninhsWHlwfp0JecwQzYpOLmCQ="
+	testCases := []struct {
+		name       string
+		path       string
+		code       int
+		reprDigest string
+		digest     string
+		contents   string
+	}{
+		{"File", "/hello.txt", ok, "sha-256=:" + helloSHA256 + ":", "SHA-256=" + helloSHA256, "hello"},
+		{"Empty file", "/dir/archive.tgz", ok, "sha-256=:47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=:", "SHA-256=47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=", ""},
+		{"SHA-256 sidecar", "/hello.txt.sha256", ok, "", "", "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824  hello.txt\n"},
+		{"MD5 sidecar", "/hello.txt.md5", ok, "", "", "5d41402abc4b2a76b9719d911017c592  hello.txt\n"},
+		{"Existing sidecar", "/real.txt.sha256", ok, "sha-256=:2nJBlG0usGYHJQLTmXbds8BijywSUJXSzeF+AqE2Uwk=:", "SHA-256=2nJBlG0usGYHJQLTmXbds8BijywSUJXSzeF+AqE2Uwk=", "provided"},
+		{"Sidecar of missing file", "/missing.txt.sha256", missing, "", "", notFound},
+		{"Sidecar of directory", "/dir.sha256", missing, "", "", notFound},
+		{"Directory", "/dir/sub/", ok, "", "", ""},
+		{"Missing", "/missing.txt", missing, "", "", notFound},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fullpath := "http://localhost" + tc.path
+			req := httptest.NewRequest("GET", fullpath, nil)
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			if tc.code != w.Code {
+				t.Errorf(
+					"While retrieving %s expected status code of %d but got %d",
+					fullpath, tc.code, w.Code,
+				)
+			}
+			if result := w.Header().Get("Repr-Digest"); tc.reprDigest != result {
+				t.Errorf(
+					"While retrieving %s expected Repr-Digest '%s' but got '%s'",
+					fullpath, tc.reprDigest, result,
+				)
+			}
+			if result := w.Header().Get("Digest"); tc.digest != result {
+				t.Errorf(
+					"While retrieving %s expected Digest '%s' but got '%s'",
+					fullpath, tc.digest, result,
+				)
+			}
+			if tc.contents != "" && tc.contents != w.Body.String() {
+				t.Errorf(
+					"While retrieving %s expected contents '%s' but got '%s'",
+					fullpath, tc.contents, w.Body.String(),
+				)
+			}
+		})
+	}
+}
+
+func TestDigestsChanged(t *testing.T) {
+	fsys := fstest.MapFS{
+		"file.txt": {Data: []byte("hello")},
+	}
+	digests := NewDigests(fsys)
+	sha256 := func() string {
+		digest, err := digests.digest("file.txt")
+		if nil != err {
+			t.Fatalf("Expected no error but got %v", err)
+		}
+		return string(digest.sha256)
+	}
+
+	first := sha256()
+	fsys["file.txt"].Data = []byte("world")
+	if result := sha256(); first != result {
+		t.Error("Expected cached digest of unchanged file")
+	}
+
+	fsys["file.txt"] = &fstest.MapFile{Data: []byte("world"), ModTime: time.Now()}
+	if result := sha256(); first == result {
+		t.Error("Expected new digest of changed file")
+	}
+}
@@ -0,0 +1,208 @@
+package handle
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+var (
+	// errArchiveLimits is returned when a directory exceeds the limits of
+	// archives.
+	errArchiveLimits = errors.New("directory exceeds the limits of archives")
+
+	// archiveContentTypes maps the supported archive formats to their content
+	// types.
+	archiveContentTypes = map[string]string{
+		"zip":    "application/zip",
+		"tar.gz": "application/gzip",
+	}
+)
+
+// ArchiveLimits restrict the size of directory archives. A value of zero is
+// unlimited.
+type ArchiveLimits struct {
+	// MaxBytes is the maximum combined size of the files in the archive before
+	// compression.
+	MaxBytes uint64
+	// MaxFiles is the maximum number of files in the archive.
+	MaxFiles uint64
+}
+
+// archiveFile is a file found while scanning a directory to be archived.
+type archiveFile struct {
+	source string
+	name   string
+	info   fs.FileInfo
+}
+
+// WithDirectoryArchives returns a function that streams the contents of a
+// requested directory as a zip or gzipped tar archive when the 'download'
+// query parameter is set to 'zip' or 'tar.gz', respectively. Entries are placed
+// within a directory named after the requested directory. Symbolic links to
+// files are followed while symbolic links to directories are skipped to avoid
+// loops. If the directory exceeds the limits then 'FORBIDDEN' is returned, while
+// other errors scanning the directory are logged and return 'INTERNAL SERVER
+// ERROR'. All other requests are passed to the wrapped function.
+func WithDirectoryArchives(serveFile FileServerFunc, fsys fs.FS, limits ArchiveLimits) FileServerFunc {
+	return func(w http.ResponseWriter, r *http.Request, name string) {
+		format := r.URL.Query().Get("download")
+		contentType, ok := archiveContentTypes[format]
+		if !ok {
+			serveFile(w, r, name)
+			return
+		}
+		dirname := fsName(name)
+		if stat, err := fs.Stat(fsys, dirname); nil != err || !stat.IsDir() {
+			serveFile(w, r, name)
+			return
+		}
+
+		root := path.Base(dirname)
+		if root == "." {
+			root = "archive"
+		}
+		files, err := scanArchive(fsys, dirname, root, limits)
+		if errors.Is(err, errArchiveLimits) {
+			http.Error(w, errArchiveLimits.Error(), http.StatusForbidden)
+			return
+		}
+		if nil != err {
+			log.Printf("Failed to scan %s for an archive: %v\n", dirname, err)
+			http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", mime.FormatMediaType(
+			"attachment", map[string]string{"filename": root + "." + format},
+		))
+		if r.Method == http.MethodHead {
+			return
+		}
+
+		if format == "zip" {
+			err = writeZip(w, fsys, files)
+		} else {
+			err = writeTarGz(w, fsys, files)
+		}
+		if nil != err {
+			// The response has already started, so the only way to tell the
+			// client the archive is incomplete is to abort the connection.
+			panic(http.ErrAbortHandler)
+		}
+	}
+}
+
+// scanArchive walks the directory and returns the files to be placed in the
+// archive, in order, with names relative to root. If the limits are exceeded,
+// errArchiveLimits is returned.
+func scanArchive(fsys fs.FS, dirname, root string, limits ArchiveLimits) (files []archiveFile, err error) {
+	var size, count uint64
+	err = fs.WalkDir(fsys, dirname, func(source string, entry fs.DirEntry, err error) error {
+		if nil != err {
+			return err
+		}
+		name := path.Join(root, strings.TrimPrefix(strings.TrimPrefix(source, dirname), "/"))
+		if dirname == "." {
+			name = path.Join(root, source)
+		}
+
+		var info fs.FileInfo
+		if entry.Type()&fs.ModeSymlink != 0 {
+			if info, err = fs.Stat(fsys, source); nil != err || info.IsDir() {
+				return nil
+			}
+		} else if info, err = entry.Info(); nil != err {
+			return err
+		}
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			return nil
+		}
+		if info.Mode().IsRegular() {
+			count++
+			size += uint64(info.Size())
+			if (0 < limits.MaxFiles && count > limits.MaxFiles) ||
+				(0 < limits.MaxBytes && size > limits.MaxBytes) {
+				return errArchiveLimits
+			}
+		}
+		files = append(files, archiveFile{source: source, name: name, info: info})
+		return nil
+	})
+	return
+}
+
+// writeZip streams the files to w as a zip archive.
+func writeZip(w io.Writer, fsys fs.FS, files []archiveFile) error {
+	archive := zip.NewWriter(w)
+	for _, file := range files {
+		header, err := zip.FileInfoHeader(file.info)
+		if nil != err {
+			return err
+		}
+		header.Name = file.name
+		if file.info.IsDir() {
+			header.Name += "/"
+		} else {
+			header.Method = zip.Deflate
+		}
+		writer, err := archive.CreateHeader(header)
+		if nil != err {
+			return err
+		}
+		if err = copyArchiveFile(writer, fsys, file); nil != err {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// writeTarGz streams the files to w as a gzipped tar archive.
+func writeTarGz(w io.Writer, fsys fs.FS, files []archiveFile) error {
+	compressor := gzip.NewWriter(w)
+	archive := tar.NewWriter(compressor)
+	for _, file := range files {
+		header, err := tar.FileInfoHeader(file.info, "")
+		if nil != err {
+			return err
+		}
+		header.Name = file.name
+		if file.info.IsDir() {
+			header.Name += "/"
+		}
+		if err = archive.WriteHeader(header); nil != err {
+			return err
+		}
+		if err = copyArchiveFile(archive, fsys, file); nil != err {
+			return err
+		}
+	}
+	if err := archive.Close(); nil != err {
+		return err
+	}
+	return compressor.Close()
+}
+
+// copyArchiveFile copies the contents of the file, limited to the size found
+// while scanning, into the archive.
+func copyArchiveFile(w io.Writer, fsys fs.FS, file archiveFile) error {
+	if !file.info.Mode().IsRegular() {
+		return nil
+	}
+	reader, err := fsys.Open(file.source)
+	if nil != err {
+		return err
+	}
+	defer reader.Close()
+	_, err = io.CopyN(w, reader, file.info.Size())
+	return err
+}
@@ -0,0 +1,197 @@
+package handle
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestWithDirectoryArchives(t *testing.T) {
+	forbidden := http.StatusForbidden
+	unlimited := ArchiveLimits{}
+	expected := "listing/:,listing/a.txt:aaa,listing/b.txt:b,listing/c/:,listing/c/c.txt:cc,"
+
+	testCases := []struct {
+		name        string
+		path        string
+		limits      ArchiveLimits
+		code        int
+		contentType string
+		contents    string
+	}{
+		{"Zip", tmpListingDir + "?download=zip", unlimited, ok, "application/zip", expected},
+		{"Tar", tmpListingDir + "?download=tar.gz", unlimited, ok, "application/gzip", expected},
+		{"Zip w/o trailing slash", "listing?download=zip", unlimited, ok, "application/zip", expected},
+		{"Zip within limits", tmpListingDir + "?download=zip", ArchiveLimits{MaxBytes: 6, MaxFiles: 3}, ok, "application/zip", expected},
+		{"Too many bytes", tmpListingDir + "?download=zip", ArchiveLimits{MaxBytes: 5}, forbidden, "text/plain; charset=utf-8", "directory exceeds the limits of archives\n"},
+		{"Too many files", tmpListingDir + "?download=tar.gz", ArchiveLimits{MaxFiles: 2}, forbidden, "text/plain; charset=utf-8", "directory exceeds the limits of archives\n"},
+		{"Unknown format", tmpListingDir + "?download=rar", unlimited, ok, "text/html; charset=utf-8", ""},
+		{"File", tmpFileName + "?download=zip", unlimited, ok, "text/plain; charset=utf-8", tmpFile},
+		{"Bad dir", "bad/?download=zip", unlimited, missing, "text/plain; charset=utf-8", notFound},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			serveFile := WithDirectoryArchives(WithListing(serveLocal, localFS, DefaultListingTemplate, ""), localFS, tc.limits)
+			handler := Basic(serveFile)
+
+			fullpath := "http://localhost/" + tc.path
+			req := httptest.NewRequest("GET", fullpath, nil)
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			resp := w.Result()
+			body, err := ioutil.ReadAll(resp.Body)
+			if nil != err {
+				t.Errorf("While reading body got %v", err)
+			}
+			if tc.code != resp.StatusCode {
+				t.Errorf(
+					"While retrieving %s expected status code of %d but got %d",
+					fullpath, tc.code, resp.StatusCode,
+				)
+			}
+			contentType := resp.Header.Get("Content-Type")
+			if tc.contentType != contentType {
+				t.Errorf(
+					"While retrieving %s expected content type '%s' but got '%s'",
+					fullpath, tc.contentType, contentType,
+				)
+			}
+
+			var contents string
+			switch contentType {
+			case "application/zip":
+				contents = readZip(t, body)
+			case "application/gzip":
+				contents = readTarGz(t, body)
+			case "text/html; charset=utf-8":
+				// Listings are covered by other tests.
+			default:
+				contents = string(body)
+			}
+			if tc.contents != contents {
+				t.Errorf(
+					"While retrieving %s expected contents '%s' but got '%s'",
+					fullpath, tc.contents, contents,
+				)
+			}
+		})
+	}
+}
+
+// unreadableDirFS fails to read the named directory of the file system.
+type unreadableDirFS struct {
+	fstest.MapFS
+	dirname string
+}
+
+// ReadDir of the file system, unless it's the unreadable directory.
+func (fsys unreadableDirFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if name == fsys.dirname {
+		return nil, errors.New("permission denied reading /srv/private/secrets")
+	}
+	return fsys.MapFS.ReadDir(name)
+}
+
+func TestWithDirectoryArchivesError(t *testing.T) {
+	fsys := unreadableDirFS{
+		MapFS: fstest.MapFS{
+			"docs/a.txt":         {Data: []byte("a")},
+			"docs/private/b.txt": {Data: []byte("b")},
+		},
+		dirname: "docs/private",
+	}
+	handler := Basic(WithDirectoryArchives(ServeFS(fsys), fsys, ArchiveLimits{}))
+
+	req := httptest.NewRequest("GET", "http://localhost/docs/?download=zip", nil)
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	if http.StatusInternalServerError != w.Code {
+		t.Errorf("Expected status code of %d but got %d", http.StatusInternalServerError, w.Code)
+	}
+	if strings.Contains(w.Body.String(), "secrets") {
+		t.Errorf("Expected the error to not be sent to the client but got '%s'", w.Body.String())
+	}
+}
+
+func TestWithDirectoryArchivesHead(t *testing.T) {
+	handler := Basic(WithDirectoryArchives(serveLocal, localFS, ArchiveLimits{}))
+
+	req := httptest.NewRequest("HEAD", "http://localhost/"+tmpListingDir+"?download=tar.gz", nil)
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	resp := w.Result()
+	if ok != resp.StatusCode {
+		t.Errorf("Expected status code of %d but got %d", ok, resp.StatusCode)
+	}
+	if disposition := resp.Header.Get("Content-Disposition"); `attachment; filename=listing.tar.gz` != disposition {
+		t.Errorf("Expected attachment named 'listing.tar.gz' but got '%s'", disposition)
+	}
+	if 0 != w.Body.Len() {
+		t.Errorf("Expected empty body but got %d bytes", w.Body.Len())
+	}
+}
+
+// readZip returns the sorted names and contents of the zip archive.
+func readZip(t *testing.T, body []byte) string {
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if nil != err {
+		t.Fatalf("While reading zip got %v", err)
+	}
+	entries := []string{}
+	for _, file := range archive.File {
+		reader, err := file.Open()
+		if nil != err {
+			t.Fatalf("While opening %s got %v", file.Name, err)
+		}
+		contents, err := ioutil.ReadAll(reader)
+		if nil != err {
+			t.Fatalf("While reading %s got %v", file.Name, err)
+		}
+		reader.Close()
+		entries = append(entries, file.Name+":"+string(contents)+",")
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, "")
+}
+
+// readTarGz returns the sorted names and contents of the gzipped tar archive.
+func readTarGz(t *testing.T, body []byte) string {
+	decompressor, err := gzip.NewReader(bytes.NewReader(body))
+	if nil != err {
+		t.Fatalf("While reading gzip got %v", err)
+	}
+	archive := tar.NewReader(decompressor)
+	entries := []string{}
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if nil != err {
+			t.Fatalf("While reading tar got %v", err)
+		}
+		contents, err := ioutil.ReadAll(archive)
+		if nil != err {
+			t.Fatalf("While reading %s got %v", header.Name, err)
+		}
+		entries = append(entries, header.Name+":"+string(contents)+",")
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, "")
+}
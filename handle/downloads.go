@@ -0,0 +1,122 @@
+package handle
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// WithDownloads returns a function that serves files as attachments, which
+// browsers download rather than display, when requested with the 'download'
+// or 'filename' query parameter or when the file matches one of the patterns.
+// The 'filename' query parameter sets the name of the downloaded file, which
+// otherwise is the name of the served file.
+//
+// Patterns are 'path.Match' patterns of the path of the file if they start with
+// '/' (e.g. '/reports/*'), of the content type of the file if they otherwise
+// contain '/' (e.g. 'application/*') and of the base name of the file if not
+// (e.g. '*.pdf'). Directories and unsuccessful responses aren't attachments.
+func WithDownloads(serveFile FileServerFunc, patterns []string) FileServerFunc {
+	return func(w http.ResponseWriter, r *http.Request, name string) {
+		query := r.URL.Query()
+		filename := query.Get("filename")
+		_, download := query["download"]
+		if strings.HasSuffix(name, "/") ||
+			(filename == "" && !download && !matchDownload(patterns, name)) {
+			serveFile(w, r, name)
+			return
+		}
+
+		// Only the base name of the requested filename is used.
+		filename = path.Base(strings.ReplaceAll(filename, "\\", "/"))
+		if filename == "." || filename == "/" {
+			filename = path.Base(name)
+		}
+		serveFile(&dispositionWriter{
+			ResponseWriter: w,
+			value:          contentDisposition(filename),
+		}, r, name)
+	}
+}
+
+// matchDownload returns true if the named file matches one of the patterns.
+func matchDownload(patterns []string, name string) bool {
+	name = path.Join("/", name)
+	for _, pattern := range patterns {
+		subject := path.Base(name)
+		if strings.HasPrefix(pattern, "/") {
+			subject = name
+		} else if strings.Contains(pattern, "/") {
+			subject, _, _ = mime.ParseMediaType(typeByExtension(path.Ext(name)))
+		}
+		if ok, _ := path.Match(pattern, subject); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// contentDisposition returns the 'Content-Disposition' header value of an
+// attachment with the filename. Names that aren't printable ASCII are encoded
+// as defined by RFC 6266 and RFC 5987, with an ASCII fallback for older
+// clients.
+func contentDisposition(filename string) string {
+	fallback := strings.Map(func(r rune) rune {
+		if r < 0x20 || 0x7e < r || r == '"' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, filename)
+	value := fmt.Sprintf(`attachment; filename="%s"`, fallback)
+	if fallback == filename {
+		return value
+	}
+
+	var encoded strings.Builder
+	for _, b := range []byte(filename) {
+		if isAttrChar(b) {
+			encoded.WriteByte(b)
+		} else {
+			fmt.Fprintf(&encoded, "%%%02X", b)
+		}
+	}
+	return value + "; filename*=UTF-8''" + encoded.String()
+}
+
+// isAttrChar returns true if the byte may appear unencoded in an extended
+// parameter value (RFC 5987 'attr-char').
+func isAttrChar(b byte) bool {
+	return ('a' <= b && b <= 'z') || ('A' <= b && b <= 'Z') || ('0' <= b && b <= '9') ||
+		strings.IndexByte("!#$&+-.^_`|~", b) != -1
+}
+
+// dispositionWriter sets the 'Content-Disposition' header when the status code
+// is written.
+type dispositionWriter struct {
+	http.ResponseWriter
+	value       string
+	wroteHeader bool
+}
+
+// WriteHeader sets the 'Content-Disposition' header of successful responses,
+// unless the header is set, and sends the status code.
+func (dw *dispositionWriter) WriteHeader(code int) {
+	if !dw.wroteHeader {
+		dw.wroteHeader = true
+		success := code == http.StatusOK || code == http.StatusPartialContent
+		if success && "" == dw.Header().Get("Content-Disposition") {
+			dw.Header().Set("Content-Disposition", dw.value)
+		}
+	}
+	dw.ResponseWriter.WriteHeader(code)
+}
+
+// Write the body, sending 'OK' if the status code hasn't been written.
+func (dw *dispositionWriter) Write(b []byte) (int, error) {
+	if !dw.wroteHeader {
+		dw.WriteHeader(http.StatusOK)
+	}
+	return dw.ResponseWriter.Write(b)
+}
@@ -0,0 +1,73 @@
+package handle
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+func TestWithDownloads(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html":        {Data: []byte("index")},
+		"report.pdf":        {Data: []byte("report")},
+		"notes.txt":         {Data: []byte("notes")},
+		"video.mp4":         {Data: []byte("video")},
+		"reports/2024.csv":  {Data: []byte("2024")},
+		"reports/q1/q1.csv": {Data: []byte("q1")},
+		"résumé.txt":        {Data: []byte("résumé")},
+		"dir/file.txt":      {Data: []byte("file")},
+	}
+	patterns := []string{"*.pdf", "/reports/*", "video/*"}
+	handler := Basic(WithDownloads(ServeFS(fsys), patterns))
+
+	testCases := []struct {
+		name        string
+		path        string
+		code        int
+		disposition string
+	}{
+		{"Inline", "/notes.txt", ok, ""},
+		{"Download", "/notes.txt?download", ok, `attachment; filename="notes.txt"`},
+		{"Download value", "/notes.txt?download=1", ok, `attachment; filename="notes.txt"`},
+		{"Filename", "/notes.txt?filename=today.txt", ok, `attachment; filename="today.txt"`},
+		{"Filename path", "/notes.txt?filename=../a/b.txt", ok, `attachment; filename="b.txt"`},
+		{"Filename quote", "/notes.txt?filename=a%22b.txt", ok, `attachment; filename="a_b.txt"; filename*=UTF-8''a%22b.txt`},
+		{"Non-ASCII name", "/r%C3%A9sum%C3%A9.txt?download", ok, `attachment; filename="r_sum_.txt"; filename*=UTF-8''r%C3%A9sum%C3%A9.txt`},
+		{"Name pattern", "/report.pdf", ok, `attachment; filename="report.pdf"`},
+		{"Path pattern", "/reports/2024.csv", ok, `attachment; filename="2024.csv"`},
+		{"Path pattern subdirectory", "/reports/q1/q1.csv", ok, ""},
+		{"Type pattern", "/video.mp4", ok, `attachment; filename="video.mp4"`},
+		{"Range", "/report.pdf", http.StatusPartialContent, `attachment; filename="report.pdf"`},
+		{"Directory", "/dir/?download", ok, ""},
+		{"Index", "/?download", ok, ""},
+		{"Missing", "/missing.pdf", missing, ""},
+		{"Missing download", "/missing.txt?download", missing, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fullpath := "http://localhost" + tc.path
+			req := httptest.NewRequest("GET", fullpath, nil)
+			if tc.code == http.StatusPartialContent {
+				req.Header.Set("Range", "bytes=0-1")
+			}
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			if tc.code != w.Code {
+				t.Errorf(
+					"While retrieving %s expected status code of %d but got %d",
+					fullpath, tc.code, w.Code,
+				)
+			}
+			if result := w.Header().Get("Content-Disposition"); tc.disposition != result {
+				t.Errorf(
+					"While retrieving %s expected disposition '%s' but got '%s'",
+					fullpath, tc.disposition, result,
+				)
+			}
+		})
+	}
+}
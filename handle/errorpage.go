@@ -0,0 +1,102 @@
+package handle
+
+import (
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// ErrorPage maps an HTTP status code to the file used as the body of the
+// response. If Prefix is set then the page is only used for requests with a
+// URL path starting with that prefix.
+type ErrorPage struct {
+	Code     int
+	Prefix   string
+	Filename string
+}
+
+// WithErrorPages wraps an HTTP request so that any error response produced by
+// the wrapped handler (e.g. 'NOT FOUND' from Prefix, IgnoreIndex and
+// AddAccessKey or 'FORBIDDEN' from WithReferrers) is replaced by the matching
+// error page. The original status code is kept. When more than one page
+// matches, the page with the longest prefix is used.
+func WithErrorPages(serve http.HandlerFunc, pages []ErrorPage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		serve(&errorPageWriter{ResponseWriter: w, r: r, pages: pages}, r)
+	}
+}
+
+// errorPageWriter intercepts the status code written by a handler and, if an
+// error page is configured for it, writes the error page in place of the body
+// written by the handler.
+type errorPageWriter struct {
+	http.ResponseWriter
+	r           *http.Request
+	pages       []ErrorPage
+	wroteHeader bool
+	intercepted bool
+}
+
+// WriteHeader sends the status code and, if configured, the error page.
+func (ew *errorPageWriter) WriteHeader(code int) {
+	if ew.wroteHeader {
+		return
+	}
+	ew.wroteHeader = true
+
+	filename := matchErrorPage(ew.pages, code, ew.r.URL.Path)
+	if filename == "" {
+		ew.ResponseWriter.WriteHeader(code)
+		return
+	}
+
+	// If the error page can't be read then fallback to the body written by
+	// the wrapped handler.
+	contents, err := ioutil.ReadFile(filename)
+	if nil != err {
+		ew.ResponseWriter.WriteHeader(code)
+		return
+	}
+	ew.intercepted = true
+
+	contentType := typeByExtension(filepath.Ext(filename))
+	if contentType == "" {
+		contentType = http.DetectContentType(contents)
+	}
+	header := ew.Header()
+	header.Del("Content-Length")
+	header.Del("Content-Encoding")
+	header.Set("Content-Type", contentType)
+	ew.ResponseWriter.WriteHeader(code)
+	if ew.r.Method != http.MethodHead {
+		ew.ResponseWriter.Write(contents)
+	}
+}
+
+// Write the body, unless it is being replaced by an error page.
+func (ew *errorPageWriter) Write(b []byte) (int, error) {
+	if !ew.wroteHeader {
+		ew.WriteHeader(http.StatusOK)
+	}
+	if ew.intercepted {
+		return len(b), nil
+	}
+	return ew.ResponseWriter.Write(b)
+}
+
+// matchErrorPage returns the filename of the error page for the status code
+// and URL path or an empty string if none is configured.
+func matchErrorPage(pages []ErrorPage, code int, urlPath string) (filename string) {
+	longest := -1
+	for _, page := range pages {
+		if page.Code != code || !strings.HasPrefix(urlPath, page.Prefix) {
+			continue
+		}
+		if len(page.Prefix) > longest {
+			longest = len(page.Prefix)
+			filename = page.Filename
+		}
+	}
+	return
+}
@@ -0,0 +1,111 @@
+package handle
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWithErrorPages(t *testing.T) {
+	forbidden := http.StatusForbidden
+	prefix := "/my/prefix"
+	accessKey := "my-access-key"
+	invalidSource := "Invalid source 'http://other.pl'\n"
+
+	pages := []ErrorPage{
+		{Code: missing, Filename: baseDir + tmpNotFoundName},
+		{Code: forbidden, Filename: baseDir + tmpForbiddenName},
+	}
+	prefixPages := []ErrorPage{
+		{Code: missing, Filename: baseDir + tmpForbiddenName},
+		{Code: missing, Prefix: prefix, Filename: baseDir + tmpNotFoundName},
+	}
+	badPages := []ErrorPage{
+		{Code: missing, Filename: baseDir + tmpBadName},
+	}
+
+	testCases := []struct {
+		name     string
+		handler  http.HandlerFunc
+		path     string
+		refer    string
+		code     int
+		contents string
+	}{
+		{
+			"Good file", WithErrorPages(Basic(serveLocal), pages),
+			"/" + tmpFileName, "", ok, tmpFile,
+		},
+		{
+			"Bad file", WithErrorPages(Basic(serveLocal), pages),
+			"/" + tmpBadName, "", missing, tmpNotFound,
+		},
+		{
+			"Bad file without pages", WithErrorPages(Basic(serveLocal), nil),
+			"/" + tmpBadName, "", missing, notFound,
+		},
+		{
+			"Bad file with missing page", WithErrorPages(Basic(serveLocal), badPages),
+			"/" + tmpBadName, "", missing, notFound,
+		},
+		{
+			"Unknown prefix", WithErrorPages(Prefix(serveLocal, prefix), pages),
+			"/" + tmpFileName, "", missing, tmpNotFound,
+		},
+		{
+			"Longest prefix", WithErrorPages(Prefix(serveLocal, prefix), prefixPages),
+			prefix + "/" + tmpBadName, "", missing, tmpNotFound,
+		},
+		{
+			"Shortest prefix", WithErrorPages(Prefix(serveLocal, prefix), prefixPages),
+			"/" + tmpBadName, "", missing, tmpForbidden,
+		},
+		{
+			"Ignored index", WithErrorPages(IgnoreIndex(Basic(serveLocal)), pages),
+			"/", "", missing, tmpNotFound,
+		},
+		{
+			"Bad access key", WithErrorPages(AddAccessKey(Basic(serveLocal), accessKey), pages),
+			"/" + tmpFileName + "?key=bad", "", missing, tmpNotFound,
+		},
+		{
+			"Bad referrer", WithErrorPages(Basic(WithReferrers(serveLocal, []string{"http://localhost"})), pages),
+			"/" + tmpFileName, "http://other.pl", forbidden, tmpForbidden,
+		},
+		{
+			"Bad referrer without pages", WithErrorPages(Basic(WithReferrers(serveLocal, []string{"http://localhost"})), nil),
+			"/" + tmpFileName, "http://other.pl", forbidden, invalidSource,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fullpath := "http://localhost" + tc.path
+			req := httptest.NewRequest("GET", fullpath, nil)
+			req.Header.Add("Referer", tc.refer)
+			w := httptest.NewRecorder()
+
+			tc.handler(w, req)
+
+			resp := w.Result()
+			body, err := ioutil.ReadAll(resp.Body)
+			if nil != err {
+				t.Errorf("While reading body got %v", err)
+			}
+			contents := string(body)
+			if tc.code != resp.StatusCode {
+				t.Errorf(
+					"While retrieving %s expected status code of %d but got %d",
+					fullpath, tc.code, resp.StatusCode,
+				)
+			}
+			if tc.contents != contents {
+				t.Errorf(
+					"While retrieving %s expected contents '%s' but got '%s'",
+					fullpath, tc.contents, contents,
+				)
+			}
+		})
+	}
+}
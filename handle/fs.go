@@ -0,0 +1,120 @@
+package handle
+
+import (
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/halverneus/static-file-server/storage"
+)
+
+// ServeFS returns a function that serves files from the file system. Files
+// opened from the file system must implement io.Seeker. Like http.ServeFile,
+// index files are served for directories, directories are listed if they don't
+// contain an index file and range requests are supported. Entity tags provided
+// by the storage backend are used for conditional requests.
+func ServeFS(fsys fs.FS) FileServerFunc {
+	return func(w http.ResponseWriter, r *http.Request, name string) {
+		// Keep the trailing slash as the file server uses it to decide whether
+		// to redirect.
+		fsPath := path.Join("/", name)
+		if strings.HasSuffix(name, "/") && fsPath != "/" {
+			fsPath += "/"
+		}
+
+		req := new(http.Request)
+		*req = *r
+		req.URL = new(url.URL)
+		*req.URL = *r.URL
+		req.URL.Path = fsPath
+		req.URL.RawPath = ""
+		if !loadSettings().contentSniffing {
+			w.Header().Set("X-Content-Type-Options", "nosniff")
+		}
+		http.FileServer(http.FS(headerFS{FS: indexFS{fsys}, w: w})).ServeHTTP(w, req)
+	}
+}
+
+// headerFS sets the headers of the response for the files opened from the
+// wrapped file system. The 'ETag' header is set to the entity tag of the file,
+// if the backend provides one. The 'Content-Type' header is set to the content
+// type of the extension of the file or, if it is unknown and content sniffing
+// is disabled, to 'application/octet-stream' so that the file server doesn't
+// detect it.
+type headerFS struct {
+	fs.FS
+	w http.ResponseWriter
+}
+
+// Open the named file from the wrapped file system.
+func (fsys headerFS) Open(name string) (fs.File, error) {
+	file, err := fsys.FS.Open(name)
+	if nil != err {
+		return nil, err
+	}
+	if stat, err := file.Stat(); nil == err && !stat.IsDir() {
+		if tagged, ok := stat.Sys().(storage.ETagger); ok && tagged.ETag() != "" {
+			fsys.w.Header().Set("ETag", tagged.ETag())
+		}
+		if contentType := typeByExtension(path.Ext(stat.Name())); contentType != "" {
+			fsys.w.Header().Set("Content-Type", contentType)
+		} else if !loadSettings().contentSniffing {
+			fsys.w.Header().Set("Content-Type", "application/octet-stream")
+		}
+	}
+	return file, nil
+}
+
+// indexFS opens the first index file of a directory in place of the
+// 'index.html' file the file server opens for directories.
+type indexFS struct {
+	fs.FS
+}
+
+// Open the named file from the wrapped file system. The file server redirects
+// requests for 'index.html' files to their directory, so 'index.html' files
+// are only opened as the index file of a directory.
+func (fsys indexFS) Open(name string) (fs.File, error) {
+	if path.Base(name) != "index.html" {
+		return fsys.FS.Open(name)
+	}
+	index, ok := indexFile(fsys.FS, path.Dir(name))
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return fsys.FS.Open(index)
+}
+
+// indexFile returns the name of the first index file in the directory that is
+// a regular file.
+func indexFile(fsys fs.FS, dir string) (string, bool) {
+	for _, index := range loadSettings().indexFiles {
+		name := path.Join(dir, index)
+		if stat, err := fs.Stat(fsys, name); nil == err && stat.Mode().IsRegular() {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// isIndexFile returns true if the base name is the name of an index file.
+func isIndexFile(base string) bool {
+	for _, index := range loadSettings().indexFiles {
+		if index == base {
+			return true
+		}
+	}
+	return false
+}
+
+// fsName converts the name passed to a FileServerFunc into the name of the file
+// within an fs.FS (unrooted, with '.' as the root).
+func fsName(name string) string {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
@@ -0,0 +1,246 @@
+package handle
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// listingRow is the entry for the file in the 'noindex' directory of the plain
+// directory listing provided by the standard library.
+const listingRow = `<a href="noindex.txt">noindex.txt</a>`
+
+func TestServeFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		tmpIndexName:    {Data: []byte(tmpIndex)},
+		tmpFileName:     {Data: []byte(tmpFile)},
+		tmpSubIndexName: {Data: []byte(tmpSubIndex)},
+		tmpSubFileName:  {Data: []byte(tmpSubFile)},
+		tmpNoIndexName:  {Data: []byte(tmpSubDeepFile)},
+	}
+
+	testCases := []struct {
+		name     string
+		path     string
+		rng      string
+		code     int
+		contents string
+	}{
+		{"Good base dir", "", "", ok, tmpIndex},
+		{"Good base index", tmpIndexName, "", redirect, nothing},
+		{"Good base file", tmpFileName, "", ok, tmpFile},
+		{"Bad base file", tmpBadName, "", missing, notFound},
+		{"Good subdir dir", subDir, "", ok, tmpSubIndex},
+		{"Subdir without trailing slash", "sub", "", redirect, nothing},
+		{"Good subdir file", tmpSubFileName, "", ok, tmpSubFile},
+		{"Good subdir file range", tmpSubFileName, "bytes=3-9", http.StatusPartialContent, tmpSubFile[3:10]},
+		{"Dir without index", tmpNoIndexDir, "", ok, listingRow},
+	}
+
+	handler := Basic(ServeFS(fsys))
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fullpath := "http://localhost/" + tc.path
+			req := httptest.NewRequest("GET", fullpath, nil)
+			if tc.rng != "" {
+				req.Header.Set("Range", tc.rng)
+			}
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			resp := w.Result()
+			body, err := ioutil.ReadAll(resp.Body)
+			if nil != err {
+				t.Errorf("While reading body got %v", err)
+			}
+			contents := string(body)
+			if tc.contents == listingRow && strings.Contains(contents, listingRow) {
+				contents = listingRow
+			}
+			if tc.code != resp.StatusCode {
+				t.Errorf(
+					"While retrieving %s expected status code of %d but got %d",
+					fullpath, tc.code, resp.StatusCode,
+				)
+			}
+			if tc.contents != contents {
+				t.Errorf(
+					"While retrieving %s expected contents '%s' but got '%s'",
+					fullpath, tc.contents, contents,
+				)
+			}
+		})
+	}
+}
+
+// etag is an entity tag provided by a storage backend.
+type etag string
+
+func (tag etag) ETag() string { return string(tag) }
+
+func TestServeFSETag(t *testing.T) {
+	fsys := fstest.MapFS{
+		tmpIndexName: {Data: []byte(tmpIndex), Sys: etag(`"index"`)},
+		tmpFileName:  {Data: []byte(tmpFile)},
+	}
+
+	testCases := []struct {
+		name        string
+		path        string
+		ifNoneMatch string
+		code        int
+		etag        string
+	}{
+		{"Tagged file", "", "", ok, `"index"`},
+		{"Tagged file not modified", "", `"index"`, http.StatusNotModified, `"index"`},
+		{"Tagged file modified", "", `"other"`, ok, `"index"`},
+		{"Untagged file", tmpFileName, `"index"`, ok, ""},
+	}
+
+	handler := Basic(ServeFS(fsys))
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fullpath := "http://localhost/" + tc.path
+			req := httptest.NewRequest("GET", fullpath, nil)
+			if tc.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tc.ifNoneMatch)
+			}
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			resp := w.Result()
+			if tc.code != resp.StatusCode {
+				t.Errorf(
+					"While retrieving %s expected status code of %d but got %d",
+					fullpath, tc.code, resp.StatusCode,
+				)
+			}
+			if value := resp.Header.Get("ETag"); tc.etag != value {
+				t.Errorf(
+					"While retrieving %s expected ETag '%s' but got '%s'",
+					fullpath, tc.etag, value,
+				)
+			}
+		})
+	}
+}
+
+func TestServeFSIndexFiles(t *testing.T) {
+	activateSettings(t, func(s *Settings) {
+		s.SetIndexFiles([]string{"index.htm", "default.html", "index.html"})
+	})
+
+	fsys := fstest.MapFS{
+		"index.html":        {Data: []byte("index.html")},
+		"index.htm":         {Data: []byte("index.htm")},
+		"site/default.html": {Data: []byte("default")},
+		"site/index.html":   {Data: []byte("site index")},
+		"docs/README.html":  {Data: []byte("readme")},
+		"old/index.html":    {Data: []byte("old index")},
+		"dir/index.htm/a":   {Data: []byte("a")},
+	}
+
+	testCases := []struct {
+		name     string
+		path     string
+		code     int
+		contents string
+	}{
+		{"First index file", "", ok, "index.htm"},
+		{"Named index file", "index.htm", ok, "index.htm"},
+		{"Precedence", "site/", ok, "default"},
+		{"Unlisted index file", "docs/", missing, notFound},
+		{"Last index file", "old/", ok, "old index"},
+		{"Index redirect", "old/index.html", redirect, nothing},
+		{"Index directory", "dir/", missing, notFound},
+	}
+
+	handler := PreventListings(Basic(ServeFS(fsys)), fsys, "")
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fullpath := "http://localhost/" + tc.path
+			req := httptest.NewRequest("GET", fullpath, nil)
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			resp := w.Result()
+			body, err := ioutil.ReadAll(resp.Body)
+			if nil != err {
+				t.Errorf("While reading body got %v", err)
+			}
+			if tc.code != resp.StatusCode {
+				t.Errorf(
+					"While retrieving %s expected status code of %d but got %d",
+					fullpath, tc.code, resp.StatusCode,
+				)
+			}
+			if tc.contents != string(body) {
+				t.Errorf(
+					"While retrieving %s expected contents '%s' but got '%s'",
+					fullpath, tc.contents, string(body),
+				)
+			}
+			if tc.code == ok && !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+				t.Errorf(
+					"While retrieving %s expected HTML but got '%s'",
+					fullpath, resp.Header.Get("Content-Type"),
+				)
+			}
+		})
+	}
+}
+
+func TestServeFSContentSniffing(t *testing.T) {
+	fsys := fstest.MapFS{
+		"page.html":   {Data: []byte("<html>page</html>")},
+		"page":        {Data: []byte("<html>page</html>")},
+		"dir/data.qq": {Data: []byte("<html>page</html>")},
+	}
+
+	testCases := []struct {
+		name        string
+		sniffing    bool
+		path        string
+		contentType string
+		noSniff     string
+	}{
+		{"Known type", true, "page.html", "text/html; charset=utf-8", ""},
+		{"Sniffed", true, "page", "text/html; charset=utf-8", ""},
+		{"Sniffed extension", true, "dir/data.qq", "text/html; charset=utf-8", ""},
+		{"Known type w/o sniffing", false, "page.html", "text/html; charset=utf-8", "nosniff"},
+		{"Unknown w/o sniffing", false, "page", "application/octet-stream", "nosniff"},
+		{"Unknown extension w/o sniffing", false, "dir/data.qq", "application/octet-stream", "nosniff"},
+		{"Listing w/o sniffing", false, "dir/", "text/html; charset=utf-8", "nosniff"},
+	}
+
+	handler := Basic(ServeFS(fsys))
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			activateSettings(t, func(s *Settings) { s.SetContentSniffing(tc.sniffing) })
+			fullpath := "http://localhost/" + tc.path
+			req := httptest.NewRequest("GET", fullpath, nil)
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			if result := w.Header().Get("Content-Type"); tc.contentType != result {
+				t.Errorf(
+					"While retrieving %s expected content type '%s' but got '%s'",
+					fullpath, tc.contentType, result,
+				)
+			}
+			if result := w.Header().Get("X-Content-Type-Options"); tc.noSniff != result {
+				t.Errorf(
+					"While retrieving %s expected content type options '%s' but got '%s'",
+					fullpath, tc.noSniff, result,
+				)
+			}
+		})
+	}
+}
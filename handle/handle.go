@@ -1,21 +1,27 @@
 package handle
 
 import (
+	"context"
 	"crypto/md5"
 	"crypto/tls"
+	"errors"
 	"fmt"
+	"io/fs"
 	"log"
 	"net/http"
 	"os"
-	"path"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 )
 
 var (
 	// These assignments are for unit testing.
-	listenAndServe    = http.ListenAndServe
+	listenAndServe    = defaultListenAndServe
 	listenAndServeTLS = defaultListenAndServeTLS
 	setHandler        = http.HandleFunc
+	notifySignals     = signal.Notify
 )
 
 var (
@@ -23,8 +29,19 @@ var (
 	// minTLSVersion is the minimum allowed TLS version to be used by the
 	// server.
 	minTLSVersion uint16 = tls.VersionTLS10
+
+	// shutdownTimeout is how long active requests are waited for when the
+	// server is shut down.
+	shutdownTimeout = 25 * time.Second
 )
 
+// defaultListenAndServe is the default implementation of the listening
+// function for serving without TLS, which shuts down gracefully.
+func defaultListenAndServe(binding string, handler http.Handler) error {
+	server := &http.Server{Addr: binding, Handler: handler}
+	return serveUntilSignal(server, server.ListenAndServe)
+}
+
 // defaultListenAndServeTLS is the default implementation of the listening
 // function for serving with TLS enabled. This is, effectively, a copy from
 // the standard library but with the ability to set the minimum TLS version.
@@ -38,10 +55,47 @@ func defaultListenAndServeTLS(
 		Addr:    binding,
 		Handler: handler,
 		TLSConfig: &tls.Config{
-			MinVersion: minTLSVersion,
+			MinVersion:     minTLSVersion,
+			GetCertificate: getCertificate,
 		},
 	}
-	return server.ListenAndServeTLS(certFile, keyFile)
+	return serveUntilSignal(server, func() error {
+		return server.ListenAndServeTLS(certFile, keyFile)
+	})
+}
+
+// serveUntilSignal serves with the server, using the listen function, until
+// serving fails or an interrupt or termination signal is received. When a
+// signal is received, the server stops accepting connections and waits for
+// active requests to complete for up to the shutdown timeout, after which
+// remaining connections are closed and no error is returned.
+func serveUntilSignal(server *http.Server, listen func() error) error {
+	signals := make(chan os.Signal, 1)
+	notifySignals(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	served := make(chan error, 1)
+	go func() {
+		served <- listen()
+	}()
+
+	select {
+	case err := <-served:
+		return err
+	case received := <-signals:
+		log.Printf("Received %v, shutting down\n", received)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); nil != err {
+		log.Printf("Closing active connections after %v: %v\n", shutdownTimeout, err)
+		server.Close()
+	}
+	if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
 }
 
 // SetMinimumTLSVersion to be used by the server.
@@ -54,13 +108,24 @@ func SetMinimumTLSVersion(version uint16) {
 	minTLSVersion = version
 }
 
+// SetShutdownTimeout to wait for active requests when the server is shut down.
+func SetShutdownTimeout(timeout time.Duration) {
+	shutdownTimeout = timeout
+}
+
+// SetIndexFiles to be served for directories, in order of precedence.
+func (s *Settings) SetIndexFiles(names []string) {
+	s.indexFiles = names
+}
+
 // ListenerFunc accepts the {hostname:port} binding string required by HTTP
 // listeners and the handler (router) function and returns any errors that
 // occur.
 type ListenerFunc func(string, http.HandlerFunc) error
 
-// FileServerFunc is used to serve the file from the local file system to the
-// requesting client.
+// FileServerFunc is used to serve the named file from the file system to the
+// requesting client. The name is the slash-separated path of the file relative
+// to the root of the file system being served.
 type FileServerFunc func(http.ResponseWriter, *http.Request, string)
 
 // WithReferrers returns a function that evaluates the HTTP 'Referer' header
@@ -112,35 +177,35 @@ func WithLogging(serveFile FileServerFunc) FileServerFunc {
 	}
 }
 
-// Basic file handler servers files from the passed folder.
-func Basic(serveFile FileServerFunc, folder string) http.HandlerFunc {
+// Basic file handler serves files from the root of the file system.
+func Basic(serveFile FileServerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		serveFile(w, r, folder+r.URL.Path)
+		serveFile(w, r, r.URL.Path)
 	}
 }
 
 // Prefix file handler is an alternative to Basic where a URL prefix is removed
 // prior to serving a file (http://my.machine/prefix/file.txt will serve
-// file.txt from the root of the folder being served (ignoring 'prefix')).
-func Prefix(serveFile FileServerFunc, folder, urlPrefix string) http.HandlerFunc {
+// file.txt from the root of the file system being served (ignoring 'prefix')).
+func Prefix(serveFile FileServerFunc, urlPrefix string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if !strings.HasPrefix(r.URL.Path, urlPrefix) {
 			http.NotFound(w, r)
 			return
 		}
-		serveFile(w, r, folder+strings.TrimPrefix(r.URL.Path, urlPrefix))
+		serveFile(w, r, strings.TrimPrefix(r.URL.Path, urlPrefix))
 	}
 }
 
 // PreventListings returns a function that prevents listing of directories but
-// still allows index.html to be served.
-func PreventListings(serve http.HandlerFunc, folder string, urlPrefix string) http.HandlerFunc {
+// still allows index files to be served.
+func PreventListings(serve http.HandlerFunc, fsys fs.FS, urlPrefix string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if strings.HasSuffix(r.URL.Path, "/") {
-			// If the directory does not contain an index.html file, then
-			// return 'NOT FOUND' to prevent listing of the directory.
-			stat, err := os.Stat(path.Join(folder, strings.TrimPrefix(r.URL.Path, urlPrefix), "index.html"))
-			if err != nil || (err == nil && !stat.Mode().IsRegular()) {
+			// If the directory does not contain an index file, then return
+			// 'NOT FOUND' to prevent listing of the directory.
+			name := fsName(strings.TrimPrefix(r.URL.Path, urlPrefix))
+			if _, ok := indexFile(fsys, name); !ok {
 				http.NotFound(w, r)
 				return
 			}
@@ -7,11 +7,18 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"os/signal"
 	"path"
+	"syscall"
 	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/halverneus/static-file-server/storage"
 )
 
 var (
@@ -29,6 +36,12 @@ var (
 	tmpSubDeepBadName   = "sub/deep/bad.txt"
 	tmpNoIndexDir       = "noindex/"
 	tmpNoIndexName      = "noindex/noindex.txt"
+	tmpNotFoundName     = "errors/404.html"
+	tmpForbiddenName    = "errors/403.html"
+	tmpListingDir       = "listing/"
+	tmpListingAName     = "listing/a.txt"
+	tmpListingBName     = "listing/b.txt"
+	tmpListingCName     = "listing/c/c.txt"
 
 	tmpIndex        = "Space: the final frontier"
 	tmpFile         = "These are the voyages of the starship Enterprise."
@@ -36,6 +49,8 @@ var (
 	tmpSubFile      = "To explore strange new worlds"
 	tmpSubDeepIndex = "To seek out new life and new civilizations"
 	tmpSubDeepFile  = "To boldly go where no one has gone before"
+	tmpNotFound     = "<h1>He's dead, Jim</h1>"
+	tmpForbidden    = "<h1>Resistance is futile</h1>"
 
 	nothing  = ""
 	ok       = http.StatusOK
@@ -51,11 +66,19 @@ var (
 		baseDir + tmpSubDeepIndexName: tmpSubDeepIndex,
 		baseDir + tmpSubDeepFileName:  tmpSubDeepFile,
 		baseDir + tmpNoIndexName:      tmpSubDeepFile,
+		baseDir + tmpNotFoundName:     tmpNotFound,
+		baseDir + tmpForbiddenName:    tmpForbidden,
+		baseDir + tmpListingAName:     "aaa",
+		baseDir + tmpListingBName:     "b",
+		baseDir + tmpListingCName:     "cc",
 	}
 
+	localFS    = storage.Local(baseDir)
+	serveLocal = ServeFS(localFS)
+
 	serveFileFuncs = []FileServerFunc{
-		http.ServeFile,
-		WithLogging(http.ServeFile),
+		serveLocal,
+		WithLogging(serveLocal),
 	}
 )
 
@@ -206,7 +229,7 @@ func TestBasicWithAndWithoutLogging(t *testing.T) {
 	}
 
 	for _, serveFile := range serveFileFuncs {
-		handler := Basic(serveFile, baseDir)
+		handler := Basic(serveFile)
 		for _, tc := range testCases {
 			t.Run(tc.name, func(t *testing.T) {
 				fullpath := "http://localhost/" + tc.path
@@ -259,7 +282,7 @@ func TestPrefix(t *testing.T) {
 	}
 
 	for _, serveFile := range serveFileFuncs {
-		handler := Prefix(serveFile, baseDir, prefix)
+		handler := Prefix(serveFile, prefix)
 		for _, tc := range testCases {
 			t.Run(tc.name, func(t *testing.T) {
 				fullpath := "http://localhost" + tc.path
@@ -308,7 +331,7 @@ func TestIgnoreIndex(t *testing.T) {
 	}
 
 	for _, serveFile := range serveFileFuncs {
-		handler := IgnoreIndex(Basic(serveFile, baseDir))
+		handler := IgnoreIndex(Basic(serveFile))
 		for _, tc := range testCases {
 			t.Run(tc.name, func(t *testing.T) {
 				fullpath := "http://localhost/" + tc.path
@@ -358,7 +381,7 @@ func TestPreventListings(t *testing.T) {
 	}
 
 	for _, serveFile := range serveFileFuncs {
-		handler := PreventListings(Basic(serveFile, baseDir), baseDir, "")
+		handler := PreventListings(Basic(serveFile), localFS, "")
 		for _, tc := range testCases {
 			t.Run(tc.name, func(t *testing.T) {
 				fullpath := "http://localhost/" + tc.path
@@ -390,6 +413,63 @@ func TestPreventListings(t *testing.T) {
 	}
 }
 
+func TestPreventListingsOverlay(t *testing.T) {
+	// The index of the sub directory is only found in the lower layer.
+	upper := fstest.MapFS{
+		tmpFileName:    {Data: []byte(tmpFile)},
+		tmpSubFileName: {Data: []byte(tmpSubFile)},
+		tmpNoIndexName: {Data: []byte(tmpSubDeepFile)},
+	}
+	lower := fstest.MapFS{
+		tmpIndexName:    {Data: []byte(tmpIndex)},
+		tmpSubIndexName: {Data: []byte(tmpSubIndex)},
+	}
+	fsys := storage.Overlay(upper, lower)
+
+	testCases := []struct {
+		name     string
+		path     string
+		code     int
+		contents string
+	}{
+		{"Lower base dir", "", ok, tmpIndex},
+		{"Upper base file", tmpFileName, ok, tmpFile},
+		{"Lower subdir dir", subDir, ok, tmpSubIndex},
+		{"Upper subdir file", tmpSubFileName, ok, tmpSubFile},
+		{"Dir without index", tmpNoIndexDir, missing, notFound},
+	}
+
+	handler := PreventListings(Basic(ServeFS(fsys)), fsys, "")
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fullpath := "http://localhost/" + tc.path
+			req := httptest.NewRequest("GET", fullpath, nil)
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			resp := w.Result()
+			body, err := ioutil.ReadAll(resp.Body)
+			if nil != err {
+				t.Errorf("While reading body got %v", err)
+			}
+			contents := string(body)
+			if tc.code != resp.StatusCode {
+				t.Errorf(
+					"While retrieving %s expected status code of %d but got %d",
+					fullpath, tc.code, resp.StatusCode,
+				)
+			}
+			if tc.contents != contents {
+				t.Errorf(
+					"While retrieving %s expected contents '%s' but got '%s'",
+					fullpath, tc.contents, contents,
+				)
+			}
+		})
+	}
+}
+
 func TestAddAccessKey(t *testing.T) {
 	// Prepare testing data.
 	accessKey := "my-access-key"
@@ -447,7 +527,7 @@ func TestAddAccessKey(t *testing.T) {
 	}
 
 	for _, serveFile := range serveFileFuncs {
-		handler := AddAccessKey(Basic(serveFile, baseDir), accessKey)
+		handler := AddAccessKey(Basic(serveFile), accessKey)
 		for _, tc := range testCases {
 			t.Run(tc.name, func(t *testing.T) {
 				fullpath := fmt.Sprintf(
@@ -582,6 +662,107 @@ func TestTLSListening(t *testing.T) {
 	}
 }
 
+func TestServeUntilSignal(t *testing.T) {
+	testCases := []struct {
+		name      string
+		timeout   time.Duration
+		completed bool
+	}{
+		{"Active request completed", time.Minute, true},
+		{"Active request closed", 10 * time.Millisecond, false},
+	}
+
+	defer func() {
+		notifySignals = signal.Notify
+		shutdownTimeout = 25 * time.Second
+	}()
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Capture the channel notified of signals so the test can send
+			// them.
+			signals := make(chan chan<- os.Signal, 1)
+			notifySignals = func(c chan<- os.Signal, sig ...os.Signal) {
+				signals <- c
+			}
+			SetShutdownTimeout(tc.timeout)
+
+			started := make(chan struct{})
+			release := make(chan struct{})
+			defer close(release)
+			server := &http.Server{Handler: http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					close(started)
+					select {
+					case <-release:
+					case <-r.Context().Done():
+					}
+					w.Write([]byte("done"))
+				},
+			)}
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if nil != err {
+				t.Fatalf("While listening got %v", err)
+			}
+
+			served := make(chan error, 1)
+			go func() {
+				served <- serveUntilSignal(server, func() error {
+					return server.Serve(listener)
+				})
+			}()
+			notify := <-signals
+
+			responded := make(chan error, 1)
+			go func() {
+				resp, err := http.Get("http://" + listener.Addr().String())
+				if nil == err {
+					_, err = ioutil.ReadAll(resp.Body)
+					resp.Body.Close()
+				}
+				responded <- err
+			}()
+			<-started
+
+			notify <- syscall.SIGTERM
+			if tc.completed {
+				// New connections are refused while the request is active.
+				for {
+					conn, err := net.Dial("tcp", listener.Addr().String())
+					if nil != err {
+						break
+					}
+					conn.Close()
+					time.Sleep(time.Millisecond)
+				}
+				release <- struct{}{}
+			}
+
+			if err := <-served; nil != err {
+				t.Errorf("While shutting down expected nil error but got %v", err)
+			}
+			err = <-responded
+			if tc.completed && nil != err {
+				t.Errorf("While shutting down expected the request to complete but got %v", err)
+			}
+			if !tc.completed && nil == err {
+				t.Error("While shutting down expected the request to be closed")
+			}
+		})
+	}
+}
+
+func TestServeUntilSignalError(t *testing.T) {
+	defer func() { notifySignals = signal.Notify }()
+	notifySignals = func(chan<- os.Signal, ...os.Signal) {}
+
+	testError := errors.New("random problem")
+	err := serveUntilSignal(&http.Server{}, func() error { return testError })
+	if testError != err {
+		t.Errorf("While serving expected %v but got %v", testError, err)
+	}
+}
+
 func TestValidReferrer(t *testing.T) {
 	ok1 := "http://valid.com"
 	ok2 := "https://valid.com"
@@ -648,9 +829,9 @@ func TestAddCorsWildcardHeaders(t *testing.T) {
 			t.Run(tc.name, func(t *testing.T) {
 				var handler http.HandlerFunc
 				if tc.corsEnabled {
-					handler = AddCorsWildcardHeaders(Basic(serveFile, baseDir))
+					handler = AddCorsWildcardHeaders(Basic(serveFile))
 				} else {
-					handler = Basic(serveFile, baseDir)
+					handler = Basic(serveFile)
 				}
 
 				fullpath := "http://localhost/" + tmpFileName
@@ -0,0 +1,171 @@
+package handle
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HeadersFilename is the name of the files of custom response headers.
+const HeadersFilename = "_headers"
+
+// HeaderRule is the headers of responses for URL paths matching the pattern.
+type HeaderRule struct {
+	// Path pattern, where segments starting with ':' match any segment and a
+	// final '*' segment matches the rest of the path.
+	Path   string
+	Header http.Header
+}
+
+// ParseHeaders in the format of '_headers' files. Each unindented line is a URL
+// path pattern followed by indented 'Name: value' lines of the headers of the
+// responses for matching paths. A header repeated for a path has all of its
+// values sent. Blank lines and lines starting with '#' are ignored.
+func ParseHeaders(reader io.Reader) ([]HeaderRule, error) {
+	var rules []HeaderRule
+	scanner := bufio.NewScanner(reader)
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// Unindented lines start the headers of a path.
+		if strings.HasPrefix(scanner.Text(), "/") {
+			for index, segment := range segments(line) {
+				if strings.Contains(segment, "*") &&
+					(segment != "*" || index != len(segments(line))-1) {
+					return nil, fmt.Errorf("line %d: path '%s' may only end with '*'", number, line)
+				}
+			}
+			rules = append(rules, HeaderRule{Path: line, Header: http.Header{}})
+			continue
+		}
+
+		if len(rules) == 0 {
+			return nil, fmt.Errorf("line %d: header '%s' is not for a path", number, line)
+		}
+		parts := strings.SplitN(line, ":", 2)
+		name := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("line %d: header '%s' must be 'Name: value'", number, line)
+		}
+		rules[len(rules)-1].Header.Add(name, strings.TrimSpace(parts[1]))
+	}
+	return rules, scanner.Err()
+}
+
+// Headers are the custom response headers of the '_headers' files in the
+// directories of a file system. The paths of a '_headers' file are relative to
+// its directory. Files are parsed when first needed and parsed again when
+// changed.
+type Headers struct {
+	fsys  fs.FS
+	mutex sync.Mutex
+	files map[string]*headersFile
+}
+
+// headersFile is the parsed '_headers' file of a directory.
+type headersFile struct {
+	checked time.Time
+	loaded  bool
+	modTime time.Time
+	rules   []HeaderRule
+}
+
+// NewHeaders returns the custom response headers of the '_headers' files in
+// the file system.
+func NewHeaders(fsys fs.FS) *Headers {
+	return &Headers{fsys: fsys, files: map[string]*headersFile{}}
+}
+
+// Match returns the custom headers of the named file. The '_headers' files of
+// the directories containing the file (or, for names ending with '/', the
+// directory itself) are applied in order from the root, with later rules
+// replacing the headers of earlier ones.
+func (headers *Headers) Match(name string) http.Header {
+	matched := http.Header{}
+	parts := segments(name)
+	count := len(parts) - 1
+	if strings.HasSuffix(name, "/") || count < 0 {
+		count++
+	}
+	for index := 0; index <= count; index++ {
+		dir := path.Join(append([]string{"."}, parts[:index]...)...)
+		relative := "/" + strings.Join(parts[index:], "/")
+		for _, rule := range headers.rules(dir) {
+			if _, ok := matchPath(rule.Path, relative); ok {
+				for key, values := range rule.Header {
+					matched[key] = append([]string(nil), values...)
+				}
+			}
+		}
+	}
+	return matched
+}
+
+// rules returns the rules of the '_headers' file of the directory, parsing the
+// file if it changed. If the changed file can't be parsed, the error is logged
+// and the previous rules are kept.
+func (headers *Headers) rules(dir string) []HeaderRule {
+	headers.mutex.Lock()
+	defer headers.mutex.Unlock()
+
+	file, ok := headers.files[dir]
+	if ok && time.Since(file.checked) < checkInterval {
+		return file.rules
+	}
+	// Only directories that exist are remembered, so requests for arbitrary
+	// paths don't grow the parsed files without bound.
+	if info, err := fs.Stat(headers.fsys, dir); nil != err || !info.IsDir() {
+		delete(headers.files, dir)
+		return nil
+	}
+	if !ok {
+		file = &headersFile{}
+		headers.files[dir] = file
+	}
+	file.checked = time.Now()
+
+	name := path.Join(dir, HeadersFilename)
+	info, err := fs.Stat(headers.fsys, name)
+	if nil != err {
+		file.loaded, file.rules = false, nil
+		return nil
+	}
+	if file.loaded && info.ModTime().Equal(file.modTime) {
+		return file.rules
+	}
+	file.loaded, file.modTime = true, info.ModTime()
+
+	contents, err := fs.ReadFile(headers.fsys, name)
+	var rules []HeaderRule
+	if nil == err {
+		rules, err = ParseHeaders(bytes.NewReader(contents))
+	}
+	if nil != err {
+		log.Printf("Keeping previous headers after failing to load %s: %v\n", name, err)
+		return file.rules
+	}
+	file.rules = rules
+	return file.rules
+}
+
+// WithHeaders returns a function that sets the custom headers matching the
+// named file on the response before serving the file.
+func WithHeaders(serveFile FileServerFunc, headers *Headers) FileServerFunc {
+	return func(w http.ResponseWriter, r *http.Request, name string) {
+		for key, values := range headers.Match(name) {
+			w.Header()[key] = values
+		}
+		serveFile(w, r, name)
+	}
+}
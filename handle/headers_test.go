@@ -0,0 +1,207 @@
+package handle
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/halverneus/static-file-server/storage"
+)
+
+func TestParseHeaders(t *testing.T) {
+	testCases := []struct {
+		name    string
+		headers string
+		count   int
+		isError bool
+	}{
+		{"Empty", "", 0, false},
+		{"Comments", "# Security\n\n", 0, false},
+		{"Headers", "/*\n  X-Frame-Options: DENY\n  Link: </style.css>; rel=preload\n/docs/:page\n\tX-Robots-Tag: noindex", 2, false},
+		{"Path without headers", "/*", 1, false},
+		{"Header before path", "  X-Frame-Options: DENY", 0, true},
+		{"Inner splat", "/docs/*/page\n  X-Frame-Options: DENY", 0, true},
+		{"Missing colon", "/*\n  X-Frame-Options DENY", 0, true},
+		{"Empty name", "/*\n  : DENY", 0, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rules, err := ParseHeaders(strings.NewReader(tc.headers))
+			hasError := nil != err
+			if hasError && !tc.isError {
+				t.Errorf("Expected no error but got %v", err)
+			}
+			if !hasError && tc.isError {
+				t.Error("Expected an error but got no error")
+			}
+			if tc.count != len(rules) {
+				t.Errorf("Expected %d rules but got %d", tc.count, len(rules))
+			}
+		})
+	}
+
+	rules, _ := ParseHeaders(strings.NewReader("/*\n  Link: </a.css>\n  Link: </b.css>"))
+	if links := rules[0].Header.Values("Link"); 2 != len(links) {
+		t.Errorf("Expected repeated header to have 2 values but got %v", links)
+	}
+}
+
+func TestWithHeaders(t *testing.T) {
+	fsys := fstest.MapFS{
+		"_headers": {Data: []byte(`
+/*
+  X-Frame-Options: DENY
+  X-Scope: root
+/docs/*
+  X-Docs: true
+/:page
+  X-Page: top
+`)},
+		"docs/_headers": {Data: []byte(`
+/*
+  X-Scope: docs
+/api/
+  X-Api: index
+`)},
+		"docs/api/_headers": {Data: []byte("not a headers file")},
+		"index.html":        {Data: []byte("index")},
+		"file.txt":          {Data: []byte("file")},
+		"docs/guide.html":   {Data: []byte("guide")},
+		"docs/api/ref.html": {Data: []byte("ref")},
+	}
+	headers := NewHeaders(fsys)
+	handler := Basic(WithHeaders(func(w http.ResponseWriter, r *http.Request, name string) {}, headers))
+
+	testCases := []struct {
+		path    string
+		headers map[string]string
+	}{
+		{"/", map[string]string{"X-Frame-Options": "DENY", "X-Scope": "root", "X-Docs": "", "X-Page": ""}},
+		{"/file.txt", map[string]string{"X-Scope": "root", "X-Page": "top"}},
+		{"/docs/guide.html", map[string]string{"X-Frame-Options": "DENY", "X-Scope": "docs", "X-Docs": "true", "X-Page": ""}},
+		{"/docs/api/", map[string]string{"X-Scope": "docs", "X-Api": "index"}},
+		{"/docs/api/ref.html", map[string]string{"X-Scope": "docs", "X-Api": ""}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://localhost"+tc.path, nil)
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			for name, value := range tc.headers {
+				if result := w.Header().Get(name); value != result {
+					t.Errorf(
+						"While retrieving %s expected %s '%s' but got '%s'",
+						tc.path, name, value, result,
+					)
+				}
+			}
+		})
+	}
+}
+
+func TestHeadersChanged(t *testing.T) {
+	defer func(interval time.Duration) { checkInterval = interval }(checkInterval)
+	checkInterval = time.Hour
+
+	fsys := fstest.MapFS{
+		"_headers": {Data: []byte("/*\n  X-Version: 1")},
+	}
+	headers := NewHeaders(fsys)
+	version := func() string {
+		return headers.Match("/index.html").Get("X-Version")
+	}
+	if result := version(); "1" != result {
+		t.Errorf("Expected version '1' but got '%s'", result)
+	}
+
+	fsys["_headers"] = &fstest.MapFile{Data: []byte("/*\n  X-Version: 2"), ModTime: time.Now()}
+	if result := version(); "1" != result {
+		t.Errorf("Before the check interval expected version '1' but got '%s'", result)
+	}
+
+	checkInterval = 0
+	if result := version(); "2" != result {
+		t.Errorf("After a change expected version '2' but got '%s'", result)
+	}
+
+	fsys["_headers"] = &fstest.MapFile{Data: []byte("X-Version: 3"), ModTime: time.Now().Add(time.Minute)}
+	if result := version(); "2" != result {
+		t.Errorf("After an invalid change expected version '2' but got '%s'", result)
+	}
+
+	delete(fsys, "_headers")
+	if result := version(); "" != result {
+		t.Errorf("After removal expected no version but got '%s'", result)
+	}
+}
+
+func TestHeadersMissingDirectories(t *testing.T) {
+	fsys := fstest.MapFS{
+		"_headers":        {Data: []byte("/*\n  X-Frame-Options: DENY")},
+		"docs/guide.html": {Data: []byte("guide")},
+	}
+	headers := NewHeaders(fsys)
+	for _, name := range []string{"/docs/guide.html", "/a/b/c.html", "/x/y/", "/docs/guide.html/z"} {
+		if result := headers.Match(name).Get("X-Frame-Options"); "DENY" != result {
+			t.Errorf("While matching %s expected 'DENY' but got '%s'", name, result)
+		}
+	}
+	if 2 != len(headers.files) {
+		t.Errorf("Expected only the 2 existing directories to be kept but got %d", len(headers.files))
+	}
+}
+
+func TestServeFSHiddenRange(t *testing.T) {
+	root := t.TempDir()
+	for name, contents := range map[string]string{
+		"file.txt": "0123456789",
+		"page":     "<html>page</html>",
+		"_headers": "/*\n  X-Frame-Options: DENY",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(contents), 0600); nil != err {
+			t.Fatalf("While writing %s got %v", name, err)
+		}
+	}
+	handler := Basic(ServeFS(storage.Hide(storage.Local(root), "_headers")))
+
+	testCases := []struct {
+		name        string
+		path        string
+		rangeHeader string
+		code        int
+		body        string
+	}{
+		{"Range", "/file.txt", "bytes=2-4", http.StatusPartialContent, "234"},
+		{"Sniffed", "/page", "", ok, "<html>page</html>"},
+		{"Hidden", "/_headers", "", missing, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fullpath := "http://localhost" + tc.path
+			req := httptest.NewRequest("GET", fullpath, nil)
+			if 0 < len(tc.rangeHeader) {
+				req.Header.Set("Range", tc.rangeHeader)
+			}
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			if tc.code != w.Code {
+				t.Errorf("While retrieving %s expected status code of %d but got %d", fullpath, tc.code, w.Code)
+			}
+			if 0 < len(tc.body) && tc.body != w.Body.String() {
+				t.Errorf("While retrieving %s expected body '%s' but got '%s'", fullpath, tc.body, w.Body.String())
+			}
+		})
+	}
+}
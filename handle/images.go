@@ -0,0 +1,424 @@
+package handle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxImagePixels is the largest number of pixels of images that are resized,
+// which keeps decoding from using too much memory.
+const maxImagePixels = 50 * 1000 * 1000
+
+// imageFormats maps the formats of resized images to their content types.
+var imageFormats = map[string]string{
+	"jpeg": "image/jpeg",
+	"png":  "image/png",
+	"gif":  "image/gif",
+}
+
+// ImageSize is an allowed size of resized images. A zero width or height is
+// scaled to keep the aspect ratio of the image.
+type ImageSize struct {
+	Width  int
+	Height int
+}
+
+// Images resizes images to the allowed sizes. Resized images are cached in a
+// directory, if set, with keys including the modification time of the image.
+type Images struct {
+	sizes      []ImageSize
+	cacheDir   string
+	cacheBytes int64
+	// limit is the semaphore limiting the number of images resized at once.
+	limit chan struct{}
+
+	// cacheMutex guards cached, the total size of the cached images, which is
+	// negative until the cache directory is first read.
+	cacheMutex sync.Mutex
+	cached     int64
+}
+
+// NewImages returns the resizer of images to the allowed sizes, caching resized
+// images in the directory if it isn't empty. When the cached images exceed the
+// number of bytes, the least recently used images are removed. If the number of
+// bytes is zero, the cache isn't limited.
+func NewImages(sizes []ImageSize, cacheDir string, cacheBytes int64) *Images {
+	return &Images{
+		sizes:      sizes,
+		cacheDir:   cacheDir,
+		cacheBytes: cacheBytes,
+		limit:      make(chan struct{}, runtime.NumCPU()),
+		cached:     -1,
+	}
+}
+
+// imageTransform is a requested resize and conversion of an image.
+type imageTransform struct {
+	size   ImageSize
+	fit    string
+	format string
+}
+
+// WithImages returns a function that resizes and converts PNG, JPEG and GIF
+// images requested with the 'w' (width), 'h' (height), 'fit' and 'format'
+// query parameters. When both the width and height are set, 'fit' is 'contain'
+// (the default) to fit the image within the size, 'cover' to crop the image to
+// fill the size or 'fill' to stretch the image to the size. The 'format' is
+// 'jpeg', 'png' or 'gif', defaulting to the format of the image. Images are
+// never enlarged and only the first frame of GIF images is kept. Requests
+// without an allowed size, including those only converting the format, return
+// 'BAD REQUEST'. All other requests are passed to the wrapped function.
+func WithImages(serveFile FileServerFunc, fsys fs.FS, images *Images) FileServerFunc {
+	return func(w http.ResponseWriter, r *http.Request, name string) {
+		query := r.URL.Query()
+		requested := false
+		for _, key := range []string{"w", "h", "fit", "format"} {
+			if _, ok := query[key]; ok {
+				requested = true
+			}
+		}
+		filename := fsName(name)
+		source := imageFormat(filename)
+		if !requested || strings.HasSuffix(name, "/") || source == "" {
+			serveFile(w, r, name)
+			return
+		}
+
+		transform, err := images.parse(r, source)
+		if nil != err {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		stat, err := fs.Stat(fsys, filename)
+		if nil != err || !stat.Mode().IsRegular() {
+			serveFile(w, r, name)
+			return
+		}
+
+		resized, err := images.resized(fsys, filename, stat, transform)
+		if nil != err {
+			log.Printf("Failed to resize %s: %v\n", filename, err)
+			http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", imageFormats[transform.format])
+		http.ServeContent(w, r, "", stat.ModTime(), bytes.NewReader(resized))
+	}
+}
+
+// imageFormat returns the format of the image with the file name, or an empty
+// string if it isn't a supported image.
+func imageFormat(filename string) string {
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".jpg", ".jpeg":
+		return "jpeg"
+	case ".png":
+		return "png"
+	case ".gif":
+		return "gif"
+	}
+	return ""
+}
+
+// parse the transform of the image in the source format from the query of the
+// request.
+func (images *Images) parse(r *http.Request, source string) (imageTransform, error) {
+	query := r.URL.Query()
+	transform := imageTransform{fit: query.Get("fit"), format: query.Get("format")}
+
+	for key, value := range map[string]*int{"w": &transform.size.Width, "h": &transform.size.Height} {
+		if raw := query.Get(key); raw != "" {
+			number, err := strconv.Atoi(raw)
+			if nil != err || number < 0 {
+				return transform, fmt.Errorf("'%s' must be a number of pixels", key)
+			}
+			*value = number
+		}
+	}
+	// Every transform must be of an allowed size, so that requests can't
+	// convert images of any size or fill the cache with other transforms.
+	if !images.allowed(transform.size) {
+		return transform, fmt.Errorf(
+			"size %dx%d is not allowed", transform.size.Width, transform.size.Height,
+		)
+	}
+
+	switch transform.fit {
+	case "":
+		transform.fit = "contain"
+	case "contain", "cover", "fill":
+	default:
+		return transform, fmt.Errorf("'fit' must be 'contain', 'cover' or 'fill'")
+	}
+	// The fit only applies when both the width and height are set, so other
+	// sizes share a single cached image.
+	if transform.size.Width == 0 || transform.size.Height == 0 {
+		transform.fit = "contain"
+	}
+
+	switch transform.format {
+	case "":
+		transform.format = source
+	case "jpg":
+		transform.format = "jpeg"
+	case "jpeg", "png", "gif":
+	default:
+		return transform, fmt.Errorf("'format' must be 'jpeg', 'png' or 'gif'")
+	}
+	return transform, nil
+}
+
+// allowed returns true if the size is one of the allowed sizes.
+func (images *Images) allowed(size ImageSize) bool {
+	for _, allowed := range images.sizes {
+		if allowed == size {
+			return true
+		}
+	}
+	return false
+}
+
+// resized returns the encoded image transformed from the named file, using the
+// cached image if there is one.
+func (images *Images) resized(fsys fs.FS, filename string, stat fs.FileInfo, transform imageTransform) ([]byte, error) {
+	var cached string
+	if images.cacheDir != "" {
+		key := sha256.Sum256([]byte(fmt.Sprintf(
+			"%s\x00%d\x00%d\x00%d\x00%d\x00%s\x00%s", filename, stat.ModTime().UnixNano(), stat.Size(),
+			transform.size.Width, transform.size.Height, transform.fit, transform.format,
+		)))
+		cached = filepath.Join(images.cacheDir, hex.EncodeToString(key[:])+"."+transform.format)
+		if contents, err := ioutil.ReadFile(cached); nil == err {
+			// The modification time of cached images is the time they were
+			// last used, so that the least recently used are removed first.
+			now := time.Now()
+			os.Chtimes(cached, now, now)
+			return contents, nil
+		}
+	}
+
+	images.limit <- struct{}{}
+	defer func() { <-images.limit }()
+
+	file, err := fsys.Open(filename)
+	if nil != err {
+		return nil, err
+	}
+	defer file.Close()
+	config, _, err := image.DecodeConfig(file)
+	if nil != err {
+		return nil, err
+	}
+	if maxImagePixels < int64(config.Width)*int64(config.Height) {
+		return nil, fmt.Errorf("image of %dx%d pixels is too large", config.Width, config.Height)
+	}
+	seeker, ok := file.(io.Seeker)
+	if !ok {
+		return nil, fmt.Errorf("file is not seekable")
+	}
+	if _, err := seeker.Seek(0, io.SeekStart); nil != err {
+		return nil, err
+	}
+	src, _, err := image.Decode(file)
+	if nil != err {
+		return nil, err
+	}
+
+	dst := resizeImage(src, transform.size, transform.fit)
+	var buf bytes.Buffer
+	switch transform.format {
+	case "jpeg":
+		// JPEG has no transparency, so transparent areas are made white.
+		flat := image.NewRGBA(dst.Bounds())
+		draw.Draw(flat, flat.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+		draw.Draw(flat, flat.Bounds(), dst, dst.Bounds().Min, draw.Over)
+		err = jpeg.Encode(&buf, flat, &jpeg.Options{Quality: 85})
+	case "png":
+		err = png.Encode(&buf, dst)
+	case "gif":
+		err = gif.Encode(&buf, dst, nil)
+	}
+	if nil != err {
+		return nil, err
+	}
+
+	// Write the cached image to a temporary file first so that a partially
+	// written image is never served.
+	if cached != "" {
+		if temp, err := ioutil.TempFile(images.cacheDir, ".resize-*"); nil == err {
+			_, err = temp.Write(buf.Bytes())
+			if closeErr := temp.Close(); nil == err {
+				err = closeErr
+			}
+			if nil == err {
+				err = os.Rename(temp.Name(), cached)
+			}
+			if nil != err {
+				log.Printf("Failed to cache resized %s: %v\n", filename, err)
+				os.Remove(temp.Name())
+			} else {
+				images.addCached(int64(buf.Len()))
+			}
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// addCached adds the size of an image added to the cache to the total size of
+// the cached images. When the total exceeds the size limit of the cache, the
+// least recently used images are removed until the cache is within three
+// quarters of the limit, so that the cache directory is only read now and then.
+func (images *Images) addCached(size int64) {
+	if images.cacheBytes <= 0 {
+		return
+	}
+	images.cacheMutex.Lock()
+	defer images.cacheMutex.Unlock()
+	if 0 <= images.cached {
+		images.cached += size
+		if images.cached <= images.cacheBytes {
+			return
+		}
+	}
+
+	entries, err := ioutil.ReadDir(images.cacheDir)
+	if nil != err {
+		log.Printf("Failed to read image cache %s: %v\n", images.cacheDir, err)
+		return
+	}
+	var total int64
+	for _, entry := range entries {
+		total += entry.Size()
+	}
+	if images.cacheBytes < total {
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].ModTime().Before(entries[j].ModTime())
+		})
+		for _, entry := range entries {
+			if total <= images.cacheBytes/4*3 {
+				break
+			}
+			// Temporary files are images being cached.
+			if strings.HasPrefix(entry.Name(), ".") || entry.IsDir() {
+				continue
+			}
+			err := os.Remove(filepath.Join(images.cacheDir, entry.Name()))
+			if nil == err || os.IsNotExist(err) {
+				total -= entry.Size()
+			}
+		}
+	}
+	images.cached = total
+}
+
+// resizeImage returns the image resized to the size, fitting the size as set by
+// fit. Images are never enlarged.
+func resizeImage(src image.Image, size ImageSize, fit string) *image.RGBA {
+	bounds := src.Bounds()
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+	width, height := srcWidth, srcHeight
+	crop := bounds
+
+	scale := func(value, numerator, denominator int) int {
+		scaled := (value*numerator + denominator/2) / denominator
+		if scaled < 1 {
+			return 1
+		}
+		return scaled
+	}
+	switch {
+	case size.Width == 0 && size.Height == 0:
+	case size.Height == 0:
+		width, height = size.Width, scale(srcHeight, size.Width, srcWidth)
+	case size.Width == 0:
+		width, height = scale(srcWidth, size.Height, srcHeight), size.Height
+	case fit == "fill":
+		width, height = size.Width, size.Height
+	case fit == "cover":
+		// Crop the center of the image to the aspect ratio of the size.
+		if srcWidth*size.Height > size.Width*srcHeight {
+			cropWidth := scale(srcHeight, size.Width, size.Height)
+			crop.Min.X += (srcWidth - cropWidth) / 2
+			crop.Max.X = crop.Min.X + cropWidth
+		} else {
+			cropHeight := scale(srcWidth, size.Height, size.Width)
+			crop.Min.Y += (srcHeight - cropHeight) / 2
+			crop.Max.Y = crop.Min.Y + cropHeight
+		}
+		width, height = size.Width, size.Height
+		if crop.Dx() < width {
+			width, height = crop.Dx(), crop.Dy()
+		}
+	default:
+		if srcWidth*size.Height > size.Width*srcHeight {
+			width, height = size.Width, scale(srcHeight, size.Width, srcWidth)
+		} else {
+			width, height = scale(srcWidth, size.Height, srcHeight), size.Height
+		}
+	}
+	if crop.Dx() < width || crop.Dy() < height {
+		width, height = crop.Dx(), crop.Dy()
+	}
+
+	// Convert the cropped image to RGBA, which the standard library does
+	// quickly for the decoded formats, then average the pixels of the source
+	// covered by each pixel of the destination.
+	rgba := image.NewRGBA(image.Rect(0, 0, crop.Dx(), crop.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), src, crop.Min, draw.Src)
+	if width == crop.Dx() && height == crop.Dy() {
+		return rgba
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0, y1 := y*crop.Dy()/height, (y+1)*crop.Dy()/height
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < width; x++ {
+			x0, x1 := x*crop.Dx()/width, (x+1)*crop.Dx()/width
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+			var r, g, b, a, count uint64
+			for sy := y0; sy < y1; sy++ {
+				offset := rgba.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					r += uint64(rgba.Pix[offset])
+					g += uint64(rgba.Pix[offset+1])
+					b += uint64(rgba.Pix[offset+2])
+					a += uint64(rgba.Pix[offset+3])
+					offset += 4
+					count++
+				}
+			}
+			offset := dst.PixOffset(x, y)
+			dst.Pix[offset] = uint8(r / count)
+			dst.Pix[offset+1] = uint8(g / count)
+			dst.Pix[offset+2] = uint8(b / count)
+			dst.Pix[offset+3] = uint8(a / count)
+		}
+	}
+	return dst
+}
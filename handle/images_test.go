@@ -0,0 +1,226 @@
+package handle
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// testImage returns a PNG image of the size, red on the left half and blue on
+// the right half.
+func testImage(t *testing.T, width, height int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if x < width/2 {
+				img.Set(x, y, color.RGBA{255, 0, 0, 255})
+			} else {
+				img.Set(x, y, color.RGBA{0, 0, 255, 255})
+			}
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); nil != err {
+		t.Fatalf("While encoding test image got %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestWithImages(t *testing.T) {
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"photo.png":  {Data: testImage(t, 400, 200), ModTime: modTime},
+		"broken.png": {Data: []byte("not an image"), ModTime: modTime},
+		"notes.txt":  {Data: []byte("notes"), ModTime: modTime},
+	}
+	images := NewImages([]ImageSize{{100, 100}, {200, 0}, {0, 50}, {800, 800}}, t.TempDir(), 0)
+	handler := Basic(WithImages(ServeFS(fsys), fsys, images))
+
+	testCases := []struct {
+		name        string
+		path        string
+		code        int
+		contentType string
+		width       int
+		height      int
+	}{
+		{"Original", "/photo.png", ok, "image/png", 400, 200},
+		{"Contain", "/photo.png?w=100&h=100", ok, "image/png", 100, 50},
+		{"Cover", "/photo.png?w=100&h=100&fit=cover", ok, "image/png", 100, 100},
+		{"Fill", "/photo.png?w=100&h=100&fit=fill", ok, "image/png", 100, 100},
+		{"Width only", "/photo.png?w=200", ok, "image/png", 200, 100},
+		{"Height only", "/photo.png?h=50", ok, "image/png", 100, 50},
+		{"Never enlarged", "/photo.png?w=800&h=800", ok, "image/png", 400, 200},
+		{"JPEG", "/photo.png?w=200&format=jpeg", ok, "image/jpeg", 200, 100},
+		{"GIF", "/photo.png?w=200&format=gif", ok, "image/gif", 200, 100},
+		{"Size not allowed", "/photo.png?w=101&h=100", http.StatusBadRequest, "", 0, 0},
+		{"Bad width", "/photo.png?w=wide", http.StatusBadRequest, "", 0, 0},
+		{"Bad fit", "/photo.png?w=100&h=100&fit=tile", http.StatusBadRequest, "", 0, 0},
+		{"Bad format", "/photo.png?w=200&format=bmp", http.StatusBadRequest, "", 0, 0},
+		{"Format without size", "/photo.png?format=gif", http.StatusBadRequest, "", 0, 0},
+		{"Fit without size", "/photo.png?fit=cover", http.StatusBadRequest, "", 0, 0},
+		{"Not an image", "/notes.txt?w=100&h=100", ok, "text/plain; charset=utf-8", 0, 0},
+		{"Broken image", "/broken.png?w=100&h=100", http.StatusInternalServerError, "", 0, 0},
+		{"Missing image", "/missing.png?w=100&h=100", missing, "", 0, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Request each image twice, the second time from the cache.
+			for attempt := 0; attempt < 2; attempt++ {
+				fullpath := "http://localhost" + tc.path
+				req := httptest.NewRequest("GET", fullpath, nil)
+				w := httptest.NewRecorder()
+
+				handler(w, req)
+
+				if tc.code != w.Code {
+					t.Errorf(
+						"While retrieving %s expected status code of %d but got %d",
+						fullpath, tc.code, w.Code,
+					)
+				}
+				if tc.code != ok {
+					continue
+				}
+				if contentType := w.Header().Get("Content-Type"); tc.contentType != contentType {
+					t.Errorf(
+						"While retrieving %s expected content type '%s' but got '%s'",
+						fullpath, tc.contentType, contentType,
+					)
+				}
+				if tc.width == 0 {
+					continue
+				}
+				config, _, err := image.DecodeConfig(w.Body)
+				if nil != err {
+					t.Fatalf("While decoding %s got %v", fullpath, err)
+				}
+				if tc.width != config.Width || tc.height != config.Height {
+					t.Errorf(
+						"While retrieving %s expected size %dx%d but got %dx%d",
+						fullpath, tc.width, tc.height, config.Width, config.Height,
+					)
+				}
+			}
+		})
+	}
+}
+
+func TestWithImagesCache(t *testing.T) {
+	cacheDir := t.TempDir()
+	fsys := fstest.MapFS{
+		"photo.png": {Data: testImage(t, 400, 200), ModTime: time.Unix(1, 0)},
+	}
+	handler := Basic(WithImages(ServeFS(fsys), fsys, NewImages([]ImageSize{{100, 0}}, cacheDir, 0)))
+	request := func() {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", "http://localhost/photo.png?w=100", nil))
+		if ok != w.Code {
+			t.Fatalf("While retrieving resized image expected status code of %d but got %d", ok, w.Code)
+		}
+	}
+	cached := func() int {
+		entries, err := ioutil.ReadDir(cacheDir)
+		if nil != err {
+			t.Fatalf("While reading cache got %v", err)
+		}
+		return len(entries)
+	}
+
+	request()
+	request()
+	if count := cached(); 1 != count {
+		t.Errorf("After resizing an image twice expected 1 cached image but got %d", count)
+	}
+
+	fsys["photo.png"].ModTime = time.Unix(2, 0)
+	request()
+	if count := cached(); 2 != count {
+		t.Errorf("After the image changed expected 2 cached images but got %d", count)
+	}
+}
+
+func TestWithImagesCacheLimit(t *testing.T) {
+	cacheDir := t.TempDir()
+	photo := testImage(t, 400, 200)
+	fsys := fstest.MapFS{
+		"a.png": {Data: photo},
+		"b.png": {Data: photo},
+		"c.png": {Data: photo},
+	}
+	images := NewImages([]ImageSize{{100, 0}}, cacheDir, 0)
+	handler := Basic(WithImages(ServeFS(fsys), fsys, images))
+	request := func(name string) {
+		// Keep the modification times of the cached images apart.
+		time.Sleep(10 * time.Millisecond)
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", "http://localhost/"+name+"?w=100", nil))
+		if ok != w.Code {
+			t.Fatalf("While retrieving resized %s expected status code of %d but got %d", name, ok, w.Code)
+		}
+	}
+	cached := func() (names map[string]bool, size int64) {
+		entries, err := ioutil.ReadDir(cacheDir)
+		if nil != err {
+			t.Fatalf("While reading cache got %v", err)
+		}
+		names = map[string]bool{}
+		for _, entry := range entries {
+			names[entry.Name()] = true
+			size += entry.Size()
+		}
+		return names, size
+	}
+	added := func(before map[string]bool) string {
+		after, _ := cached()
+		for name := range after {
+			if !before[name] {
+				return name
+			}
+		}
+		return ""
+	}
+
+	// Limit the cache to just under three of the identical resized images.
+	request("a.png")
+	names, size := cached()
+	images.cacheBytes = 3*size - 1
+	request("b.png")
+	b := added(names)
+	request("a.png")
+	request("c.png")
+
+	// The least recently used image was removed.
+	names, total := cached()
+	if 2 != len(names) || names[b] || images.cacheBytes < total {
+		t.Errorf(
+			"Expected 2 cached images without the least recently used within %d bytes but got %v of %d bytes",
+			images.cacheBytes, names, total,
+		)
+	}
+}
+
+func TestResizeImage(t *testing.T) {
+	src, err := png.Decode(bytes.NewReader(testImage(t, 400, 200)))
+	if nil != err {
+		t.Fatalf("While decoding test image got %v", err)
+	}
+
+	// Covering a square crops the center of the image, leaving red on the
+	// left and blue on the right.
+	dst := resizeImage(src, ImageSize{Width: 10, Height: 10}, "cover")
+	if left := dst.RGBAAt(0, 5); left.R != 255 || left.B != 0 {
+		t.Errorf("While covering expected red on the left but got %v", left)
+	}
+	if right := dst.RGBAAt(9, 5); right.B != 255 || right.R != 0 {
+		t.Errorf("While covering expected blue on the right but got %v", right)
+	}
+}
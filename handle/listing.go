@@ -0,0 +1,307 @@
+package handle
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Listing is the data passed to the template rendering a directory listing.
+type Listing struct {
+	// Path of the directory being listed, as requested in the URL.
+	Path        string
+	Breadcrumbs []Breadcrumb
+	Entries     []ListingEntry
+	// Sort is the key the entries are sorted by ('name', 'size' or 'time') and
+	// Order is either 'asc' or 'desc'.
+	Sort  string
+	Order string
+	// Total number of entries in the directory, of which Entries holds at most
+	// Limit entries (no limit if zero) starting from Offset. If more entries
+	// follow then NextURL is the query for the next page.
+	Total   int
+	Offset  int
+	Limit   int
+	NextURL string
+	// Readme is the rendered 'README.md' file of the directory, if enabled.
+	Readme template.HTML
+
+	// query of the listing request, kept by the sort links.
+	query url.Values
+}
+
+// Breadcrumb is a link to a parent directory (or the directory itself) of the
+// directory being listed.
+type Breadcrumb struct {
+	Name string
+	URL  string
+}
+
+// ListingEntry is a single file or directory within a directory listing.
+type ListingEntry struct {
+	Name    string
+	URL     string
+	IsDir   bool
+	Size    int64
+	ModTime time.Time
+	// Checksum of the file contents, formatted as 'algorithm:hex', if
+	// requested.
+	Checksum string
+}
+
+// SortURL returns the query used to sort the listing by key. If the listing is
+// already sorted by key then the order is reversed. Other query parameters of
+// the request (such as an access key) are kept, except for the offset as the
+// sorted listing starts from its first page.
+func (listing Listing) SortURL(key string) string {
+	order := "asc"
+	if listing.Sort == key && listing.Order == "asc" {
+		order = "desc"
+	}
+	query := url.Values{}
+	for param, values := range listing.query {
+		query[param] = values
+	}
+	query.Del("offset")
+	query.Set("sort", key)
+	query.Set("order", order)
+	return "?" + query.Encode()
+}
+
+var (
+	// listingFuncs are made available to all listing templates.
+	listingFuncs = template.FuncMap{
+		"humanSize": humanSize,
+	}
+
+	// DefaultListingTemplate is used to render directory listings when no
+	// other template is provided.
+	DefaultListingTemplate = template.Must(
+		template.New("listing").Funcs(listingFuncs).Parse(defaultListingHTML),
+	)
+)
+
+// ParseListingTemplate parses the file as an 'html/template' for rendering
+// directory listings. The template is executed with a Listing and may use the
+// 'humanSize' function to format file sizes.
+func ParseListingTemplate(filename string) (*template.Template, error) {
+	return template.New(filepath.Base(filename)).Funcs(listingFuncs).ParseFiles(filename)
+}
+
+// WithListing returns a function that renders directory listings using the
+// template in place of the listing provided by the wrapped function. The
+// listing is sorted using the 'sort' ('name', 'size' or 'time') and 'order'
+// ('asc' or 'desc') query parameters. Directories containing an index file and
+// all other requests are passed to the wrapped function. Breadcrumbs start
+// from the URL prefix.
+//
+// Listings are returned as JSON, NDJSON or CSV in place of HTML when requested
+// with the 'format' query parameter ('json', 'ndjson' or 'csv') or the 'Accept'
+// header. Entries are paginated with the 'offset' and 'limit' query parameters
+// and include checksums of files if requested with the 'checksum' query
+// parameter ('md5', 'sha1' or 'sha256').
+func WithListing(serveFile FileServerFunc, fsys fs.FS, tmpl *template.Template, urlPrefix string) FileServerFunc {
+	return func(w http.ResponseWriter, r *http.Request, name string) {
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			serveFile(w, r, name)
+			return
+		}
+		dirname := fsName(name)
+		if stat, err := fs.Stat(fsys, dirname); nil != err || !stat.IsDir() {
+			serveFile(w, r, name)
+			return
+		}
+		if _, ok := indexFile(fsys, dirname); ok {
+			serveFile(w, r, name)
+			return
+		}
+
+		entries, err := readListing(fsys, dirname)
+		if nil != err {
+			http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		listing := Listing{
+			Path:        r.URL.Path,
+			Breadcrumbs: breadcrumbs(r.URL.Path, urlPrefix),
+			Entries:     entries,
+			query:       r.URL.Query(),
+		}
+		listing.sortBy(r.URL.Query().Get("sort"), r.URL.Query().Get("order"))
+		if err := listing.paginate(r); nil != err {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		algorithm := strings.ToLower(r.URL.Query().Get("checksum"))
+		if _, ok := listingChecksums[algorithm]; !ok && algorithm != "" {
+			http.Error(w, "unknown checksum '"+algorithm+"'", http.StatusBadRequest)
+			return
+		}
+		if err := listing.addChecksums(fsys, dirname, algorithm); nil != err {
+			http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Vary", "Accept")
+		if format := listingFormat(r); format != listingHTML {
+			writeListing(w, listing, format)
+			return
+		}
+
+		if loadSettings().listingReadme {
+			listing.Readme = readmeHTML(fsys, dirname, entries)
+		}
+
+		// Render to a buffer first so that a failing template results in an
+		// error instead of a partial listing.
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, listing); nil != err {
+			http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		buf.WriteTo(w)
+	}
+}
+
+// readListing returns the entries of the directory. Symbolic links are
+// followed, matching the behavior when serving the files themselves.
+func readListing(fsys fs.FS, dirname string) ([]ListingEntry, error) {
+	dirEntries, err := fs.ReadDir(fsys, dirname)
+	if nil != err {
+		return nil, err
+	}
+
+	entries := make([]ListingEntry, 0, len(dirEntries))
+	for _, dirEntry := range dirEntries {
+		name := dirEntry.Name()
+		var stat fs.FileInfo
+		if dirEntry.Type()&fs.ModeSymlink != 0 {
+			stat, err = fs.Stat(fsys, path.Join(dirname, name))
+		} else {
+			stat, err = dirEntry.Info()
+		}
+		if nil != err {
+			continue
+		}
+		entry := ListingEntry{
+			Name:    name,
+			URL:     (&url.URL{Path: name}).String(),
+			IsDir:   stat.IsDir(),
+			Size:    stat.Size(),
+			ModTime: stat.ModTime(),
+		}
+		if entry.IsDir {
+			entry.URL += "/"
+			entry.Size = 0
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// sortBy sorts the entries of the listing with directories first. Unknown keys
+// and orders fallback to sorting by name in ascending order.
+func (listing *Listing) sortBy(key, order string) {
+	if key != "size" && key != "time" {
+		key = "name"
+	}
+	if order != "desc" {
+		order = "asc"
+	}
+	listing.Sort = key
+	listing.Order = order
+
+	entries := listing.Entries
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.IsDir != b.IsDir {
+			return a.IsDir
+		}
+		if order == "desc" {
+			a, b = b, a
+		}
+		switch {
+		case key == "size" && a.Size != b.Size:
+			return a.Size < b.Size
+		case key == "time" && !a.ModTime.Equal(b.ModTime):
+			return a.ModTime.Before(b.ModTime)
+		}
+		return a.Name < b.Name
+	})
+}
+
+// breadcrumbs returns links to each directory from the URL prefix to the
+// requested directory.
+func breadcrumbs(urlPath, urlPrefix string) []Breadcrumb {
+	crumbs := []Breadcrumb{{Name: "/", URL: urlPrefix + "/"}}
+	current := urlPrefix + "/"
+	for _, name := range strings.Split(strings.TrimPrefix(urlPath, urlPrefix), "/") {
+		if name == "" {
+			continue
+		}
+		current += (&url.URL{Path: name}).String() + "/"
+		crumbs = append(crumbs, Breadcrumb{Name: name, URL: current})
+	}
+	return crumbs
+}
+
+// humanSize returns the size in bytes in a human readable format.
+func humanSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+const defaultListingHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Index of {{.Path}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+nav a { text-decoration: none; }
+table { border-collapse: collapse; }
+th, td { padding: 0.2em 1em; text-align: left; }
+td.size { text-align: right; }
+</style>
+</head>
+<body>
+<nav>{{range $index, $crumb := .Breadcrumbs}}{{if gt $index 1}}/{{end}}<a href="{{$crumb.URL}}">{{$crumb.Name}}</a>{{end}}</nav>
+<table>
+<thead>
+<tr>
+<th><a href="{{.SortURL "name"}}">Name</a></th>
+<th><a href="{{.SortURL "size"}}">Size</a></th>
+<th><a href="{{.SortURL "time"}}">Modified</a></th>
+</tr>
+</thead>
+<tbody>
+{{range .Entries}}<tr>
+<td><a href="{{.URL}}">{{.Name}}{{if .IsDir}}/{{end}}</a></td>
+<td class="size">{{if .IsDir}}-{{else}}{{humanSize .Size}}{{end}}</td>
+<td>{{.ModTime.UTC.Format "2006-01-02 15:04:05"}}</td>
+</tr>
+{{end}}</tbody>
+</table>
+{{if .Readme}}<article class="readme">
+{{.Readme}}</article>
+{{end}}</body>
+</html>
+`
@@ -0,0 +1,204 @@
+package handle
+
+import (
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestWithListing(t *testing.T) {
+	prefix := "/my/prefix"
+	names := template.Must(template.New("names").Funcs(listingFuncs).Parse(
+		`{{range .Entries}}{{.URL}}:{{humanSize .Size}},{{end}}`,
+	))
+	crumbs := template.Must(template.New("crumbs").Parse(
+		`{{range .Breadcrumbs}}{{.Name}}={{.URL}},{{end}}`,
+	))
+	broken := template.Must(template.New("broken").Parse(`{{.Missing}}`))
+
+	testCases := []struct {
+		name     string
+		handler  http.HandlerFunc
+		path     string
+		code     int
+		contents string
+	}{
+		{
+			"Good base dir", Basic(WithListing(serveLocal, localFS, names, "")),
+			"/", ok, tmpIndex,
+		},
+		{
+			"Good base file", Basic(WithListing(serveLocal, localFS, names, "")),
+			"/" + tmpFileName, ok, tmpFile,
+		},
+		{
+			"Bad base dir", Basic(WithListing(serveLocal, localFS, names, "")),
+			"/bad/", missing, notFound,
+		},
+		{
+			"Dir without trailing slash", Basic(WithListing(serveLocal, localFS, names, "")),
+			"/listing", redirect, nothing,
+		},
+		{
+			"Sort by name", Basic(WithListing(serveLocal, localFS, names, "")),
+			"/" + tmpListingDir, ok, "c/:0 B,a.txt:3 B,b.txt:1 B,",
+		},
+		{
+			"Sort by name desc", Basic(WithListing(serveLocal, localFS, names, "")),
+			"/" + tmpListingDir + "?sort=name&order=desc", ok, "c/:0 B,b.txt:1 B,a.txt:3 B,",
+		},
+		{
+			"Sort by size", Basic(WithListing(serveLocal, localFS, names, "")),
+			"/" + tmpListingDir + "?sort=size", ok, "c/:0 B,b.txt:1 B,a.txt:3 B,",
+		},
+		{
+			"Sort by size desc", Basic(WithListing(serveLocal, localFS, names, "")),
+			"/" + tmpListingDir + "?sort=size&order=desc", ok, "c/:0 B,a.txt:3 B,b.txt:1 B,",
+		},
+		{
+			"Breadcrumbs", Basic(WithListing(serveLocal, localFS, crumbs, "")),
+			"/listing/c/", ok, "/=/,listing=/listing/,c=/listing/c/,",
+		},
+		{
+			"Breadcrumbs w/prefix", Prefix(WithListing(serveLocal, localFS, crumbs, prefix), prefix),
+			prefix + "/listing/c/", ok,
+			"/=/my/prefix/,listing=/my/prefix/listing/,c=/my/prefix/listing/c/,",
+		},
+		{
+			"Broken template", Basic(WithListing(serveLocal, localFS, broken, "")),
+			"/" + tmpListingDir, http.StatusInternalServerError, "500 Internal Server Error\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fullpath := "http://localhost" + tc.path
+			req := httptest.NewRequest("GET", fullpath, nil)
+			w := httptest.NewRecorder()
+
+			tc.handler(w, req)
+
+			resp := w.Result()
+			body, err := ioutil.ReadAll(resp.Body)
+			if nil != err {
+				t.Errorf("While reading body got %v", err)
+			}
+			contents := string(body)
+			if tc.code != resp.StatusCode {
+				t.Errorf(
+					"While retrieving %s expected status code of %d but got %d",
+					fullpath, tc.code, resp.StatusCode,
+				)
+			}
+			if tc.contents != contents {
+				t.Errorf(
+					"While retrieving %s expected contents '%s' but got '%s'",
+					fullpath, tc.contents, contents,
+				)
+			}
+		})
+	}
+}
+
+func TestDefaultListingTemplate(t *testing.T) {
+	handler := Basic(WithListing(serveLocal, localFS, DefaultListingTemplate, ""))
+
+	req := httptest.NewRequest("GET", "http://localhost/"+tmpListingDir, nil)
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	resp := w.Result()
+	body, err := ioutil.ReadAll(resp.Body)
+	if nil != err {
+		t.Errorf("While reading body got %v", err)
+	}
+	if ok != resp.StatusCode {
+		t.Errorf("Expected status code of %d but got %d", ok, resp.StatusCode)
+	}
+	if contentType := resp.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "text/html") {
+		t.Errorf("Expected HTML content type but got '%s'", contentType)
+	}
+	for _, expected := range []string{`href="a.txt"`, `href="c/"`, `href="?order=desc&amp;sort=name"`} {
+		if !strings.Contains(string(body), expected) {
+			t.Errorf("Expected listing to contain '%s' but got '%s'", expected, body)
+		}
+	}
+}
+
+func TestParseListingTemplate(t *testing.T) {
+	filename := baseDir + "listing.tmpl"
+	if err := ioutil.WriteFile(filename, []byte(`{{humanSize 2048}}`), 0600); nil != err {
+		t.Fatalf("While writing template got %v", err)
+	}
+	defer os.Remove(filename)
+
+	tmpl, err := ParseListingTemplate(filename)
+	if nil != err {
+		t.Fatalf("While parsing template expected nil but got %v", err)
+	}
+	var result strings.Builder
+	if err := tmpl.Execute(&result, Listing{}); nil != err {
+		t.Errorf("While executing template expected nil but got %v", err)
+	}
+	if "2.0 KiB" != result.String() {
+		t.Errorf("Expected '2.0 KiB' but got '%s'", result.String())
+	}
+
+	if _, err := ParseListingTemplate(baseDir + tmpBadName); nil == err {
+		t.Error("While parsing missing template expected error but got nil")
+	}
+}
+
+func TestHumanSize(t *testing.T) {
+	testCases := []struct {
+		size   int64
+		result string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{1536, "1.5 KiB"},
+		{1024 * 1024, "1.0 MiB"},
+		{5 * 1024 * 1024 * 1024, "5.0 GiB"},
+	}
+
+	for _, tc := range testCases {
+		if result := humanSize(tc.size); tc.result != result {
+			t.Errorf("For %d expected '%s' but got '%s'", tc.size, tc.result, result)
+		}
+	}
+}
+
+func TestListingSortURLAccessKey(t *testing.T) {
+	accessKey := "secret"
+	handler := AddAccessKey(Basic(WithListing(serveLocal, localFS, DefaultListingTemplate, "")), accessKey)
+
+	path := "http://localhost/" + tmpListingDir
+	req := httptest.NewRequest("GET", path+"?key="+accessKey+"&limit=1&offset=1", nil)
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	resp := w.Result()
+	body, err := ioutil.ReadAll(resp.Body)
+	if nil != err {
+		t.Errorf("While reading body got %v", err)
+	}
+	if ok != resp.StatusCode {
+		t.Fatalf("Expected status code of %d but got %d", ok, resp.StatusCode)
+	}
+	expected := `href="?key=secret&amp;limit=1&amp;order=asc&amp;sort=size"`
+	if !strings.Contains(string(body), expected) {
+		t.Fatalf("Expected listing to contain '%s' but got '%s'", expected, body)
+	}
+
+	req = httptest.NewRequest("GET", path+"?key="+accessKey+"&limit=1&order=asc&sort=size", nil)
+	w = httptest.NewRecorder()
+	handler(w, req)
+	if resp := w.Result(); ok != resp.StatusCode {
+		t.Errorf("While following sort link expected status code of %d but got %d", ok, resp.StatusCode)
+	}
+}
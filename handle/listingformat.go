@@ -0,0 +1,220 @@
+package handle
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Formats in which directory listings can be returned.
+const (
+	listingHTML   = "html"
+	listingJSON   = "json"
+	listingNDJSON = "ndjson"
+	listingCSV    = "csv"
+)
+
+var (
+	// listingMediaTypes maps the media types accepted by clients to listing
+	// formats.
+	listingMediaTypes = map[string]string{
+		"text/html":             listingHTML,
+		"application/xhtml+xml": listingHTML,
+		"application/json":      listingJSON,
+		"application/x-ndjson":  listingNDJSON,
+		"application/jsonlines": listingNDJSON,
+		"text/csv":              listingCSV,
+	}
+
+	// listingChecksums are the hashing algorithms available for checksums of
+	// the files within a listing.
+	listingChecksums = map[string]func() hash.Hash{
+		"md5":    md5.New,
+		"sha1":   sha1.New,
+		"sha256": sha256.New,
+	}
+)
+
+// listingFormat returns the format of the directory listing requested by the
+// 'format' query parameter or, if not set, by the 'Accept' header. HTML is
+// used if no known format is requested.
+func listingFormat(r *http.Request) string {
+	if format := strings.ToLower(r.URL.Query().Get("format")); format != "" {
+		switch format {
+		case listingJSON, listingNDJSON, listingCSV:
+			return format
+		}
+		return listingHTML
+	}
+	for _, mediaRange := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+		if nil != err {
+			continue
+		}
+		if format, ok := listingMediaTypes[mediaType]; ok {
+			return format
+		}
+	}
+	return listingHTML
+}
+
+// paginate limits the listing entries to those selected by the 'offset' and
+// 'limit' query parameters. A limit of zero (default) returns all entries
+// after the offset.
+func (listing *Listing) paginate(r *http.Request) error {
+	query := r.URL.Query()
+	listing.Total = len(listing.Entries)
+	var err error
+	if value := query.Get("offset"); value != "" {
+		if listing.Offset, err = strconv.Atoi(value); nil != err || listing.Offset < 0 {
+			return fmt.Errorf("invalid offset '%s'", value)
+		}
+	}
+	if value := query.Get("limit"); value != "" {
+		if listing.Limit, err = strconv.Atoi(value); nil != err || listing.Limit < 0 {
+			return fmt.Errorf("invalid limit '%s'", value)
+		}
+	}
+
+	start := listing.Offset
+	if start > listing.Total {
+		start = listing.Total
+	}
+	end := listing.Total
+	// Compared with the remaining entries, as the offset and limit can add up
+	// to more than the largest int.
+	if 0 < listing.Limit && listing.Limit < end-start {
+		end = start + listing.Limit
+		query.Set("offset", strconv.Itoa(end))
+		listing.NextURL = "?" + query.Encode()
+	}
+	listing.Entries = listing.Entries[start:end]
+	return nil
+}
+
+// addChecksums to the files of the listing using the hashing algorithm, if
+// any.
+func (listing *Listing) addChecksums(fsys fs.FS, dirname, algorithm string) error {
+	newHash, ok := listingChecksums[algorithm]
+	if !ok {
+		return nil
+	}
+	for index, entry := range listing.Entries {
+		if entry.IsDir {
+			continue
+		}
+		sum, err := checksum(fsys, path.Join(dirname, entry.Name), newHash())
+		if nil != err {
+			return err
+		}
+		listing.Entries[index].Checksum = algorithm + ":" + sum
+	}
+	return nil
+}
+
+// checksum returns the hex-encoded hash of the contents of the named file.
+func checksum(fsys fs.FS, name string, h hash.Hash) (string, error) {
+	file, err := fsys.Open(name)
+	if nil != err {
+		return "", err
+	}
+	defer file.Close()
+	if _, err = io.Copy(h, file); nil != err {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// listingRecord is the machine-readable representation of a listing entry.
+type listingRecord struct {
+	Name     string    `json:"name"`
+	Type     string    `json:"type"`
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"mtime"`
+	URL      string    `json:"url"`
+	Checksum string    `json:"checksum,omitempty"`
+}
+
+// records returns the listing entries in their machine-readable form.
+func (listing Listing) records() []listingRecord {
+	records := make([]listingRecord, len(listing.Entries))
+	for index, entry := range listing.Entries {
+		records[index] = listingRecord{
+			Name:     entry.Name,
+			Type:     "file",
+			Size:     entry.Size,
+			ModTime:  entry.ModTime.UTC(),
+			URL:      entry.URL,
+			Checksum: entry.Checksum,
+		}
+		if entry.IsDir {
+			records[index].Type = "dir"
+		}
+	}
+	return records
+}
+
+// writeListing writes the listing in the machine-readable format. For JSON,
+// the entries are wrapped in an object with the pagination details. For NDJSON
+// and CSV, the pagination details are only available from the 'Link' header.
+func writeListing(w http.ResponseWriter, listing Listing, format string) error {
+	if listing.NextURL != "" {
+		w.Header().Set("Link", "<"+listing.NextURL+`>; rel="next"`)
+	}
+	records := listing.records()
+
+	switch format {
+	case listingJSON:
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(struct {
+			Path    string          `json:"path"`
+			Total   int             `json:"total"`
+			Offset  int             `json:"offset"`
+			Limit   int             `json:"limit"`
+			Next    string          `json:"next,omitempty"`
+			Entries []listingRecord `json:"entries"`
+		}{listing.Path, listing.Total, listing.Offset, listing.Limit, listing.NextURL, records})
+
+	case listingNDJSON:
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		encoder := json.NewEncoder(w)
+		for _, record := range records {
+			if err := encoder.Encode(record); nil != err {
+				return err
+			}
+		}
+		return nil
+
+	case listingCSV:
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		writer := csv.NewWriter(w)
+		writer.Write([]string{"name", "type", "size", "mtime", "url", "checksum"})
+		for _, record := range records {
+			writer.Write([]string{
+				record.Name,
+				record.Type,
+				strconv.FormatInt(record.Size, 10),
+				record.ModTime.Format(time.RFC3339),
+				record.URL,
+				record.Checksum,
+			})
+		}
+		writer.Flush()
+		return writer.Error()
+	}
+	return errors.New("unknown listing format " + format)
+}
@@ -0,0 +1,176 @@
+package handle
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWithListingFormats(t *testing.T) {
+	handler := Basic(WithListing(serveLocal, localFS, DefaultListingTemplate, ""))
+	sum := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("aaa")))
+
+	testCases := []struct {
+		name        string
+		query       string
+		accept      string
+		code        int
+		contentType string
+		contents    []string
+		link        string
+	}{
+		{
+			"JSON with query", "?format=json", "", ok, "application/json",
+			[]string{`"total":3`, `"name":"c","type":"dir"`, `"name":"a.txt","type":"file","size":3`}, "",
+		},
+		{
+			"JSON with accept", "", "application/json", ok, "application/json",
+			[]string{`"path":"/listing/"`, `"url":"b.txt"`}, "",
+		},
+		{
+			"HTML preferred by accept", "", "text/html,application/json", ok, "text/html; charset=utf-8",
+			[]string{`href="a.txt"`}, "",
+		},
+		{
+			"NDJSON", "?format=ndjson", "", ok, "application/x-ndjson",
+			[]string{"{\"name\":\"c\"", "\n{\"name\":\"a.txt\"", "\n{\"name\":\"b.txt\""}, "",
+		},
+		{
+			"CSV", "?format=csv&sort=size", "text/html", ok, "text/csv; charset=utf-8",
+			[]string{"name,type,size,mtime,url,checksum\nc,dir,0,", "\nb.txt,file,1,", "\na.txt,file,3,"}, "",
+		},
+		{
+			"Paginated", "?format=json&limit=1&offset=1", "", ok, "application/json",
+			[]string{`"total":3,"offset":1,"limit":1`, `"name":"a.txt"`},
+			`<?format=json&limit=1&offset=2>; rel="next"`,
+		},
+		{
+			"Last page", "?format=json&limit=2&offset=1", "", ok, "application/json",
+			[]string{`"name":"a.txt"`, `"name":"b.txt"`}, "",
+		},
+		{
+			"Past last page", "?format=json&offset=10", "", ok, "application/json",
+			[]string{`"entries":[]`}, "",
+		},
+		{
+			"Largest limit", "?format=json&offset=1&limit=9223372036854775807", "", ok, "application/json",
+			[]string{`"name":"a.txt"`, `"name":"b.txt"`}, "",
+		},
+		{
+			"Bad limit", "?format=json&limit=-1", "", http.StatusBadRequest, "text/plain; charset=utf-8",
+			[]string{"invalid limit"}, "",
+		},
+		{
+			"Bad offset", "?format=json&offset=first", "", http.StatusBadRequest, "text/plain; charset=utf-8",
+			[]string{"invalid offset"}, "",
+		},
+		{
+			"Checksum", "?format=json&checksum=sha256", "", ok, "application/json",
+			[]string{`"checksum":"` + sum + `"`}, "",
+		},
+		{
+			"Bad checksum", "?format=json&checksum=crc32", "", http.StatusBadRequest, "text/plain; charset=utf-8",
+			[]string{"unknown checksum"}, "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fullpath := "http://localhost/" + tmpListingDir + tc.query
+			req := httptest.NewRequest("GET", fullpath, nil)
+			req.Header.Set("Accept", tc.accept)
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			resp := w.Result()
+			body, err := ioutil.ReadAll(resp.Body)
+			if nil != err {
+				t.Errorf("While reading body got %v", err)
+			}
+			if tc.code != resp.StatusCode {
+				t.Errorf(
+					"While retrieving %s expected status code of %d but got %d",
+					fullpath, tc.code, resp.StatusCode,
+				)
+			}
+			if contentType := resp.Header.Get("Content-Type"); tc.contentType != contentType {
+				t.Errorf(
+					"While retrieving %s expected content type '%s' but got '%s'",
+					fullpath, tc.contentType, contentType,
+				)
+			}
+			if link := resp.Header.Get("Link"); tc.link != link {
+				t.Errorf(
+					"While retrieving %s expected link '%s' but got '%s'",
+					fullpath, tc.link, link,
+				)
+			}
+			for _, expected := range tc.contents {
+				if !strings.Contains(string(body), expected) {
+					t.Errorf(
+						"While retrieving %s expected contents to contain '%s' but got '%s'",
+						fullpath, expected, body,
+					)
+				}
+			}
+		})
+	}
+}
+
+func TestWithListingJSONDecodes(t *testing.T) {
+	handler := Basic(WithListing(serveLocal, localFS, DefaultListingTemplate, ""))
+	req := httptest.NewRequest("GET", "http://localhost/"+tmpListingDir+"?format=json", nil)
+	w := httptest.NewRecorder()
+
+	handler(w, req)
+
+	var result struct {
+		Entries []listingRecord `json:"entries"`
+	}
+	if err := json.NewDecoder(w.Result().Body).Decode(&result); nil != err {
+		t.Fatalf("While decoding listing got %v", err)
+	}
+	if 3 != len(result.Entries) {
+		t.Fatalf("Expected 3 entries but got %d", len(result.Entries))
+	}
+	if result.Entries[1].ModTime.IsZero() {
+		t.Error("Expected modification time to be set")
+	}
+}
+
+func TestListingFormat(t *testing.T) {
+	testCases := []struct {
+		name   string
+		query  string
+		accept string
+		result string
+	}{
+		{"Nothing", "", "", listingHTML},
+		{"Query JSON", "?format=json", "text/html", listingJSON},
+		{"Query NDJSON", "?format=NDJSON", "", listingNDJSON},
+		{"Query CSV", "?format=csv", "", listingCSV},
+		{"Query unknown", "?format=xml", "application/json", listingHTML},
+		{"Accept JSON", "", "application/json", listingJSON},
+		{"Accept JSON w/params", "", "application/json; q=0.9", listingJSON},
+		{"Accept NDJSON", "", "application/x-ndjson", listingNDJSON},
+		{"Accept CSV", "", "text/csv", listingCSV},
+		{"Accept browser", "", "text/html,application/xhtml+xml,*/*;q=0.8", listingHTML},
+		{"Accept anything", "", "*/*", listingHTML},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://localhost/"+tc.query, nil)
+			req.Header.Set("Accept", tc.accept)
+			if result := listingFormat(req); tc.result != result {
+				t.Errorf("Expected '%s' but got '%s'", tc.result, result)
+			}
+		})
+	}
+}
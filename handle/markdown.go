@@ -0,0 +1,211 @@
+package handle
+
+import (
+	"bytes"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MarkdownPage is the data passed to the template rendering a Markdown file.
+type MarkdownPage struct {
+	// Path of the file, as requested in the URL.
+	Path string
+	// Title is the text of the first level 1 heading or, if there is none, the
+	// name of the file.
+	Title   string
+	Content template.HTML
+	// Stylesheet is the URL of the configured stylesheet, if any.
+	Stylesheet string
+	// RawURL is the URL of the Markdown source of the file.
+	RawURL string
+}
+
+var (
+	// DefaultMarkdownTemplate is used to render Markdown files when no other
+	// template is provided.
+	DefaultMarkdownTemplate = template.Must(
+		template.New("markdown").Parse(defaultMarkdownHTML),
+	)
+)
+
+// ParseMarkdownTemplate parses the file as an 'html/template' for rendering
+// Markdown files. The template is executed with a MarkdownPage.
+func ParseMarkdownTemplate(filename string) (*template.Template, error) {
+	return template.New(filepath.Base(filename)).ParseFiles(filename)
+}
+
+// maxRenderedMarkdown is the number of rendered Markdown files kept by each
+// handler serving them.
+const maxRenderedMarkdown = 256
+
+// renderedMarkdown caches the HTML rendered from Markdown files, so that files
+// are only rendered again when their modification time or size changes.
+type renderedMarkdown struct {
+	mutex sync.Mutex
+	files map[string]markdownHTML
+}
+
+// markdownHTML is the HTML and title rendered from a version of a file.
+type markdownHTML struct {
+	modTime time.Time
+	size    int64
+	content string
+	title   string
+}
+
+// render returns the HTML and title rendered from the named file of the stat.
+func (rendered *renderedMarkdown) render(fsys fs.FS, name string, stat fs.FileInfo) (markdownHTML, error) {
+	rendered.mutex.Lock()
+	file, ok := rendered.files[name]
+	rendered.mutex.Unlock()
+	if ok && file.modTime.Equal(stat.ModTime()) && file.size == stat.Size() {
+		return file, nil
+	}
+
+	// The file is rendered without holding the lock so that other files aren't
+	// kept waiting.
+	source, err := fs.ReadFile(fsys, name)
+	if nil != err {
+		return markdownHTML{}, err
+	}
+	file = markdownHTML{modTime: stat.ModTime(), size: stat.Size()}
+	file.content, file.title = markdownToHTML(string(source))
+
+	rendered.mutex.Lock()
+	defer rendered.mutex.Unlock()
+	if _, ok := rendered.files[name]; !ok && maxRenderedMarkdown <= len(rendered.files) {
+		for evicted := range rendered.files {
+			delete(rendered.files, evicted)
+			break
+		}
+	}
+	rendered.files[name] = file
+	return file, nil
+}
+
+// SetListingReadme to render the 'README.md' file of directories beneath their
+// listing.
+func (s *Settings) SetListingReadme(enabled bool) {
+	s.listingReadme = enabled
+}
+
+// WithMarkdown returns a function that serves Markdown files ('.md' and
+// '.markdown'), including Markdown index files of directories, rendered as
+// HTML with the template when HTML is requested with the 'Accept' header, as it
+// is by browsers. The Markdown source is served for other 'Accept' headers and
+// when requested with the 'raw' query parameter or as a download. The template
+// is executed with the URL of the stylesheet, if set. Rendered files are cached
+// until they change.
+func WithMarkdown(serveFile FileServerFunc, fsys fs.FS, tmpl *template.Template, stylesheet string) FileServerFunc {
+	rendered := &renderedMarkdown{files: map[string]markdownHTML{}}
+	return func(w http.ResponseWriter, r *http.Request, name string) {
+		filename := fsName(name)
+		if strings.HasSuffix(name, "/") {
+			filename, _ = indexFile(fsys, filename)
+		}
+		query := r.URL.Query()
+		_, raw := query["raw"]
+		_, download := query["download"]
+		_, named := query["filename"]
+		if !isMarkdown(filename) || raw || download || named {
+			serveFile(w, r, name)
+			return
+		}
+
+		w.Header().Add("Vary", "Accept")
+		if !strings.Contains(r.Header.Get("Accept"), "text/html") {
+			serveFile(w, r, name)
+			return
+		}
+		stat, err := fs.Stat(fsys, filename)
+		if nil != err || !stat.Mode().IsRegular() {
+			serveFile(w, r, name)
+			return
+		}
+		file, err := rendered.render(fsys, filename, stat)
+		if nil != err {
+			http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		title := file.title
+		if title == "" {
+			title = path.Base(filename)
+		}
+		// Keep the query (such as an access key) for the link to the source.
+		query.Set("raw", "")
+		page := MarkdownPage{
+			Path:       r.URL.Path,
+			Title:      title,
+			Content:    template.HTML(file.content),
+			Stylesheet: stylesheet,
+			RawURL:     r.URL.Path + "?" + query.Encode(),
+		}
+
+		// Render to a buffer first so that a failing template results in an
+		// error instead of a partial page.
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, page); nil != err {
+			http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		http.ServeContent(w, r, "", stat.ModTime(), bytes.NewReader(buf.Bytes()))
+	}
+}
+
+// isMarkdown returns true if the name has the extension of a Markdown file.
+func isMarkdown(name string) bool {
+	ext := strings.ToLower(path.Ext(name))
+	return ext == ".md" || ext == ".markdown"
+}
+
+// readmeHTML returns the rendered README file ('README.md' in any case) of the
+// entries of the directory, if any.
+func readmeHTML(fsys fs.FS, dirname string, entries []ListingEntry) template.HTML {
+	for _, entry := range entries {
+		base := strings.TrimSuffix(entry.Name, path.Ext(entry.Name))
+		if entry.IsDir || !isMarkdown(entry.Name) || !strings.EqualFold(base, "readme") {
+			continue
+		}
+		source, err := fs.ReadFile(fsys, path.Join(dirname, entry.Name))
+		if nil != err {
+			continue
+		}
+		content, _ := markdownToHTML(string(source))
+		return template.HTML(content)
+	}
+	return ""
+}
+
+// defaultMarkdownHTML is the built-in template for rendering Markdown files.
+const defaultMarkdownHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+{{if .Stylesheet}}<link rel="stylesheet" href="{{.Stylesheet}}">
+{{else}}<style>
+body { font-family: sans-serif; line-height: 1.5; max-width: 50em; margin: 2em auto; padding: 0 1em; }
+pre { background: #f6f8fa; padding: 1em; overflow: auto; }
+code { background: #f6f8fa; padding: 0.1em 0.3em; }
+pre code { padding: 0; }
+blockquote { border-left: 0.25em solid #ddd; color: #555; margin: 0; padding: 0 1em; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ddd; padding: 0.3em 0.8em; }
+img { max-width: 100%; }
+</style>
+{{end}}</head>
+<body>
+<article class="markdown">
+{{.Content}}</article>
+</body>
+</html>
+`
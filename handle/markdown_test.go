@@ -0,0 +1,177 @@
+package handle
+
+import (
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestWithMarkdown(t *testing.T) {
+	activateSettings(t, func(s *Settings) {
+		s.SetIndexFiles([]string{"index.html", "README.md"})
+	})
+
+	fsys := fstest.MapFS{
+		"guide.md":         {Data: []byte("# Guide\n\nRead *this*.")},
+		"notes.markdown":   {Data: []byte("Just notes.")},
+		"notes.txt":        {Data: []byte("# Not Markdown")},
+		"docs/README.md":   {Data: []byte("# Docs")},
+		"site/index.html":  {Data: []byte("site")},
+		"site/README.md":   {Data: []byte("# Site")},
+		"folder.md/a.txt":  {Data: []byte("a")},
+		"templated/pub.md": {Data: []byte("# Pub")},
+	}
+	tmpl := template.Must(template.New("custom").Parse(
+		`{{.Title}}|{{.Stylesheet}}|{{.RawURL}}|{{.Content}}`,
+	))
+	handler := Basic(WithMarkdown(ServeFS(fsys), fsys, DefaultMarkdownTemplate, ""))
+	custom := Basic(WithMarkdown(ServeFS(fsys), fsys, tmpl, "/style.css"))
+	keyed := AddAccessKey(custom, "secret")
+
+	html := "text/html,application/xhtml+xml,*/*;q=0.8"
+	testCases := []struct {
+		name        string
+		handler     http.HandlerFunc
+		path        string
+		accept      string
+		code        int
+		contentType string
+		contents    string
+	}{
+		{"Rendered", handler, "/guide.md", html, ok, "text/html; charset=utf-8", "<p>Read <em>this</em>.</p>"},
+		{"Rendered title", handler, "/guide.md", html, ok, "text/html; charset=utf-8", "<title>Guide</title>"},
+		{"Rendered style", handler, "/guide.md", html, ok, "text/html; charset=utf-8", "<style>"},
+		{"File name title", handler, "/notes.markdown", html, ok, "text/html; charset=utf-8", "<title>notes.markdown</title>"},
+		{"Raw", handler, "/guide.md?raw", html, ok, "text/markdown; charset=utf-8", "# Guide"},
+		{"Download", handler, "/guide.md?download", html, ok, "text/markdown; charset=utf-8", "# Guide"},
+		{"Not HTML", handler, "/guide.md", "*/*", ok, "text/markdown; charset=utf-8", "# Guide"},
+		{"Not Markdown", handler, "/notes.txt", html, ok, "text/plain; charset=utf-8", "# Not Markdown"},
+		{"Index", handler, "/docs/", html, ok, "text/html; charset=utf-8", `<h1 id="docs">Docs</h1>`},
+		{"Preferred index", handler, "/site/", html, ok, "text/html; charset=utf-8", "site"},
+		{"Directory", handler, "/folder.md", html, redirect, "", ""},
+		{"Missing", handler, "/missing.md", html, missing, "text/plain; charset=utf-8", notFound},
+		{"Custom template", custom, "/templated/pub.md", html, ok, "text/html; charset=utf-8", `Pub|/style.css|/templated/pub.md?raw=|<h1 id="pub">Pub</h1>`},
+		{"Access key", keyed, "/templated/pub.md?key=secret", html, ok, "text/html; charset=utf-8", `|/templated/pub.md?key=secret&amp;raw=|`},
+		{"Access key raw", keyed, "/templated/pub.md?key=secret&raw=", html, ok, "text/markdown; charset=utf-8", "# Pub"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fullpath := "http://localhost" + tc.path
+			req := httptest.NewRequest("GET", fullpath, nil)
+			req.Header.Set("Accept", tc.accept)
+			w := httptest.NewRecorder()
+
+			tc.handler(w, req)
+
+			if tc.code != w.Code {
+				t.Errorf(
+					"While retrieving %s expected status code of %d but got %d",
+					fullpath, tc.code, w.Code,
+				)
+			}
+			if result := w.Header().Get("Content-Type"); tc.code != redirect && tc.contentType != result {
+				t.Errorf(
+					"While retrieving %s expected content type '%s' but got '%s'",
+					fullpath, tc.contentType, result,
+				)
+			}
+			if !strings.Contains(w.Body.String(), tc.contents) {
+				t.Errorf(
+					"While retrieving %s expected contents with '%s' but got '%s'",
+					fullpath, tc.contents, w.Body.String(),
+				)
+			}
+		})
+	}
+}
+
+func TestMarkdownRenderCache(t *testing.T) {
+	fsys := fstest.MapFS{
+		"guide.md": {Data: []byte("# Old")},
+	}
+	rendered := &renderedMarkdown{files: map[string]markdownHTML{}}
+	title := func() string {
+		stat, err := fs.Stat(fsys, "guide.md")
+		if nil != err {
+			t.Fatalf("While getting stats of guide.md got %v", err)
+		}
+		file, err := rendered.render(fsys, "guide.md", stat)
+		if nil != err {
+			t.Fatalf("While rendering guide.md got %v", err)
+		}
+		return file.title
+	}
+	if result := title(); "Old" != result {
+		t.Errorf("Expected title 'Old' but got '%s'", result)
+	}
+
+	fsys["guide.md"].Data = []byte("# New")
+	if result := title(); "Old" != result {
+		t.Errorf("Before a change expected cached title 'Old' but got '%s'", result)
+	}
+
+	fsys["guide.md"].ModTime = time.Now()
+	if result := title(); "New" != result {
+		t.Errorf("After a change expected title 'New' but got '%s'", result)
+	}
+
+	for index := 0; index < 2*maxRenderedMarkdown; index++ {
+		name := fmt.Sprintf("%d.md", index)
+		fsys[name] = &fstest.MapFile{Data: []byte("# Page")}
+		stat, _ := fs.Stat(fsys, name)
+		if _, err := rendered.render(fsys, name, stat); nil != err {
+			t.Fatalf("While rendering %s got %v", name, err)
+		}
+	}
+	if maxRenderedMarkdown < len(rendered.files) {
+		t.Errorf("Expected at most %d rendered files but got %d", maxRenderedMarkdown, len(rendered.files))
+	}
+}
+
+func TestListingReadme(t *testing.T) {
+	fsys := fstest.MapFS{
+		"docs/Readme.md":   {Data: []byte("# About the *docs*")},
+		"docs/file.txt":    {Data: []byte("file")},
+		"other/readme.txt": {Data: []byte("not Markdown")},
+	}
+	handler := Basic(WithListing(ServeFS(fsys), fsys, DefaultListingTemplate, ""))
+
+	testCases := []struct {
+		name    string
+		enabled bool
+		path    string
+		readme  string
+	}{
+		{"Readme", true, "/docs/", `<article class="readme">
+<h1 id="about-the-docs">About the <em>docs</em></h1>
+</article>`},
+		{"Disabled", false, "/docs/", ""},
+		{"Not Markdown", true, "/other/", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			activateSettings(t, func(s *Settings) { s.SetListingReadme(tc.enabled) })
+			fullpath := "http://localhost" + tc.path
+			req := httptest.NewRequest("GET", fullpath, nil)
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			body := w.Body.String()
+			if tc.readme == "" && strings.Contains(body, `class="readme"`) {
+				t.Errorf("While retrieving %s expected no readme but got '%s'", fullpath, body)
+			}
+			if !strings.Contains(body, tc.readme) {
+				t.Errorf("While retrieving %s expected readme '%s' but got '%s'", fullpath, tc.readme, body)
+			}
+		})
+	}
+}
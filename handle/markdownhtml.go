@@ -0,0 +1,823 @@
+package handle
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// markdownToHTML renders Markdown as HTML. The subset of CommonMark and GitHub
+// Flavored Markdown common in README files is supported: headings, paragraphs,
+// emphasis, code spans and blocks, links, images, block quotes, lists (with
+// task list items), tables and thematic breaks. Raw HTML is escaped and links
+// with schemes other than 'http', 'https' and 'mailto' are removed, so that
+// rendered files can't run scripts. The title is the text of the first level 1
+// heading, if any.
+func markdownToHTML(source string) (content, title string) {
+	source = strings.ReplaceAll(source, "\r\n", "\n")
+	source = strings.ReplaceAll(source, "\t", "    ")
+	renderer := &markdownRenderer{ids: map[string]int{}}
+	renderer.blocks(strings.Split(source, "\n"), false)
+	return renderer.out.String(), renderer.title
+}
+
+// markdownRenderer holds the state of rendering a Markdown document.
+type markdownRenderer struct {
+	out   strings.Builder
+	title string
+	// ids counts the uses of heading IDs to keep them unique.
+	ids map[string]int
+}
+
+// blocks renders the lines as blocks. The paragraphs of tight list items are
+// rendered without '<p>' tags.
+func (md *markdownRenderer) blocks(lines []string, tight bool) {
+	for index := 0; index < len(lines); {
+		line := lines[index]
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			index++
+		case indentation(line) >= 4:
+			index = md.indentedCode(lines, index)
+		case isFence(trimmed):
+			index = md.fencedCode(lines, index)
+		case headingLevel(trimmed) > 0:
+			md.heading(headingLevel(trimmed), trimmed)
+			index++
+		case isThematicBreak(trimmed):
+			md.out.WriteString("<hr>\n")
+			index++
+		case strings.HasPrefix(trimmed, ">"):
+			index = md.blockQuote(lines, index)
+		case isListItem(line):
+			index = md.list(lines, index)
+		case index+1 < len(lines) && strings.Contains(line, "|") && isTableDelimiter(lines[index+1]):
+			index = md.table(lines, index)
+		default:
+			index = md.paragraph(lines, index, tight)
+		}
+	}
+}
+
+// indentedCode renders the code block indented by four spaces starting at the
+// index and returns the index of the line following the block.
+func (md *markdownRenderer) indentedCode(lines []string, index int) int {
+	end := index
+	var code []string
+	for ; end < len(lines) && (strings.TrimSpace(lines[end]) == "" || indentation(lines[end]) >= 4); end++ {
+		code = append(code, strings.TrimPrefix(lines[end], "    "))
+	}
+	for len(code) > 0 && strings.TrimSpace(code[len(code)-1]) == "" {
+		code = code[:len(code)-1]
+	}
+	md.out.WriteString("<pre><code>")
+	md.out.WriteString(html.EscapeString(strings.Join(code, "\n")))
+	md.out.WriteString("\n</code></pre>\n")
+	return end
+}
+
+// fencedCode renders the code block fenced by '```' or '~~~' starting at the
+// index and returns the index of the line following the block. The info string
+// following the opening fence sets the language class of the code.
+func (md *markdownRenderer) fencedCode(lines []string, index int) int {
+	opening := strings.TrimSpace(lines[index])
+	fence := opening[:len(opening)-len(strings.TrimLeft(opening, opening[:1]))]
+	language := strings.Fields(strings.TrimSpace(opening[len(fence):]) + " ")
+	indent := indentation(lines[index])
+
+	end := index + 1
+	var code []string
+	for ; end < len(lines); end++ {
+		closing := strings.TrimSpace(lines[end])
+		if strings.HasPrefix(closing, fence) && strings.Trim(closing, fence[:1]) == "" {
+			end++
+			break
+		}
+		line := lines[end]
+		if trim := indentation(line); trim > indent {
+			line = line[indent:]
+		} else {
+			line = line[trim:]
+		}
+		code = append(code, line)
+	}
+
+	md.out.WriteString("<pre><code")
+	if 0 < len(language) {
+		fmt.Fprintf(&md.out, ` class="language-%s"`, html.EscapeString(language[0]))
+	}
+	md.out.WriteString(">")
+	if 0 < len(code) {
+		md.out.WriteString(html.EscapeString(strings.Join(code, "\n")))
+		md.out.WriteString("\n")
+	}
+	md.out.WriteString("</code></pre>\n")
+	return end
+}
+
+// heading renders the ATX heading ('# Heading') of the level with an ID for
+// linking to it.
+func (md *markdownRenderer) heading(level int, line string) {
+	text := strings.TrimSpace(line[level:])
+	if trimmed := strings.TrimRight(text, "#"); trimmed == "" || strings.HasSuffix(trimmed, " ") {
+		text = strings.TrimSpace(trimmed)
+	}
+	md.writeHeading(level, text)
+}
+
+// writeHeading renders the heading of the level with the text.
+func (md *markdownRenderer) writeHeading(level int, text string) {
+	if level == 1 && md.title == "" {
+		md.title = plainText(text)
+	}
+	id := md.headingID(text)
+	fmt.Fprintf(&md.out, "<h%d id=\"%s\">%s</h%d>\n", level, id, inlineHTML(text), level)
+}
+
+// headingID returns a unique ID for the heading text, formatted like those of
+// GitHub (e.g. 'getting-started').
+func (md *markdownRenderer) headingID(text string) string {
+	var id strings.Builder
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-':
+			id.WriteRune(r)
+		case r == ' ':
+			id.WriteRune('-')
+		}
+	}
+	base := id.String()
+	count := md.ids[base]
+	md.ids[base]++
+	if count == 0 {
+		return html.EscapeString(base)
+	}
+	return html.EscapeString(base + "-" + strconv.Itoa(count))
+}
+
+// blockQuote renders the block quote starting at the index and returns the
+// index of the line following the quote.
+func (md *markdownRenderer) blockQuote(lines []string, index int) int {
+	var quoted []string
+	end := index
+	for ; end < len(lines) && strings.TrimSpace(lines[end]) != ""; end++ {
+		line := strings.TrimSpace(lines[end])
+		if strings.HasPrefix(line, ">") {
+			line = strings.TrimPrefix(strings.TrimPrefix(line, ">"), " ")
+		}
+		quoted = append(quoted, line)
+	}
+	md.out.WriteString("<blockquote>\n")
+	md.blocks(quoted, false)
+	md.out.WriteString("</blockquote>\n")
+	return end
+}
+
+// list renders the list starting at the index and returns the index of the
+// line following the list. Items are separated by blank lines in loose lists,
+// whose paragraphs are rendered with '<p>' tags.
+func (md *markdownRenderer) list(lines []string, index int) int {
+	ordered, start, _ := listMarker(lines[index])
+	var items [][]string
+	loose := false
+	end := index
+	for end < len(lines) {
+		isOrdered, _, width := listMarker(lines[end])
+		if width == 0 || isOrdered != ordered {
+			break
+		}
+
+		// The item continues with lines indented to its content, lazy
+		// continuations of its paragraph and blank lines followed by
+		// indented lines.
+		item := []string{""}
+		if width < len(lines[end]) {
+			item[0] = strings.TrimLeft(lines[end][width:], " ")
+		}
+		end++
+		for end < len(lines) {
+			line := lines[end]
+			if strings.TrimSpace(line) == "" {
+				next := end + 1
+				for next < len(lines) && strings.TrimSpace(lines[next]) == "" {
+					next++
+				}
+				if next < len(lines) && indentation(lines[next]) >= width {
+					item = append(item, "")
+					loose = true
+					end = next
+					continue
+				}
+				break
+			}
+			if indentation(line) >= width {
+				item = append(item, line[width:])
+			} else if isListItem(line) || startsBlock(strings.TrimSpace(line)) {
+				break
+			} else {
+				item = append(item, strings.TrimSpace(line))
+			}
+			end++
+		}
+		items = append(items, item)
+
+		// A blank line between items makes the list loose.
+		next := end
+		for next < len(lines) && strings.TrimSpace(lines[next]) == "" {
+			next++
+		}
+		if next == end || next == len(lines) {
+			continue
+		}
+		if isOrdered, _, width := listMarker(lines[next]); width == 0 || isOrdered != ordered {
+			break
+		}
+		loose = true
+		end = next
+	}
+
+	tag := "ul"
+	if ordered {
+		tag = "ol"
+	}
+	if ordered && start != 1 {
+		fmt.Fprintf(&md.out, "<ol start=\"%d\">\n", start)
+	} else {
+		fmt.Fprintf(&md.out, "<%s>\n", tag)
+	}
+	for _, item := range items {
+		md.out.WriteString("<li>")
+		if task := strings.ToLower(item[0]); strings.HasPrefix(task, "[ ] ") || strings.HasPrefix(task, "[x] ") {
+			checked := ""
+			if task[1] == 'x' {
+				checked = " checked"
+			}
+			fmt.Fprintf(&md.out, `<input type="checkbox" disabled%s> `, checked)
+			item[0] = item[0][4:]
+		}
+		if !loose && len(item) == 1 {
+			md.out.WriteString(inlineHTML(item[0]))
+		} else {
+			if loose {
+				md.out.WriteString("\n")
+			}
+			md.blocks(item, !loose)
+		}
+		md.out.WriteString("</li>\n")
+	}
+	fmt.Fprintf(&md.out, "</%s>\n", tag)
+	return end
+}
+
+// table renders the table, with a header row and a delimiter row setting the
+// alignment of the columns, starting at the index and returns the index of the
+// line following the table.
+func (md *markdownRenderer) table(lines []string, index int) int {
+	header := tableCells(lines[index])
+	var aligns []string
+	for _, cell := range tableCells(lines[index+1]) {
+		switch {
+		case strings.HasPrefix(cell, ":") && strings.HasSuffix(cell, ":"):
+			aligns = append(aligns, "center")
+		case strings.HasSuffix(cell, ":"):
+			aligns = append(aligns, "right")
+		case strings.HasPrefix(cell, ":"):
+			aligns = append(aligns, "left")
+		default:
+			aligns = append(aligns, "")
+		}
+	}
+
+	row := func(tag string, cells []string) {
+		md.out.WriteString("<tr>\n")
+		for column := range header {
+			cell := ""
+			if column < len(cells) {
+				cell = cells[column]
+			}
+			if column < len(aligns) && aligns[column] != "" {
+				fmt.Fprintf(&md.out, "<%s style=\"text-align: %s\">", tag, aligns[column])
+			} else {
+				fmt.Fprintf(&md.out, "<%s>", tag)
+			}
+			fmt.Fprintf(&md.out, "%s</%s>\n", inlineHTML(cell), tag)
+		}
+		md.out.WriteString("</tr>\n")
+	}
+
+	md.out.WriteString("<table>\n<thead>\n")
+	row("th", header)
+	md.out.WriteString("</thead>\n")
+	end := index + 2
+	if end < len(lines) && strings.TrimSpace(lines[end]) != "" && strings.Contains(lines[end], "|") {
+		md.out.WriteString("<tbody>\n")
+		for ; end < len(lines) && strings.TrimSpace(lines[end]) != "" && strings.Contains(lines[end], "|"); end++ {
+			row("td", tableCells(lines[end]))
+		}
+		md.out.WriteString("</tbody>\n")
+	}
+	md.out.WriteString("</table>\n")
+	return end
+}
+
+// paragraph renders the paragraph starting at the index and returns the index
+// of the line following the paragraph. A paragraph followed by a line of '='
+// or '-' is a heading instead.
+func (md *markdownRenderer) paragraph(lines []string, index int, tight bool) int {
+	text := []string{strings.TrimLeft(lines[index], " ")}
+	end := index + 1
+	for ; end < len(lines); end++ {
+		line := strings.TrimSpace(lines[end])
+		if line != "" && strings.Trim(line, "=") == "" {
+			md.writeHeading(1, strings.TrimSpace(strings.Join(text, "\n")))
+			return end + 1
+		}
+		if line != "" && strings.Trim(line, "-") == "" {
+			md.writeHeading(2, strings.TrimSpace(strings.Join(text, "\n")))
+			return end + 1
+		}
+		if line == "" || startsBlock(line) || isListItem(lines[end]) {
+			break
+		}
+		text = append(text, strings.TrimLeft(lines[end], " "))
+	}
+
+	content := inlineHTML(strings.TrimRight(strings.Join(text, "\n"), " "))
+	if tight {
+		md.out.WriteString(content)
+		md.out.WriteString("\n")
+	} else {
+		md.out.WriteString("<p>")
+		md.out.WriteString(content)
+		md.out.WriteString("</p>\n")
+	}
+	return end
+}
+
+// startsBlock returns true if the trimmed line starts a block that interrupts
+// a paragraph.
+func startsBlock(line string) bool {
+	return isFence(line) || headingLevel(line) > 0 || isThematicBreak(line) ||
+		strings.HasPrefix(line, ">")
+}
+
+// indentation returns the number of leading spaces of the line.
+func indentation(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// isFence returns true if the trimmed line opens or closes a fenced code block.
+func isFence(line string) bool {
+	return strings.HasPrefix(line, "```") || strings.HasPrefix(line, "~~~")
+}
+
+// headingLevel returns the level of the ATX heading on the trimmed line, or
+// zero if it isn't a heading.
+func headingLevel(line string) int {
+	level := len(line) - len(strings.TrimLeft(line, "#"))
+	if level < 1 || 6 < level || (level < len(line) && line[level] != ' ') {
+		return 0
+	}
+	return level
+}
+
+// isThematicBreak returns true if the trimmed line is three or more '-', '*'
+// or '_' characters, optionally separated by spaces.
+func isThematicBreak(line string) bool {
+	if line == "" || strings.IndexByte("-*_", line[0]) < 0 {
+		return false
+	}
+	compact := strings.ReplaceAll(line, " ", "")
+	return 3 <= len(compact) && strings.Trim(compact, line[:1]) == ""
+}
+
+// listMarker returns whether the line is an item of an ordered list, the
+// number of the item and the width of the marker up to the content of the
+// item. The width is zero if the line isn't a list item.
+func listMarker(line string) (ordered bool, number, width int) {
+	indent := indentation(line)
+	if 4 <= indent {
+		return false, 0, 0
+	}
+	rest := line[indent:]
+	marker := 0
+	switch {
+	case rest == "":
+		return false, 0, 0
+	case strings.IndexByte("-*+", rest[0]) >= 0:
+		if isThematicBreak(strings.TrimSpace(rest)) {
+			return false, 0, 0
+		}
+		marker = 1
+	default:
+		digits := len(rest) - len(strings.TrimLeft(rest, "0123456789"))
+		if digits == 0 || 9 < digits || digits == len(rest) ||
+			(rest[digits] != '.' && rest[digits] != ')') {
+			return false, 0, 0
+		}
+		ordered, marker = true, digits+1
+		number, _ = strconv.Atoi(rest[:digits])
+	}
+	if marker == len(rest) {
+		return ordered, number, indent + marker + 1
+	}
+	if rest[marker] != ' ' {
+		return false, 0, 0
+	}
+	spaces := indentation(rest[marker:])
+	if 4 < spaces || marker+spaces == len(rest) {
+		spaces = 1
+	}
+	return ordered, number, indent + marker + spaces
+}
+
+// isListItem returns true if the line starts a list item.
+func isListItem(line string) bool {
+	_, _, width := listMarker(line)
+	return width != 0
+}
+
+// isTableDelimiter returns true if the line is the delimiter row of a table
+// (e.g. '| --- | :-: |').
+func isTableDelimiter(line string) bool {
+	if !strings.Contains(line, "-") {
+		return false
+	}
+	cells := tableCells(line)
+	for _, cell := range cells {
+		if strings.Trim(strings.Trim(cell, ":"), "-") != "" || !strings.Contains(cell, "-") {
+			return false
+		}
+	}
+	return 0 < len(cells)
+}
+
+// tableCells returns the trimmed cells of the table row. Escaped pipes ('\|')
+// don't separate cells.
+func tableCells(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, "\\|") {
+		line = line[:len(line)-1]
+	}
+	var cells []string
+	var cell strings.Builder
+	for index := 0; index < len(line); index++ {
+		switch {
+		case line[index] == '\\' && index+1 < len(line) && line[index+1] == '|':
+			cell.WriteByte('|')
+			index++
+		case line[index] == '|':
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(line[index])
+		}
+	}
+	return append(cells, strings.TrimSpace(cell.String()))
+}
+
+// markdownPunctuation are the characters that can be escaped with a backslash.
+const markdownPunctuation = "!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~"
+
+// maxLinkDepth is the depth of links within the labels of links beyond which
+// labels are rendered as text, bounding the time spent on crafted Markdown.
+const maxLinkDepth = 8
+
+// inlineHTML renders the inline Markdown of the text as HTML.
+func inlineHTML(text string) string {
+	return renderInline(text, 0)
+}
+
+// inlineNode is a part of rendered inline Markdown: either HTML or a run of
+// emphasis delimiters, rendered as the tag of the emphasis if matched.
+type inlineNode struct {
+	html      string
+	delimiter string
+	opens     bool
+	closes    bool
+	tag       string
+}
+
+// renderInline renders the inline Markdown of the text, within the labels of
+// the number of links of the depth, as HTML. Every part of the text is scanned
+// a bounded number of times, so rendering takes linear time.
+func renderInline(text string, depth int) string {
+	var nodes []inlineNode
+	var out strings.Builder
+	flush := func() {
+		if 0 < out.Len() {
+			nodes = append(nodes, inlineNode{html: out.String()})
+			out.Reset()
+		}
+	}
+	pairs := bracketPairs(text)
+	unclosed := map[int]bool{}
+	for index := 0; index < len(text); {
+		c := text[index]
+		switch {
+		case c == '\\' && index+1 < len(text) && text[index+1] == '\n':
+			out.WriteString("<br>\n")
+			index += 2
+		case c == '\\' && index+1 < len(text) && strings.IndexByte(markdownPunctuation, text[index+1]) >= 0:
+			out.WriteString(html.EscapeString(text[index+1 : index+2]))
+			index += 2
+		case c == ' ' && strings.HasPrefix(text[index:], "  \n"):
+			// Two or more trailing spaces are a hard line break.
+			out.WriteString("<br>\n")
+			index += 3
+		case c == ' ' && strings.HasPrefix(text[index:], "   "):
+			spaces := len(text[index:]) - len(strings.TrimLeft(text[index:], " "))
+			if strings.HasPrefix(text[index+spaces:], "\n") {
+				out.WriteString("<br>\n")
+				index += spaces + 1
+			} else {
+				out.WriteString(text[index : index+spaces])
+				index += spaces
+			}
+		case c == '`':
+			index = codeSpan(&out, text, index, unclosed)
+		case c == '!' && strings.HasPrefix(text[index:], "!["):
+			label, destination, title, end, ok := parseLink(text, index+1, pairs)
+			if !ok {
+				out.WriteString("!")
+				index++
+				continue
+			}
+			fmt.Fprintf(&out, `<img src="%s" alt="%s"`, html.EscapeString(safeURL(destination)), html.EscapeString(plainText(label)))
+			if title != "" {
+				fmt.Fprintf(&out, ` title="%s"`, html.EscapeString(title))
+			}
+			out.WriteString(">")
+			index = end
+		case c == '[':
+			label, destination, title, end, ok := parseLink(text, index, pairs)
+			if !ok {
+				out.WriteString("[")
+				index++
+				continue
+			}
+			fmt.Fprintf(&out, `<a href="%s"`, html.EscapeString(safeURL(destination)))
+			if title != "" {
+				fmt.Fprintf(&out, ` title="%s"`, html.EscapeString(title))
+			}
+			if depth < maxLinkDepth {
+				fmt.Fprintf(&out, ">%s</a>", renderInline(label, depth+1))
+			} else {
+				fmt.Fprintf(&out, ">%s</a>", html.EscapeString(label))
+			}
+			index = end
+		case c == '<':
+			// Autolinks can't contain spaces or '<', so the search for the
+			// closing '>' stops at them.
+			end := strings.IndexAny(text[index+1:], "<> \n")
+			if 0 <= end && text[index+1+end] == '>' && isAutolink(text[index+1:index+1+end]) {
+				link := text[index+1 : index+1+end]
+				fmt.Fprintf(&out, `<a href="%s">%s</a>`, html.EscapeString(link), html.EscapeString(link))
+				index += end + 2
+			} else {
+				out.WriteString("&lt;")
+				index++
+			}
+		case c == '*' || c == '_' || c == '~':
+			flush()
+			var node inlineNode
+			node, index = delimiterRun(text, index)
+			nodes = append(nodes, node)
+		default:
+			_, size := utf8.DecodeRuneInString(text[index:])
+			out.WriteString(html.EscapeString(text[index : index+size]))
+			index += size
+		}
+	}
+	flush()
+
+	matchEmphasis(nodes)
+	for _, node := range nodes {
+		switch {
+		case node.delimiter == "":
+			out.WriteString(node.html)
+		case node.tag != "":
+			out.WriteString(node.tag)
+		default:
+			out.WriteString(node.delimiter)
+		}
+	}
+	return out.String()
+}
+
+// codeSpan renders the code span starting with the backticks at the index and
+// returns the index following the span. Backticks without a closing run of the
+// same length are rendered as is. The lengths of runs found to be unclosed are
+// remembered, as later runs of the same length can't be closed either.
+func codeSpan(out *strings.Builder, text string, index int, unclosed map[int]bool) int {
+	run := len(text[index:]) - len(strings.TrimLeft(text[index:], "`"))
+	fence := text[index : index+run]
+	for search := index + run; !unclosed[run] && search < len(text); {
+		offset := strings.Index(text[search:], fence)
+		if offset < 0 {
+			break
+		}
+		closing := search + offset
+		closingRun := len(text[closing:]) - len(strings.TrimLeft(text[closing:], "`"))
+		if closingRun != run {
+			search = closing + closingRun
+			continue
+		}
+		code := strings.ReplaceAll(text[index+run:closing], "\n", " ")
+		if 2 < len(code) && code[0] == ' ' && code[len(code)-1] == ' ' && strings.Trim(code, " ") != "" {
+			code = code[1 : len(code)-1]
+		}
+		out.WriteString("<code>")
+		out.WriteString(html.EscapeString(code))
+		out.WriteString("</code>")
+		return closing + run
+	}
+	unclosed[run] = true
+	out.WriteString(fence)
+	return index + run
+}
+
+// delimiterRun returns the node of the run of emphasis delimiters ('*', '_' or
+// '~') at the index and the index following the run. A run opens emphasis when
+// followed by text and closes it when preceded by text. Runs of '_' don't open
+// or close within words, and only runs of two '~' are strikethrough.
+func delimiterRun(text string, index int) (inlineNode, int) {
+	c := text[index]
+	after := index + len(text[index:]) - len(strings.TrimLeft(text[index:], text[index:index+1]))
+	valid := after-index <= 3 && (c != '~' || after-index == 2)
+	return inlineNode{
+		delimiter: text[index:after],
+		opens: valid && after < len(text) && !isSpace(text[after]) &&
+			(c != '_' || index == 0 || !isWordByte(text[index-1])),
+		closes: valid && 0 < index && !isSpace(text[index-1]) &&
+			(c != '_' || after == len(text) || !isWordByte(text[after])),
+	}, after
+}
+
+// matchEmphasis sets the tags of the delimiter runs of the nodes that close
+// emphasis ('*em*' or '_em_'), strong emphasis ('**strong**' or '__strong__'),
+// both ('***both***') or strikethrough ('~~del~~') and of the nearest preceding
+// identical runs that open it. Openers between a matched pair are left as is,
+// so that tags are nested. The openers below which an identical run was last
+// not found are remembered, so that each opener is searched at most once per
+// kind of run.
+func matchEmphasis(nodes []inlineNode) {
+	var openers []int
+	bottoms := map[string]int{}
+	for index := range nodes {
+		node := &nodes[index]
+		if node.delimiter == "" {
+			continue
+		}
+		if node.closes {
+			matched := -1
+			for search := len(openers) - 1; search >= bottoms[node.delimiter]; search-- {
+				if nodes[openers[search]].delimiter == node.delimiter {
+					matched = search
+					break
+				}
+			}
+			if 0 <= matched {
+				nodes[openers[matched]].tag, node.tag = emphasisTags(node.delimiter)
+				openers = openers[:matched]
+				for delimiter, bottom := range bottoms {
+					if len(openers) < bottom {
+						bottoms[delimiter] = len(openers)
+					}
+				}
+				continue
+			}
+			bottoms[node.delimiter] = len(openers)
+		}
+		if node.opens {
+			openers = append(openers, index)
+		}
+	}
+}
+
+// emphasisTags returns the opening and closing tags of the emphasis of the
+// delimiter run.
+func emphasisTags(delimiter string) (open, close string) {
+	switch {
+	case delimiter[0] == '~':
+		return "<del>", "</del>"
+	case len(delimiter) == 1:
+		return "<em>", "</em>"
+	case len(delimiter) == 2:
+		return "<strong>", "</strong>"
+	default:
+		return "<em><strong>", "</strong></em>"
+	}
+}
+
+// parseLink parses the link ('[label](destination "title")') starting with the
+// '[' at the index and returns its parts and the index following it. The pairs
+// are the brackets of the text, as returned by bracketPairs.
+func parseLink(text string, index int, pairs []int) (label, destination, title string, end int, ok bool) {
+	closing := pairs[index]
+	if closing < 0 || closing+1 >= len(text) || text[closing+1] != '(' {
+		return
+	}
+	parenthesis := pairs[closing+1]
+	if parenthesis < 0 {
+		return
+	}
+	label = text[index+1 : closing]
+	inside := strings.TrimSpace(text[closing+2 : parenthesis])
+	if strings.HasPrefix(inside, "<") {
+		if end := strings.IndexByte(inside, '>'); 0 < end {
+			destination, inside = inside[1:end], strings.TrimSpace(inside[end+1:])
+		}
+	} else if space := strings.IndexAny(inside, " \n"); 0 <= space {
+		destination, inside = inside[:space], strings.TrimSpace(inside[space:])
+	} else {
+		destination, inside = inside, ""
+	}
+	if 2 <= len(inside) && strings.IndexByte(`"'(`, inside[0]) >= 0 {
+		title = inside[1 : len(inside)-1]
+	}
+	return label, destination, title, parenthesis + 1, true
+}
+
+// bracketPairs returns, for the index of each '[' and '(' of the text, the
+// index of the bracket closing it, skipping nested brackets and escaped
+// characters, or -1 if there is none.
+func bracketPairs(text string) []int {
+	pairs := make([]int, len(text))
+	for index := range pairs {
+		pairs[index] = -1
+	}
+	var squares, parentheses []int
+	for index := 0; index < len(text); index++ {
+		switch text[index] {
+		case '\\':
+			index++
+		case '[':
+			squares = append(squares, index)
+		case '(':
+			parentheses = append(parentheses, index)
+		case ']':
+			if count := len(squares); 0 < count {
+				pairs[squares[count-1]] = index
+				squares = squares[:count-1]
+			}
+		case ')':
+			if count := len(parentheses); 0 < count {
+				pairs[parentheses[count-1]] = index
+				parentheses = parentheses[:count-1]
+			}
+		}
+	}
+	return pairs
+}
+
+// safeURL returns the URL unless it has a scheme that could run scripts, in
+// which case an empty link is returned.
+func safeURL(link string) string {
+	colon := strings.IndexByte(link, ':')
+	if colon < 0 || strings.ContainsAny(link[:colon], "/?#") {
+		return link
+	}
+	switch strings.ToLower(link[:colon]) {
+	case "http", "https", "mailto":
+		return link
+	}
+	return "#"
+}
+
+// isAutolink returns true if the link within angle brackets is an absolute URL
+// to link to.
+func isAutolink(link string) bool {
+	lower := strings.ToLower(link)
+	return !strings.ContainsAny(link, " \n<") &&
+		(strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") ||
+			strings.HasPrefix(lower, "mailto:"))
+}
+
+// plainText returns the text of the inline Markdown without formatting, for
+// use as the alternative text of images and the title.
+func plainText(text string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune("*_`~[]", r) {
+			return -1
+		}
+		return r
+	}, text)
+}
+
+// isSpace returns true if the byte is whitespace.
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\n'
+}
+
+// isWordByte returns true if the byte is part of a word. Bytes of multi-byte
+// characters are assumed to be letters.
+func isWordByte(b byte) bool {
+	return b == '_' || ('a' <= b && b <= 'z') || ('A' <= b && b <= 'Z') ||
+		('0' <= b && b <= '9') || utf8.RuneSelf <= b
+}
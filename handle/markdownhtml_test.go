@@ -0,0 +1,98 @@
+package handle
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMarkdownToHTML(t *testing.T) {
+	testCases := []struct {
+		name     string
+		markdown string
+		html     string
+	}{
+		{"Paragraphs", "One\ntwo\n\nThree", "<p>One\ntwo</p>\n<p>Three</p>\n"},
+		{"Headings", "# Title #\n### C#", "<h1 id=\"title\">Title</h1>\n<h3 id=\"c\">C#</h3>\n"},
+		{"Setext headings", "Title\n=====\nPart\n---", "<h1 id=\"title\">Title</h1>\n<h2 id=\"part\">Part</h2>\n"},
+		{"Duplicate headings", "## Usage\n## Usage", "<h2 id=\"usage\">Usage</h2>\n<h2 id=\"usage-1\">Usage</h2>\n"},
+		{"Not a heading", "#hashtag", "<p>#hashtag</p>\n"},
+		{"Emphasis", "*a* _b_ **c** __d__ ***e*** ~~f~~", "<p><em>a</em> <em>b</em> <strong>c</strong> <strong>d</strong> <em><strong>e</strong></em> <del>f</del></p>\n"},
+		{"Intraword underscore", "snake_case_name and 2 * 3 * 4", "<p>snake_case_name and 2 * 3 * 4</p>\n"},
+		{"Nested emphasis", "**bold *and* more**", "<p><strong>bold <em>and</em> more</strong></p>\n"},
+		{"Code span", "Run `go test ./...` or ``a ` b``", "<p>Run <code>go test ./...</code> or <code>a ` b</code></p>\n"},
+		{"Unclosed code span", "a ` b", "<p>a ` b</p>\n"},
+		{"Escapes", `\*not\* \<b\>`, "<p>*not* &lt;b&gt;</p>\n"},
+		{"Raw HTML", "<script>alert(1)</script>", "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>\n"},
+		{"Link", `[the *docs*](docs/README.md "Docs")`, "<p><a href=\"docs/README.md\" title=\"Docs\">the <em>docs</em></a></p>\n"},
+		{"Script link", "[x](javascript:alert(1))", "<p><a href=\"#\">x</a></p>\n"},
+		{"Image", "![A *logo*](logo.png)", "<p><img src=\"logo.png\" alt=\"A logo\"></p>\n"},
+		{"Autolink", "<https://example.com/?a=1&b=2>", "<p><a href=\"https://example.com/?a=1&amp;b=2\">https://example.com/?a=1&amp;b=2</a></p>\n"},
+		{"Not a link", "[brackets] and (parentheses)", "<p>[brackets] and (parentheses)</p>\n"},
+		{"Hard breaks", "one  \ntwo\\\nthree", "<p>one<br>\ntwo<br>\nthree</p>\n"},
+		{"Fenced code", "```go\nfunc main() {\n\t<-done\n}\n```", "<pre><code class=\"language-go\">func main() {\n    &lt;-done\n}\n</code></pre>\n"},
+		{"Unclosed fence", "~~~\ncode", "<pre><code>code\n</code></pre>\n"},
+		{"Indented code", "    a := 1\n\n    b := 2\n\nText", "<pre><code>a := 1\n\nb := 2\n</code></pre>\n<p>Text</p>\n"},
+		{"Thematic break", "a\n\n* * *\n\nb", "<p>a</p>\n<hr>\n<p>b</p>\n"},
+		{"Block quote", "> Note:\n> **Important**\n\nAfter", "<blockquote>\n<p>Note:\n<strong>Important</strong></p>\n</blockquote>\n<p>After</p>\n"},
+		{"Tight list", "- one\n- two\n  continued\n- three", "<ul>\n<li>one</li>\n<li>two\ncontinued\n</li>\n<li>three</li>\n</ul>\n"},
+		{"Loose list", "1. one\n\n2. two", "<ol>\n<li>\n<p>one</p>\n</li>\n<li>\n<p>two</p>\n</li>\n</ol>\n"},
+		{"Ordered start", "3) three\n4) four", "<ol start=\"3\">\n<li>three</li>\n<li>four</li>\n</ol>\n"},
+		{"Nested list", "- a\n  - b\n  - c\n- d", "<ul>\n<li>a\n<ul>\n<li>b</li>\n<li>c</li>\n</ul>\n</li>\n<li>d</li>\n</ul>\n"},
+		{"List after paragraph", "Steps:\n- a\n- b", "<p>Steps:</p>\n<ul>\n<li>a</li>\n<li>b</li>\n</ul>\n"},
+		{"Task list", "- [ ] todo\n- [x] done", "<ul>\n<li><input type=\"checkbox\" disabled> todo</li>\n<li><input type=\"checkbox\" disabled checked> done</li>\n</ul>\n"},
+		{"Empty item", "-\n- a", "<ul>\n<li></li>\n<li>a</li>\n</ul>\n"},
+		{"Mixed lists", "- a\n1. b", "<ul>\n<li>a</li>\n</ul>\n<ol>\n<li>b</li>\n</ol>\n"},
+		{"Table", "| Name | Size |\n| :--- | ---: |\n| `a\\|b` | 1 |\n| c |", "<table>\n<thead>\n<tr>\n<th style=\"text-align: left\">Name</th>\n<th style=\"text-align: right\">Size</th>\n</tr>\n</thead>\n<tbody>\n<tr>\n<td style=\"text-align: left\"><code>a|b</code></td>\n<td style=\"text-align: right\">1</td>\n</tr>\n<tr>\n<td style=\"text-align: left\">c</td>\n<td style=\"text-align: right\"></td>\n</tr>\n</tbody>\n</table>\n"},
+		{"Windows line endings", "a\r\nb", "<p>a\nb</p>\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if result, _ := markdownToHTML(tc.markdown); tc.html != result {
+				t.Errorf("Expected HTML\n%q\nbut got\n%q", tc.html, result)
+			}
+		})
+	}
+}
+
+func TestMarkdownTitle(t *testing.T) {
+	testCases := []struct {
+		markdown string
+		title    string
+	}{
+		{"## Section\n# First *title*\n# Second", "First title"},
+		{"Setext\n===", "Setext"},
+		{"No title", ""},
+	}
+
+	for _, tc := range testCases {
+		if _, result := markdownToHTML(tc.markdown); tc.title != result {
+			t.Errorf("For %q expected title '%s' but got '%s'", tc.markdown, tc.title, result)
+		}
+	}
+}
+
+func TestMarkdownToHTMLLinear(t *testing.T) {
+	testCases := []struct {
+		name     string
+		markdown string
+	}{
+		{"Unclosed emphasis", strings.Repeat("*a ", 20000)},
+		{"Mixed emphasis", strings.Repeat("*a _b **c ~~d ", 10000)},
+		{"Unclosed code spans", strings.Repeat("`a ``b ```c ", 10000)},
+		{"Unclosed brackets", strings.Repeat("[a](", 20000)},
+		{"Nested links", strings.Repeat("[", 10000) + "a" + strings.Repeat("](b)", 10000)},
+		{"Angle brackets", strings.Repeat("<http://", 20000)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			start := time.Now()
+			markdownToHTML(tc.markdown)
+			if elapsed := time.Since(start); time.Second < elapsed {
+				t.Errorf("Expected %d bytes to render within a second but took %v", len(tc.markdown), elapsed)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package handle
+
+import (
+	"fmt"
+	"mime"
+	"strings"
+)
+
+// contentTypes are the built-in content types of file extensions. They take
+// precedence over the MIME tables of the system, which vary between systems and
+// are missing from minimal container images.
+var contentTypes = map[string]string{
+	".7z":          "application/x-7z-compressed",
+	".aac":         "audio/aac",
+	".apng":        "image/apng",
+	".atom":        "application/atom+xml",
+	".avif":        "image/avif",
+	".bmp":         "image/bmp",
+	".bz2":         "application/x-bzip2",
+	".cjs":         "text/javascript; charset=utf-8",
+	".css":         "text/css; charset=utf-8",
+	".csv":         "text/csv; charset=utf-8",
+	".doc":         "application/msword",
+	".docx":        "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	".eot":         "application/vnd.ms-fontobject",
+	".epub":        "application/epub+zip",
+	".flac":        "audio/flac",
+	".geojson":     "application/geo+json",
+	".gif":         "image/gif",
+	".glb":         "model/gltf-binary",
+	".gltf":        "model/gltf+json",
+	".gz":          "application/gzip",
+	".heic":        "image/heic",
+	".htm":         "text/html; charset=utf-8",
+	".html":        "text/html; charset=utf-8",
+	".ico":         "image/x-icon",
+	".ics":         "text/calendar; charset=utf-8",
+	".jpeg":        "image/jpeg",
+	".jpg":         "image/jpeg",
+	".js":          "text/javascript; charset=utf-8",
+	".json":        "application/json",
+	".jsonld":      "application/ld+json",
+	".jxl":         "image/jxl",
+	".m3u8":        "application/vnd.apple.mpegurl",
+	".m4a":         "audio/mp4",
+	".m4v":         "video/mp4",
+	".map":         "application/json",
+	".markdown":    "text/markdown; charset=utf-8",
+	".md":          "text/markdown; charset=utf-8",
+	".mid":         "audio/midi",
+	".mjs":         "text/javascript; charset=utf-8",
+	".mkv":         "video/x-matroska",
+	".mov":         "video/quicktime",
+	".mp3":         "audio/mpeg",
+	".mp4":         "video/mp4",
+	".mpd":         "application/dash+xml",
+	".mpeg":        "video/mpeg",
+	".oga":         "audio/ogg",
+	".ogg":         "audio/ogg",
+	".ogv":         "video/ogg",
+	".opus":        "audio/ogg",
+	".otf":         "font/otf",
+	".pdf":         "application/pdf",
+	".png":         "image/png",
+	".ppt":         "application/vnd.ms-powerpoint",
+	".pptx":        "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	".rss":         "application/rss+xml",
+	".rtf":         "application/rtf",
+	".svg":         "image/svg+xml",
+	".tar":         "application/x-tar",
+	".tgz":         "application/gzip",
+	".tif":         "image/tiff",
+	".tiff":        "image/tiff",
+	".toml":        "application/toml",
+	".ttf":         "font/ttf",
+	".txt":         "text/plain; charset=utf-8",
+	".vtt":         "text/vtt; charset=utf-8",
+	".wasm":        "application/wasm",
+	".wav":         "audio/wav",
+	".weba":        "audio/webm",
+	".webm":        "video/webm",
+	".webmanifest": "application/manifest+json",
+	".webp":        "image/webp",
+	".woff":        "font/woff",
+	".woff2":       "font/woff2",
+	".xhtml":       "application/xhtml+xml",
+	".xls":         "application/vnd.ms-excel",
+	".xlsx":        "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	".xml":         "text/xml; charset=utf-8",
+	".yaml":        "application/yaml",
+	".yml":         "application/yaml",
+	".zip":         "application/zip",
+}
+
+// SetContentTypes to the built-in content types of file extensions followed by
+// the overrides, which map extensions (e.g. '.wasm') to content types. The
+// charset parameter of the content types of the extensions in charsets is then
+// set to the charset. Text types without a charset are given the 'utf-8'
+// charset. Extensions without a content type are served with the content types
+// of the system. The settings are left unchanged if a content type or charset
+// is invalid.
+func (s *Settings) SetContentTypes(overrides, charsets map[string]string) error {
+	types := map[string]string{}
+	for _, table := range []map[string]string{contentTypes, overrides} {
+		for ext, contentType := range table {
+			if !strings.HasPrefix(ext, ".") {
+				return fmt.Errorf("content type '%s' of '%s': extension is missing a leading dot", contentType, ext)
+			}
+			mediaType, params, err := mime.ParseMediaType(contentType)
+			if nil != err {
+				return fmt.Errorf("content type '%s' of '%s': %v", contentType, ext, err)
+			}
+			if strings.HasPrefix(mediaType, "text/") && params["charset"] == "" {
+				params["charset"] = "utf-8"
+				contentType = mime.FormatMediaType(mediaType, params)
+			}
+			types[strings.ToLower(ext)] = contentType
+		}
+	}
+
+	for ext, charset := range charsets {
+		if charset == "" {
+			return fmt.Errorf("charset of '%s' is empty", ext)
+		}
+		contentType, ok := types[strings.ToLower(ext)]
+		if !ok {
+			contentType = mime.TypeByExtension(ext)
+		}
+		if contentType == "" {
+			return fmt.Errorf("charset of '%s' is set but it has no content type", ext)
+		}
+		mediaType, params, err := mime.ParseMediaType(contentType)
+		if nil != err {
+			return fmt.Errorf("content type '%s' of '%s': %v", contentType, ext, err)
+		}
+		params["charset"] = charset
+		if contentType = mime.FormatMediaType(mediaType, params); contentType == "" {
+			return fmt.Errorf("charset '%s' of '%s' is invalid", charset, ext)
+		}
+		types[strings.ToLower(ext)] = contentType
+	}
+	s.contentTypes = types
+	return nil
+}
+
+// typeByExtension returns the content type of the file extension in the active
+// settings.
+func typeByExtension(ext string) string {
+	return loadSettings().TypeByExtension(ext)
+}
+
+// TypeByExtension returns the content type of the file extension set by
+// SetContentTypes or, if it isn't set, the content type of the system.
+func (s *Settings) TypeByExtension(ext string) string {
+	if contentType, ok := s.contentTypes[strings.ToLower(ext)]; ok {
+		return contentType
+	}
+	return mime.TypeByExtension(ext)
+}
+
+// SetContentSniffing to detect the content type of files with an unknown
+// extension from their contents. If disabled, such files are served as
+// 'application/octet-stream' and browsers are told not to detect the content
+// type either.
+func (s *Settings) SetContentSniffing(enabled bool) {
+	s.contentSniffing = enabled
+}
@@ -0,0 +1,63 @@
+package handle
+
+import (
+	"testing"
+)
+
+func TestSetContentTypes(t *testing.T) {
+	settings := NewSettings()
+
+	testCases := []struct {
+		name      string
+		overrides map[string]string
+		charsets  map[string]string
+		types     map[string]string
+		isError   bool
+	}{
+		{"Built-in", nil, nil, map[string]string{
+			".wasm":        "application/wasm",
+			".mjs":         "text/javascript; charset=utf-8",
+			".webmanifest": "application/manifest+json",
+			".avif":        "image/avif",
+		}, false},
+		{"Override", map[string]string{".mjs": "application/javascript", ".custom": "application/x-custom"}, nil, map[string]string{
+			".mjs":    "application/javascript",
+			".custom": "application/x-custom",
+			".avif":   "image/avif",
+		}, false},
+		{"Charset", nil, map[string]string{".txt": "iso-8859-1", ".json": "utf-8"}, map[string]string{
+			".txt":  "text/plain; charset=iso-8859-1",
+			".json": "application/json; charset=utf-8",
+		}, false},
+		{"Removed override", nil, nil, map[string]string{
+			".mjs":    "text/javascript; charset=utf-8",
+			".custom": "",
+		}, false},
+		{"Extension without dot", map[string]string{"wasm": "application/wasm"}, nil, nil, true},
+		{"Bad content type", map[string]string{".wasm": "application/"}, nil, nil, true},
+		{"Empty charset", nil, map[string]string{".txt": ""}, nil, true},
+		{"Charset of unknown extension", nil, map[string]string{".unknown": "utf-8"}, nil, true},
+		{"Unchanged after error", map[string]string{".custom": "application/"}, nil, map[string]string{
+			".custom": "",
+			".avif":   "image/avif",
+		}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := settings.SetContentTypes(tc.overrides, tc.charsets)
+			hasError := nil != err
+			if hasError && !tc.isError {
+				t.Errorf("Expected no error but got %v", err)
+			}
+			if !hasError && tc.isError {
+				t.Error("Expected an error but got no error")
+			}
+			for ext, contentType := range tc.types {
+				if result := settings.TypeByExtension(ext); contentType != result {
+					t.Errorf("For %s expected content type '%s' but got '%s'", ext, contentType, result)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package handle
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Mount passes requests with URL paths starting with the prefix to the
+// handler. The prefix starts with '/' and doesn't end with '/'.
+type Mount struct {
+	Prefix  string
+	Handler http.HandlerFunc
+}
+
+// WithMounts returns a function that passes each request to the handler of the
+// mount with the longest prefix matching the URL path, or to the wrapped
+// handler if no mount matches. A prefix matches when the path is equal to the
+// prefix or continues with '/'. Requests for the prefix itself are redirected
+// to the prefix with a trailing slash.
+func WithMounts(serve http.HandlerFunc, mounts []Mount) http.HandlerFunc {
+	sorted := make([]Mount, len(mounts))
+	copy(sorted, mounts)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return len(sorted[i].Prefix) > len(sorted[j].Prefix)
+	})
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		for _, mount := range sorted {
+			if r.URL.Path == mount.Prefix {
+				target := mount.Prefix + "/"
+				if r.URL.RawQuery != "" {
+					target += "?" + r.URL.RawQuery
+				}
+				http.Redirect(w, r, target, http.StatusMovedPermanently)
+				return
+			}
+			if strings.HasPrefix(r.URL.Path, mount.Prefix+"/") {
+				mount.Handler(w, r)
+				return
+			}
+		}
+		serve(w, r)
+	}
+}
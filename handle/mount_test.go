@@ -0,0 +1,73 @@
+package handle
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWithMounts(t *testing.T) {
+	named := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name))
+		}
+	}
+	handler := WithMounts(named("root"), []Mount{
+		{Prefix: "/docs", Handler: named("docs")},
+		{Prefix: "/docs/api", Handler: named("api")},
+		{Prefix: "/assets", Handler: Prefix(serveLocal, "/assets")},
+	})
+
+	testCases := []struct {
+		name     string
+		path     string
+		code     int
+		location string
+		contents string
+	}{
+		{"No mount", "/index.html", ok, "", "root"},
+		{"Mount", "/docs/guide.html", ok, "", "docs"},
+		{"Longest prefix", "/docs/api/index.html", ok, "", "api"},
+		{"Partial segment", "/docs/apis/index.html", ok, "", "docs"},
+		{"Partial prefix", "/documents/", ok, "", "root"},
+		{"Mount without trailing slash", "/docs", redirect, "/docs/", ""},
+		{"Mount without trailing slash w/query", "/docs/api?v=1", redirect, "/docs/api/?v=1", ""},
+		{"Mounted file", "/assets/" + tmpFileName, ok, "", tmpFile},
+		{"Mounted dir", "/assets/" + subDir, ok, "", tmpSubIndex},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fullpath := "http://localhost" + tc.path
+			req := httptest.NewRequest("GET", fullpath, nil)
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			resp := w.Result()
+			body, err := ioutil.ReadAll(resp.Body)
+			if nil != err {
+				t.Errorf("While reading body got %v", err)
+			}
+			if tc.code != resp.StatusCode {
+				t.Errorf(
+					"While retrieving %s expected status code of %d but got %d",
+					fullpath, tc.code, resp.StatusCode,
+				)
+			}
+			if location := resp.Header.Get("Location"); tc.location != location {
+				t.Errorf(
+					"While retrieving %s expected location '%s' but got '%s'",
+					fullpath, tc.location, location,
+				)
+			}
+			if tc.code == ok && tc.contents != string(body) {
+				t.Errorf(
+					"While retrieving %s expected contents '%s' but got '%s'",
+					fullpath, tc.contents, body,
+				)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package handle
+
+import (
+	"bytes"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/halverneus/static-file-server/storage"
+)
+
+// WithPrecompressed returns a function that serves the gzip compressed variants
+// of files, including index files of directories, to clients accepting the
+// 'gzip' content coding. The entity tag of a variant is the entity tag of the
+// file with a '-gzip' suffix. All other requests are passed to the wrapped
+// function.
+func WithPrecompressed(serveFile FileServerFunc, fsys fs.FS, gzipper storage.Gzipper) FileServerFunc {
+	return func(w http.ResponseWriter, r *http.Request, name string) {
+		filename := fsName(name)
+		if strings.HasSuffix(name, "/") {
+			filename, _ = indexFile(fsys, filename)
+		} else if isIndexFile(path.Base(filename)) {
+			// Index files are redirected to their directory.
+			serveFile(w, r, name)
+			return
+		}
+		contents, ok := gzipper.Gzipped(filename)
+		if !ok {
+			serveFile(w, r, name)
+			return
+		}
+
+		w.Header().Add("Vary", "Accept-Encoding")
+		stat, err := fs.Stat(fsys, filename)
+		if !acceptsGzip(r) || nil != err {
+			serveFile(w, r, name)
+			return
+		}
+
+		// The digests of the file are of its uncompressed representation.
+		header := w.Header()
+		header.Del("Repr-Digest")
+		header.Del("Digest")
+		header.Set("Content-Encoding", "gzip")
+		header.Set("Content-Type", typeByExtension(path.Ext(filename)))
+		if !loadSettings().contentSniffing {
+			header.Set("X-Content-Type-Options", "nosniff")
+		}
+		if tagged, ok := stat.Sys().(storage.ETagger); ok && tagged.ETag() != "" {
+			header.Set("ETag", strings.TrimSuffix(tagged.ETag(), `"`)+`-gzip"`)
+		}
+		http.ServeContent(w, r, "", stat.ModTime(), bytes.NewReader(contents))
+	}
+}
+
+// acceptsGzip returns true if the 'Accept-Encoding' header of the request
+// accepts the 'gzip' content coding.
+func acceptsGzip(r *http.Request) bool {
+	for _, coding := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		params := strings.Split(coding, ";")
+		name := strings.ToLower(strings.TrimSpace(params[0]))
+		if name != "gzip" && name != "*" {
+			continue
+		}
+		for _, param := range params[1:] {
+			param = strings.ReplaceAll(param, " ", "")
+			if param == "q=0" || strings.HasPrefix(param, "q=0.") && strings.Trim(param[4:], "0") == "" {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
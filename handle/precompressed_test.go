@@ -0,0 +1,86 @@
+package handle
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/halverneus/static-file-server/storage"
+)
+
+func TestWithPrecompressed(t *testing.T) {
+	page := strings.Repeat("<p>compressible</p>", 100)
+	fsys, err := storage.Preload(fstest.MapFS{
+		"index.html":      {Data: []byte(page)},
+		"docs/guide.html": {Data: []byte(page)},
+		"small.txt":       {Data: []byte("small")},
+		"photo.png":       {Data: []byte(page)},
+	}, false, typeByExtension)
+	if nil != err {
+		t.Fatalf("While preloading got %v", err)
+	}
+	handler := Basic(WithPrecompressed(ServeFS(fsys), fsys, fsys))
+
+	testCases := []struct {
+		name     string
+		path     string
+		encoding string
+		code     int
+		gzipped  bool
+	}{
+		{"Gzip", "/docs/guide.html", "gzip, deflate, br", ok, true},
+		{"Gzip index", "/", "gzip", ok, true},
+		{"Any coding", "/docs/guide.html", "*", ok, true},
+		{"Not accepted", "/docs/guide.html", "br", ok, false},
+		{"Refused", "/docs/guide.html", "gzip;q=0", ok, false},
+		{"No header", "/docs/guide.html", "", ok, false},
+		{"Not worth compressing", "/small.txt", "gzip", ok, false},
+		{"Not compressible", "/photo.png", "gzip", ok, false},
+		{"Index redirected", "/index.html", "gzip", redirect, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fullpath := "http://localhost" + tc.path
+			req := httptest.NewRequest("GET", fullpath, nil)
+			req.Header.Set("Accept-Encoding", tc.encoding)
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			if tc.code != w.Code {
+				t.Errorf(
+					"While retrieving %s expected status code of %d but got %d",
+					fullpath, tc.code, w.Code,
+				)
+			}
+			if tc.code != ok {
+				return
+			}
+			encoding := w.Header().Get("Content-Encoding")
+			if tc.gzipped != (encoding == "gzip") {
+				t.Errorf(
+					"While retrieving %s expected gzipped (%t) but got encoding '%s'",
+					fullpath, tc.gzipped, encoding,
+				)
+			}
+			if !tc.gzipped {
+				return
+			}
+			if etag := w.Header().Get("ETag"); !strings.HasSuffix(etag, `-gzip"`) {
+				t.Errorf("While retrieving %s expected a gzip entity tag but got '%s'", fullpath, etag)
+			}
+			reader, err := gzip.NewReader(w.Body)
+			if nil != err {
+				t.Fatalf("While decompressing %s got %v", fullpath, err)
+			}
+			contents, _ := ioutil.ReadAll(reader)
+			if page != string(contents) {
+				t.Errorf("While retrieving %s expected the decompressed page but got '%s'", fullpath, contents)
+			}
+		})
+	}
+}
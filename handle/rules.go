@@ -0,0 +1,368 @@
+package handle
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// checkInterval is the minimum time between checking whether a rules or
+	// headers file has changed.
+	checkInterval = time.Second
+
+	// placeholderPattern matches the placeholders of rule targets.
+	placeholderPattern = regexp.MustCompile(`:[A-Za-z_][A-Za-z0-9_]*`)
+)
+
+// Rule redirects or rewrites requests with a path matching the pattern, and a
+// query and host matching those of the rule, to the target.
+type Rule struct {
+	// From is the URL path pattern. Segments starting with ':' are
+	// placeholders matching any segment, and a final '*' segment matches the
+	// rest of the path as the 'splat' placeholder.
+	From string
+
+	// Query parameters of the request, with values starting with ':' being
+	// placeholders matching any value.
+	Query map[string]string
+
+	// Hosts are the host name patterns, one of which must match the host of
+	// the request. If empty, every host matches.
+	Hosts []string
+
+	// To is the target URL path or URL, which may contain placeholders.
+	To *url.URL
+
+	// Status of redirects, or 'OK' for rewrites served from the target path.
+	Status int
+
+	// Force the rule to be applied even if the path names an existing file.
+	Force bool
+}
+
+// ParseRules in the format of '_redirects' files. Each line is a rule of the
+// form 'FROM [QUERY...] TO [STATUS[!]] [CONDITION...]', where FROM is a URL path
+// pattern (or a URL, adding a condition on the host), QUERY are 'name=value'
+// query parameters to match, TO is the target, STATUS is 301 (the default),
+// 302, 307, 308 or, for rewrites, 200 with '!' forcing the rule. The only
+// condition is 'Host=PATTERN[,PATTERN...]'. Blank lines and lines starting
+// with '#' are ignored.
+func ParseRules(reader io.Reader) ([]Rule, error) {
+	var rules []Rule
+	scanner := bufio.NewScanner(reader)
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule, err := parseRule(strings.Fields(line))
+		if nil != err {
+			return nil, fmt.Errorf("line %d: %v", number, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, scanner.Err()
+}
+
+// parseRule parses the fields of a line of a rules file.
+func parseRule(fields []string) (rule Rule, err error) {
+	rule.From, rule.Status = fields[0], http.StatusMovedPermanently
+	if from, err := url.Parse(rule.From); nil == err && "" != from.Host {
+		rule.From, rule.Hosts = from.Path, []string{from.Host}
+	}
+	if !strings.HasPrefix(rule.From, "/") {
+		return rule, fmt.Errorf("path '%s' must start with '/'", fields[0])
+	}
+	bound := map[string]bool{}
+	for index, segment := range segments(rule.From) {
+		switch {
+		case segment == "*" && index == len(segments(rule.From))-1:
+			bound["splat"] = true
+		case strings.Contains(segment, "*"):
+			return rule, fmt.Errorf("path '%s' may only end with '*'", rule.From)
+		case strings.HasPrefix(segment, ":"):
+			bound[segment[1:]] = true
+		}
+	}
+
+	// Query parameters to match precede the target.
+	fields = fields[1:]
+	for 0 < len(fields) && isQueryParameter(fields[0]) {
+		if nil == rule.Query {
+			rule.Query = map[string]string{}
+		}
+		parts := strings.SplitN(fields[0], "=", 2)
+		rule.Query[parts[0]] = parts[1]
+		if strings.HasPrefix(parts[1], ":") {
+			bound[parts[1][1:]] = true
+		}
+		fields = fields[1:]
+	}
+
+	if len(fields) == 0 {
+		return rule, fmt.Errorf("rule for '%s' has no target", rule.From)
+	}
+	if rule.To, err = url.Parse(fields[0]); nil != err {
+		return rule, err
+	}
+	for _, placeholder := range placeholderPattern.FindAllString(fields[0], -1) {
+		if !bound[placeholder[1:]] {
+			return rule, fmt.Errorf("target '%s' uses unknown placeholder '%s'", fields[0], placeholder)
+		}
+	}
+	fields = fields[1:]
+
+	if 0 < len(fields) && !strings.Contains(fields[0], "=") {
+		status := strings.TrimSuffix(fields[0], "!")
+		rule.Force = status != fields[0]
+		if rule.Status, err = strconv.Atoi(status); nil != err {
+			return rule, fmt.Errorf("status '%s' is not a number", fields[0])
+		}
+		fields = fields[1:]
+	}
+	switch rule.Status {
+	case http.StatusMovedPermanently, http.StatusFound,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	case http.StatusOK:
+		if "" != rule.To.Host || !strings.HasPrefix(rule.To.Path, "/") {
+			return rule, fmt.Errorf("rewrite target '%s' must be a path", rule.To)
+		}
+	default:
+		return rule, fmt.Errorf("status %d must be 200, 301, 302, 307 or 308", rule.Status)
+	}
+
+	for _, condition := range fields {
+		parts := strings.SplitN(condition, "=", 2)
+		if len(parts) != 2 || !strings.EqualFold(parts[0], "host") || parts[1] == "" {
+			return rule, fmt.Errorf("unsupported condition '%s'", condition)
+		}
+		rule.Hosts = append(rule.Hosts, strings.Split(parts[1], ",")...)
+	}
+	return rule, nil
+}
+
+// isQueryParameter returns true if the field is a query parameter to match
+// rather than a target.
+func isQueryParameter(field string) bool {
+	return strings.Contains(field, "=") &&
+		!strings.HasPrefix(field, "/") && !strings.Contains(field, "://")
+}
+
+// match returns the placeholder values if the request matches the rule.
+func (rule Rule) match(r *http.Request) (map[string]string, bool) {
+	if 0 < len(rule.Hosts) {
+		matched := false
+		for _, host := range rule.Hosts {
+			matched = matched || MatchHost(host, r.Host)
+		}
+		if !matched {
+			return nil, false
+		}
+	}
+
+	values, ok := matchPath(rule.From, r.URL.Path)
+	if !ok {
+		return nil, false
+	}
+
+	query := r.URL.Query()
+	for name, value := range rule.Query {
+		if _, ok := query[name]; !ok {
+			return nil, false
+		}
+		if strings.HasPrefix(value, ":") {
+			values[value[1:]] = query.Get(name)
+		} else if value != query.Get(name) {
+			return nil, false
+		}
+	}
+	return values, true
+}
+
+// matchPath returns the placeholder values if the URL path matches the pattern.
+// Segments of the pattern starting with ':' are placeholders matching any
+// segment, and a final '*' segment matches the rest of the path as the 'splat'
+// placeholder. Leading and trailing slashes are ignored.
+func matchPath(pattern, urlPath string) (map[string]string, bool) {
+	values := map[string]string{}
+	patternSegments, pathSegments := segments(pattern), segments(urlPath)
+	last := len(patternSegments) - 1
+	if 0 <= last && patternSegments[last] == "*" {
+		if len(pathSegments) < last {
+			return nil, false
+		}
+		values["splat"] = strings.Join(pathSegments[last:], "/")
+		patternSegments, pathSegments = patternSegments[:last], pathSegments[:last]
+	}
+	if len(patternSegments) != len(pathSegments) {
+		return nil, false
+	}
+	for index, segment := range patternSegments {
+		if strings.HasPrefix(segment, ":") {
+			values[segment[1:]] = pathSegments[index]
+		} else if segment != pathSegments[index] {
+			return nil, false
+		}
+	}
+	return values, true
+}
+
+// target returns the target of the rule with the placeholders replaced by the
+// values. If neither the target nor the rule has a query, the query of the
+// request is kept.
+func (rule Rule) target(r *http.Request, values map[string]string) *url.URL {
+	replace := func(value string) string {
+		return placeholderPattern.ReplaceAllStringFunc(value, func(placeholder string) string {
+			return values[placeholder[1:]]
+		})
+	}
+
+	target := *rule.To
+	target.Path, target.RawPath = replace(rule.To.Path), ""
+	if "" == rule.To.RawQuery && 0 == len(rule.Query) {
+		target.RawQuery = r.URL.RawQuery
+	} else {
+		query := rule.To.Query()
+		for name := range query {
+			for index, value := range query[name] {
+				query[name][index] = replace(value)
+			}
+		}
+		target.RawQuery = query.Encode()
+	}
+	return &target
+}
+
+// RulesFile is a file of rules that is reloaded when changed.
+type RulesFile struct {
+	filename string
+	mutex    sync.Mutex
+	checked  time.Time
+	modTime  time.Time
+	rules    []Rule
+}
+
+// LoadRules from the file, which is reloaded when changed.
+func LoadRules(filename string) (*RulesFile, error) {
+	info, err := os.Stat(filename)
+	if nil != err {
+		return nil, err
+	}
+	rules, err := readRules(filename)
+	if nil != err {
+		return nil, err
+	}
+	return &RulesFile{
+		filename: filename,
+		checked:  time.Now(),
+		modTime:  info.ModTime(),
+		rules:    rules,
+	}, nil
+}
+
+// Rules returns the current rules, reloading the file if it changed. If the
+// changed file can't be loaded, the error is logged and the previous rules are
+// kept.
+func (file *RulesFile) Rules() []Rule {
+	file.mutex.Lock()
+	defer file.mutex.Unlock()
+
+	if time.Since(file.checked) < checkInterval {
+		return file.rules
+	}
+	file.checked = time.Now()
+
+	info, err := os.Stat(file.filename)
+	if nil != err || info.ModTime().Equal(file.modTime) {
+		return file.rules
+	}
+	file.modTime = info.ModTime()
+	rules, err := readRules(file.filename)
+	if nil != err {
+		log.Printf("Keeping previous rules after failing to reload %s: %v\n", file.filename, err)
+		return file.rules
+	}
+	file.rules = rules
+	return file.rules
+}
+
+// readRules parses the rules of the file.
+func readRules(filename string) ([]Rule, error) {
+	file, err := os.Open(filename)
+	if nil != err {
+		return nil, err
+	}
+	defer file.Close()
+
+	rules, err := ParseRules(file)
+	if nil != err {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return rules, nil
+}
+
+// WithRules applies the first rule matching the request. Redirects are returned
+// to the client, while rewrites are served from the target path. Rules that
+// aren't forced are skipped if the path names a file or directory in the file
+// system, which is served at the URL path prefix.
+func WithRules(
+	serve http.HandlerFunc, fsys fs.FS, urlPrefix string, rules func() []Rule,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		for _, rule := range rules() {
+			values, ok := rule.match(r)
+			if !ok || (!rule.Force && exists(fsys, urlPrefix, r.URL.Path)) {
+				continue
+			}
+
+			target := rule.target(r, values)
+			if rule.Status != http.StatusOK {
+				http.Redirect(w, r, target.String(), rule.Status)
+				return
+			}
+
+			// The file server redirects requests for index.html files to their
+			// directory, so serve the directory instead.
+			if strings.HasSuffix(target.Path, "/index.html") {
+				target.Path = strings.TrimSuffix(target.Path, "index.html")
+			}
+			rewritten := new(http.Request)
+			*rewritten = *r
+			rewritten.URL = target
+			serve(w, rewritten)
+			return
+		}
+		serve(w, r)
+	}
+}
+
+// exists returns true if the URL path names a file or directory in the file
+// system served at the URL path prefix.
+func exists(fsys fs.FS, urlPrefix, urlPath string) bool {
+	if !strings.HasPrefix(urlPath, urlPrefix+"/") {
+		return false
+	}
+	_, err := fs.Stat(fsys, fsName(strings.TrimPrefix(urlPath, urlPrefix)))
+	return nil == err
+}
+
+// segments returns the segments of the URL path, ignoring leading and trailing
+// slashes.
+func segments(urlPath string) []string {
+	urlPath = strings.Trim(urlPath, "/")
+	if urlPath == "" {
+		return nil
+	}
+	return strings.Split(urlPath, "/")
+}
@@ -0,0 +1,206 @@
+package handle
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRules(t *testing.T) {
+	testCases := []struct {
+		name    string
+		rules   string
+		count   int
+		isError bool
+	}{
+		{"Empty", "", 0, false},
+		{"Comments", "# Old site\n\n  # More\n", 0, false},
+		{"Redirect", "/old /new", 1, false},
+		{"Status", "/old /new 302\n/a /b 307\n/c /d 308!", 3, false},
+		{"Rewrite", "/app/* /index.html 200", 1, false},
+		{"Placeholders", "/news/:year/:month/* /blog/:year/:month/:splat", 1, false},
+		{"Query", "/store id=:id /products/:id 301", 1, false},
+		{"Host condition", "/* https://new.example.com/:splat 301! Host=old.example.com,*.old.example.com", 1, false},
+		{"Host URL", "https://old.example.com/* https://new.example.com/:splat", 1, false},
+		{"Relative path", "old /new", 0, true},
+		{"Missing target", "/old", 0, true},
+		{"Missing target w/query", "/old id=1", 0, true},
+		{"Inner splat", "/old/*/page /new", 0, true},
+		{"Unknown placeholder", "/old/:id /new/:name", 0, true},
+		{"Unbound splat", "/old /new/:splat", 0, true},
+		{"Invalid status", "/old /new abc", 0, true},
+		{"Unsupported status", "/old /new 404", 0, true},
+		{"External rewrite", "/old https://example.com/new 200", 0, true},
+		{"Unsupported condition", "/old /new 301 Country=us", 0, true},
+		{"Error line", "/a /b\n/old", 0, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rules, err := ParseRules(strings.NewReader(tc.rules))
+			hasError := nil != err
+			if hasError && !tc.isError {
+				t.Errorf("Expected no error but got %v", err)
+			}
+			if !hasError && tc.isError {
+				t.Error("Expected an error but got no error")
+			}
+			if tc.count != len(rules) {
+				t.Errorf("Expected %d rules but got %d", tc.count, len(rules))
+			}
+		})
+	}
+}
+
+func TestWithRules(t *testing.T) {
+	rules, err := ParseRules(strings.NewReader(`
+# Moved pages.
+/old.html              /new.html
+/moved                 /new.html                   302
+/docs/:version/*       /manual/:version/:splat     308
+/store  id=:id         /products/:id?ref=store     301
+/store  page=all       /products/                  307
+/app/*                 /                           200
+/` + tmpFileName + `   /gone.html
+/` + subDir + `        /forced.html                301!
+/*                     https://new.example.com/:splat  301  Host=old.example.com
+`))
+	if nil != err {
+		t.Fatalf("While parsing rules got %v", err)
+	}
+	echo := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.RequestURI()))
+	}
+
+	testCases := []struct {
+		name     string
+		host     string
+		path     string
+		code     int
+		location string
+		contents string
+	}{
+		{"No rule", "localhost", "/index.html", ok, "", "/index.html"},
+		{"Redirect", "localhost", "/old.html", redirect, "/new.html", ""},
+		{"Redirect w/query", "localhost", "/old.html?a=1", redirect, "/new.html?a=1", ""},
+		{"Redirect w/trailing slash", "localhost", "/moved/", http.StatusFound, "/new.html", ""},
+		{"Placeholder and splat", "localhost", "/docs/v2/api/index.html", http.StatusPermanentRedirect, "/manual/v2/api/index.html", ""},
+		{"Splat too short", "localhost", "/docs", ok, "", "/docs"},
+		{"Query placeholder", "localhost", "/store?id=42", redirect, "/products/42?ref=store", ""},
+		{"Placeholder in value", "localhost", "/docs/:version/:splat", http.StatusPermanentRedirect, "/manual/:version/:splat", ""},
+		{"Query value", "localhost", "/store?page=all", http.StatusTemporaryRedirect, "/products/", ""},
+		{"Query mismatch", "localhost", "/store?page=1", ok, "", "/store?page=1"},
+		{"Rewrite", "localhost", "/app/settings?tab=1", ok, "", "/?tab=1"},
+		{"Existing file", "localhost", "/" + tmpFileName, ok, "", "/" + tmpFileName},
+		{"Forced existing dir", "localhost", "/" + subDir, redirect, "/forced.html", ""},
+		{"Host condition", "old.example.com", "/a/b?c=d", redirect, "https://new.example.com/a/b?c=d", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := WithRules(echo, localFS, "", func() []Rule { return rules })
+			fullpath := "http://" + tc.host + tc.path
+			req := httptest.NewRequest("GET", fullpath, nil)
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			resp := w.Result()
+			body, _ := ioutil.ReadAll(resp.Body)
+			if tc.code != resp.StatusCode {
+				t.Errorf(
+					"While retrieving %s expected status code of %d but got %d",
+					fullpath, tc.code, resp.StatusCode,
+				)
+			}
+			if location := resp.Header.Get("Location"); tc.location != location {
+				t.Errorf(
+					"While retrieving %s expected location '%s' but got '%s'",
+					fullpath, tc.location, location,
+				)
+			}
+			if tc.code == ok && tc.contents != string(body) {
+				t.Errorf(
+					"While retrieving %s expected contents '%s' but got '%s'",
+					fullpath, tc.contents, body,
+				)
+			}
+		})
+	}
+}
+
+func TestWithRulesPrefix(t *testing.T) {
+	rules, err := ParseRules(strings.NewReader("/my/prefix/* /my/prefix/index.html 200"))
+	if nil != err {
+		t.Fatalf("While parsing rules got %v", err)
+	}
+	handler := WithRules(Prefix(serveLocal, "/my/prefix"), localFS, "/my/prefix", func() []Rule { return rules })
+
+	testCases := []struct {
+		path     string
+		contents string
+	}{
+		{"/my/prefix/" + tmpFileName, tmpFile},
+		{"/my/prefix/missing/page", tmpIndex},
+	}
+
+	for _, tc := range testCases {
+		req := httptest.NewRequest("GET", "http://localhost"+tc.path, nil)
+		w := httptest.NewRecorder()
+		handler(w, req)
+		if body := w.Body.String(); tc.contents != body {
+			t.Errorf("While retrieving %s expected contents '%s' but got '%s'", tc.path, tc.contents, body)
+		}
+	}
+}
+
+func TestRulesFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "_redirects")
+	write := func(contents string, modTime time.Time) {
+		if err := ioutil.WriteFile(filename, []byte(contents), 0600); nil != err {
+			t.Fatalf("While writing rules got %v", err)
+		}
+		if err := os.Chtimes(filename, modTime, modTime); nil != err {
+			t.Fatalf("While setting modification time got %v", err)
+		}
+	}
+	now := time.Now()
+	write("/a /b", now.Add(-time.Hour))
+
+	if _, err := LoadRules(filepath.Join(filepath.Dir(filename), "missing")); nil == err {
+		t.Error("While loading missing rules expected an error but got nil")
+	}
+	file, err := LoadRules(filename)
+	if nil != err {
+		t.Fatalf("While loading rules got %v", err)
+	}
+	target := func() string {
+		rules := file.Rules()
+		if len(rules) != 1 {
+			t.Fatalf("Expected 1 rule but got %d", len(rules))
+		}
+		return rules[0].To.String()
+	}
+
+	defer func(interval time.Duration) { checkInterval = interval }(checkInterval)
+	checkInterval = time.Hour
+	write("/a /c", now)
+	if result := target(); "/b" != result {
+		t.Errorf("Before the check interval expected '/b' but got '%s'", result)
+	}
+
+	checkInterval = 0
+	if result := target(); "/c" != result {
+		t.Errorf("After a change expected '/c' but got '%s'", result)
+	}
+
+	write("/a", now.Add(time.Minute))
+	if result := target(); "/c" != result {
+		t.Errorf("After an invalid change expected '/c' but got '%s'", result)
+	}
+}
@@ -0,0 +1,71 @@
+package handle
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// Settings shared by every handler, such as the names of index files. The
+// settings are activated as a whole together with the handler serving requests
+// with them, so they can be replaced while requests are being served.
+type Settings struct {
+	// handler serves requests with the settings once they are activated.
+	handler http.HandlerFunc
+
+	// virtualHosts with certificates selected using SNI.
+	virtualHosts []VirtualHost
+
+	// indexFiles are the names of the files served for directories, in order
+	// of precedence.
+	indexFiles []string
+
+	// contentTypes of file extensions, which take precedence over those of
+	// the system.
+	contentTypes map[string]string
+
+	// contentSniffing detects the content type of files with an unknown
+	// extension from their contents.
+	contentSniffing bool
+
+	// listingReadme renders the 'README.md' file of directories beneath their
+	// listing.
+	listingReadme bool
+}
+
+// settings holds the active *Settings.
+var settings atomic.Value
+
+func init() {
+	settings.Store(NewSettings())
+}
+
+// NewSettings returns the default settings, which can be changed before being
+// activated.
+func NewSettings() *Settings {
+	defaults := &Settings{
+		indexFiles:      []string{"index.html"},
+		contentSniffing: true,
+	}
+	// The built-in content types are valid, so setting them can't fail.
+	defaults.SetContentTypes(nil, nil)
+	return defaults
+}
+
+// loadSettings returns the active settings, which mustn't be modified.
+func loadSettings() *Settings {
+	return settings.Load().(*Settings)
+}
+
+// Activate the settings with the handler serving requests with them, replacing
+// the active settings and handler in a single step so that no request is served
+// with the settings of another handler.
+func Activate(activated *Settings, handler http.HandlerFunc) {
+	updated := *activated
+	updated.handler = handler
+	settings.Store(&updated)
+}
+
+// ServeActive serves the request with the handler of the active settings.
+func ServeActive(w http.ResponseWriter, r *http.Request) {
+	loadSettings().handler(w, r)
+}
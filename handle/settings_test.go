@@ -0,0 +1,37 @@
+package handle
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// activateSettings activates the default settings changed by the update
+// function until the test and its subtests complete.
+func activateSettings(t *testing.T, update func(*Settings)) {
+	previous := loadSettings()
+	t.Cleanup(func() { Activate(previous, previous.handler) })
+	activated := NewSettings()
+	update(activated)
+	Activate(activated, previous.handler)
+}
+
+func TestActivate(t *testing.T) {
+	previous := loadSettings()
+	defer Activate(previous, previous.handler)
+
+	settings := NewSettings()
+	settings.SetIndexFiles([]string{"default.html"})
+	Activate(settings, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(loadSettings().indexFiles[0]))
+	})
+
+	// Changes after activation don't change the active settings.
+	settings.SetIndexFiles([]string{"index.htm"})
+
+	w := httptest.NewRecorder()
+	ServeActive(w, httptest.NewRequest("GET", "http://localhost/", nil))
+	if "default.html" != w.Body.String() {
+		t.Errorf("Expected the activated settings 'default.html' but got '%s'", w.Body.String())
+	}
+}
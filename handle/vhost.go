@@ -0,0 +1,114 @@
+package handle
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// VirtualHost serves the requests with a host matching one of the patterns. A
+// pattern is either a host name or a wildcard, such as '*.example.com', that
+// matches every subdomain of the host name.
+type VirtualHost struct {
+	Patterns []string
+	Handler  http.HandlerFunc
+
+	// Certificate presented to clients requesting a matching host name using
+	// SNI. If nil, the default certificate is presented.
+	Certificate *tls.Certificate
+}
+
+// WithVirtualHosts serves each request with the virtual host matching the host
+// of the request. Exact host names take precedence over wildcards, and longer
+// wildcards over shorter ones. Requests for unknown hosts are served by serve,
+// unless unknownCode is set, in which case the status code is returned. Requests
+// for a host that wasn't served the certificate selected during the TLS
+// handshake return 'MISDIRECTED REQUEST'.
+func WithVirtualHosts(serve http.HandlerFunc, hosts []VirtualHost, unknownCode int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		host := findVirtualHost(hosts, r.Host)
+
+		// The connection may have been reused from a request for another host
+		// name that doesn't share the certificate of this host.
+		if nil != r.TLS && "" != r.TLS.ServerName {
+			if certificate(findVirtualHost(hosts, r.TLS.ServerName)) != certificate(host) {
+				code := http.StatusMisdirectedRequest
+				http.Error(w, http.StatusText(code), code)
+				return
+			}
+		}
+
+		switch {
+		case nil != host:
+			host.Handler(w, r)
+		case http.StatusNotFound == unknownCode:
+			http.NotFound(w, r)
+		case 0 != unknownCode:
+			http.Error(w, http.StatusText(unknownCode), unknownCode)
+		default:
+			serve(w, r)
+		}
+	}
+}
+
+// SetVirtualHosts whose certificates are selected using SNI when serving with
+// TLS.
+func (s *Settings) SetVirtualHosts(hosts []VirtualHost) {
+	s.virtualHosts = hosts
+}
+
+// getCertificate returns the certificate of the virtual host matching the host
+// name requested by the client. If none do, nil is returned for the default
+// certificate to be presented.
+func getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return certificate(findVirtualHost(loadSettings().virtualHosts, hello.ServerName)), nil
+}
+
+// certificate of the virtual host or nil for the default certificate.
+func certificate(host *VirtualHost) *tls.Certificate {
+	if nil == host {
+		return nil
+	}
+	return host.Certificate
+}
+
+// findVirtualHost returns the virtual host best matching the host or nil if no
+// virtual host matches.
+func findVirtualHost(hosts []VirtualHost, host string) *VirtualHost {
+	host = normalizeHost(host)
+	var found *VirtualHost
+	longest := 0
+	for index := range hosts {
+		for _, pattern := range hosts[index].Patterns {
+			pattern = strings.ToLower(pattern)
+			if pattern == host {
+				return &hosts[index]
+			}
+			if len(pattern) > longest && MatchHost(pattern, host) {
+				found, longest = &hosts[index], len(pattern)
+			}
+		}
+	}
+	return found
+}
+
+// MatchHost returns true if the host matches the pattern. A pattern starting
+// with '*.' matches every subdomain of the remainder of the pattern, but not the
+// remainder itself. Matching is not case-sensitive.
+func MatchHost(pattern, host string) bool {
+	pattern, host = strings.ToLower(pattern), normalizeHost(host)
+	if strings.HasPrefix(pattern, "*.") {
+		return strings.HasSuffix(host, pattern[1:]) && len(host) > len(pattern)-1
+	}
+	return pattern == host
+}
+
+// normalizeHost removes the port and trailing dot from the host and converts it
+// to lowercase.
+func normalizeHost(host string) string {
+	if name, _, err := net.SplitHostPort(host); nil == err {
+		host = name
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
@@ -0,0 +1,136 @@
+package handle
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMatchHost(t *testing.T) {
+	testCases := []struct {
+		pattern string
+		host    string
+		result  bool
+	}{
+		{"example.com", "example.com", true},
+		{"example.com", "EXAMPLE.com", true},
+		{"example.com", "example.com:8080", true},
+		{"example.com", "example.com.", true},
+		{"example.com", "www.example.com", false},
+		{"*.example.com", "www.example.com", true},
+		{"*.example.com", "a.b.example.com", true},
+		{"*.example.com", "example.com", false},
+		{"*.example.com", ".example.com", false},
+		{"*.example.com", "badexample.com", false},
+		{"[::1]", "[::1]:8080", false},
+		{"::1", "[::1]:8080", true},
+	}
+
+	for _, tc := range testCases {
+		if result := MatchHost(tc.pattern, tc.host); tc.result != result {
+			t.Errorf(
+				"While matching %s with %s expected %t but got %t",
+				tc.host, tc.pattern, tc.result, result,
+			)
+		}
+	}
+}
+
+func TestWithVirtualHosts(t *testing.T) {
+	named := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name))
+		}
+	}
+	docsCert, assetsCert := &tls.Certificate{}, &tls.Certificate{}
+	hosts := []VirtualHost{
+		{Patterns: []string{"*.example.com"}, Handler: named("wildcard")},
+		{Patterns: []string{"docs.example.com", "*.docs.example.com"}, Handler: named("docs"), Certificate: docsCert},
+		{Patterns: []string{"assets.example.com"}, Handler: named("assets"), Certificate: assetsCert},
+	}
+
+	testCases := []struct {
+		name       string
+		host       string
+		serverName string
+		unknown    int
+		code       int
+		contents   string
+	}{
+		{"Exact", "docs.example.com", "", 0, ok, "docs"},
+		{"Exact w/port", "assets.example.com:8080", "", 0, ok, "assets"},
+		{"Wildcard", "www.example.com", "", 0, ok, "wildcard"},
+		{"Longest wildcard", "v1.docs.example.com", "", 0, ok, "docs"},
+		{"Unknown default", "other.com", "", 0, ok, "default"},
+		{"Unknown not found", "other.com", "", http.StatusNotFound, missing, ""},
+		{"Unknown misdirected", "other.com", "", http.StatusMisdirectedRequest, http.StatusMisdirectedRequest, ""},
+		{"SNI match", "docs.example.com", "docs.example.com", 0, ok, "docs"},
+		{"SNI same certificate", "v1.docs.example.com", "docs.example.com", 0, ok, "docs"},
+		{"SNI default certificate", "www.example.com", "other.com", 0, ok, "wildcard"},
+		{"SNI mismatch", "assets.example.com", "docs.example.com", 0, http.StatusMisdirectedRequest, ""},
+		{"SNI mismatch default", "docs.example.com", "www.example.com", 0, http.StatusMisdirectedRequest, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := WithVirtualHosts(named("default"), hosts, tc.unknown)
+			req := httptest.NewRequest("GET", "http://"+tc.host+"/", nil)
+			if "" != tc.serverName {
+				req.TLS = &tls.ConnectionState{ServerName: tc.serverName}
+			}
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			resp := w.Result()
+			body, err := ioutil.ReadAll(resp.Body)
+			if nil != err {
+				t.Errorf("While reading body got %v", err)
+			}
+			if tc.code != resp.StatusCode {
+				t.Errorf(
+					"While retrieving %s expected status code of %d but got %d",
+					tc.host, tc.code, resp.StatusCode,
+				)
+			}
+			if tc.code == ok && tc.contents != string(body) {
+				t.Errorf(
+					"While retrieving %s expected contents '%s' but got '%s'",
+					tc.host, tc.contents, body,
+				)
+			}
+		})
+	}
+}
+
+func TestGetCertificate(t *testing.T) {
+	docsCert := &tls.Certificate{}
+	activateSettings(t, func(s *Settings) {
+		s.SetVirtualHosts([]VirtualHost{
+			{Patterns: []string{"docs.example.com"}, Certificate: docsCert},
+			{Patterns: []string{"*.example.com"}},
+		})
+	})
+
+	testCases := []struct {
+		serverName  string
+		certificate *tls.Certificate
+	}{
+		{"docs.example.com", docsCert},
+		{"www.example.com", nil},
+		{"other.com", nil},
+		{"", nil},
+	}
+
+	for _, tc := range testCases {
+		certificate, err := getCertificate(&tls.ClientHelloInfo{ServerName: tc.serverName})
+		if nil != err {
+			t.Errorf("While getting certificate of %s expected no error but got %v", tc.serverName, err)
+		}
+		if tc.certificate != certificate {
+			t.Errorf("While getting certificate of %s got the wrong certificate", tc.serverName)
+		}
+	}
+}
@@ -0,0 +1,629 @@
+package storage
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// archiveExtensions are the file extensions of supported archives.
+	archiveExtensions = []string{".zip", ".tar", ".tar.gz", ".tgz"}
+)
+
+const (
+	// maxOpenedArchives is the number of opened archives reused by Archives,
+	// with the least recently used archive closed first.
+	maxOpenedArchives = 64
+
+	// maxDeflateRatio is the largest ratio of the uncompressed to the
+	// compressed size of deflated data. Entries claiming more are corrupt or
+	// crafted and are left out of the file system.
+	maxDeflateRatio = 1032
+)
+
+// IsArchive returns true if the name has the file extension of a supported
+// archive (zip, tar or gzipped tar).
+func IsArchive(name string) bool {
+	lower := strings.ToLower(name)
+	for _, ext := range archiveExtensions {
+		if strings.HasSuffix(lower, ext) && len(lower) > len(ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// Archives opens archives within a file system as file systems. Opened
+// archives are reused until the archive file is modified, with only the most
+// recently used archives kept.
+type Archives struct {
+	fsys   fs.FS
+	mutex  sync.Mutex
+	opened map[string]*openedArchive
+	uses   uint64
+}
+
+// openedArchive is a previously opened archive along with the state of the
+// archive file when it was opened.
+type openedArchive struct {
+	fsys    *ArchiveFS
+	modTime time.Time
+	size    int64
+	// lastUse orders the opened archives from the least recently used.
+	lastUse uint64
+}
+
+// NewArchives returns Archives for opening the archives within fsys.
+func NewArchives(fsys fs.FS) *Archives {
+	return &Archives{fsys: fsys, opened: make(map[string]*openedArchive)}
+}
+
+// Open the named archive as a file system, reusing the file system if the
+// archive has already been opened and has not been modified since.
+func (archives *Archives) Open(name string) (*ArchiveFS, error) {
+	stat, err := fs.Stat(archives.fsys, name)
+	if nil != err {
+		return nil, err
+	}
+
+	archives.mutex.Lock()
+	defer archives.mutex.Unlock()
+	if opened, ok := archives.opened[name]; ok &&
+		opened.modTime.Equal(stat.ModTime()) && opened.size == stat.Size() {
+		archives.uses++
+		opened.lastUse = archives.uses
+		return opened.fsys, nil
+	}
+
+	fsys, err := OpenArchive(archives.fsys, name)
+	if nil != err {
+		delete(archives.opened, name)
+		return nil, err
+	}
+	if _, ok := archives.opened[name]; !ok && len(archives.opened) >= maxOpenedArchives {
+		archives.evict()
+	}
+	archives.uses++
+	archives.opened[name] = &openedArchive{
+		fsys:    fsys,
+		modTime: stat.ModTime(),
+		size:    stat.Size(),
+		lastUse: archives.uses,
+	}
+	return fsys, nil
+}
+
+// evict the least recently used of the opened archives.
+func (archives *Archives) evict() {
+	var oldest string
+	for name, opened := range archives.opened {
+		if oldest == "" || opened.lastUse < archives.opened[oldest].lastUse {
+			oldest = name
+		}
+	}
+	delete(archives.opened, oldest)
+}
+
+// ArchiveFS is a read-only file system of the contents of a zip or tar archive.
+// Files opened from the file system implement io.Seeker to support range
+// requests. Uncompressed files are read directly from the archive file while
+// compressed files are decompressed as they are read, decompressing again from
+// the start of the file (or, for gzipped tar archives, of the archive) to seek
+// backwards.
+type ArchiveFS struct {
+	parent fs.FS
+	name   string
+	root   *archiveEntry
+}
+
+// OpenArchive indexes the contents of the named archive file (zip, tar or
+// gzipped tar, based on the file extension) within the parent file system and
+// returns it as a file system. Files opened from the parent file system must
+// implement io.ReaderAt to read zip and uncompressed tar archives.
+func OpenArchive(parent fs.FS, name string) (*ArchiveFS, error) {
+	stat, err := fs.Stat(parent, name)
+	if nil != err {
+		return nil, err
+	}
+	fsys := &ArchiveFS{
+		parent: parent,
+		name:   name,
+		root: &archiveEntry{
+			name:    ".",
+			mode:    fs.ModeDir | 0555,
+			modTime: stat.ModTime(),
+		},
+	}
+
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		err = fsys.indexZip(stat.Size())
+	case strings.HasSuffix(lower, ".tar"):
+		err = fsys.indexTar(false)
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		err = fsys.indexTar(true)
+	default:
+		err = fmt.Errorf("unknown archive type for '%s'", name)
+	}
+	if nil != err {
+		return nil, err
+	}
+	return fsys, nil
+}
+
+// indexZip adds the contents of the zip archive to the file system.
+func (fsys *ArchiveFS) indexZip(size int64) error {
+	file, readerAt, err := fsys.openArchive()
+	if nil != err {
+		return err
+	}
+	defer file.Close()
+
+	archive, err := zip.NewReader(readerAt, size)
+	if nil != err {
+		return err
+	}
+	for _, zipFile := range archive.File {
+		if zipFile.Method != zip.Store && zipFile.Method != zip.Deflate {
+			continue
+		}
+		offset, err := zipFile.DataOffset()
+		if nil != err {
+			return err
+		}
+		if !validZipSizes(zipFile, offset, size) {
+			continue
+		}
+		info := zipFile.FileInfo()
+		fsys.add(zipFile.Name, &archiveEntry{
+			mode:       info.Mode(),
+			modTime:    info.ModTime(),
+			size:       int64(zipFile.UncompressedSize64),
+			offset:     offset,
+			compressed: int64(zipFile.CompressedSize64),
+			deflated:   zipFile.Method == zip.Deflate,
+		})
+	}
+	return nil
+}
+
+// validZipSizes returns true if the sizes of the zip file fit within the
+// archive of the size and, for deflated files, the uncompressed size is one
+// that deflating could have produced.
+func validZipSizes(zipFile *zip.File, offset, size int64) bool {
+	compressed, uncompressed := zipFile.CompressedSize64, zipFile.UncompressedSize64
+	if offset < 0 || offset > size || compressed > uint64(size-offset) {
+		return false
+	}
+	if zipFile.Method == zip.Store {
+		return compressed == uncompressed
+	}
+	return uncompressed/maxDeflateRatio <= compressed
+}
+
+// indexTar adds the contents of the tar archive to the file system. The
+// offsets of the contents of gzipped tar archives are offsets within the
+// decompressed archive.
+func (fsys *ArchiveFS) indexTar(gzipped bool) error {
+	file, err := fsys.parent.Open(fsys.name)
+	if nil != err {
+		return err
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+	if gzipped {
+		decompressor, err := gzip.NewReader(file)
+		if nil != err {
+			return err
+		}
+		defer decompressor.Close()
+		reader = decompressor
+	}
+	counter := &countingReader{reader: reader}
+
+	archive := tar.NewReader(counter)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if nil != err {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeDir {
+			continue
+		}
+		fsys.add(header.Name, &archiveEntry{
+			mode:    header.FileInfo().Mode(),
+			modTime: header.ModTime,
+			size:    header.Size,
+			offset:  counter.count,
+			gzipped: gzipped,
+		})
+	}
+}
+
+// openArchive opens the archive file from the parent file system for random
+// access.
+func (fsys *ArchiveFS) openArchive() (fs.File, io.ReaderAt, error) {
+	file, err := fsys.parent.Open(fsys.name)
+	if nil != err {
+		return nil, nil, err
+	}
+	readerAt, ok := file.(io.ReaderAt)
+	if !ok {
+		file.Close()
+		return nil, nil, fmt.Errorf("archive '%s' does not support random access", fsys.name)
+	}
+	return file, readerAt, nil
+}
+
+// add the entry to the file system with the name from the archive, creating
+// any missing parent directories. Names that would escape the root of the
+// archive are ignored.
+func (fsys *ArchiveFS) add(name string, entry *archiveEntry) {
+	name = path.Clean(strings.TrimLeft(name, "/"))
+	if !fs.ValidPath(name) || name == "." {
+		return
+	}
+
+	parent := fsys.root
+	segments := strings.Split(name, "/")
+	for _, segment := range segments[:len(segments)-1] {
+		child, ok := parent.children[segment]
+		if !ok {
+			child = &archiveEntry{
+				name:    segment,
+				mode:    fs.ModeDir | 0555,
+				modTime: fsys.root.modTime,
+			}
+			parent.addChild(child)
+		}
+		if !child.IsDir() {
+			return
+		}
+		parent = child
+	}
+
+	entry.name = segments[len(segments)-1]
+	if existing, ok := parent.children[entry.name]; ok && existing.IsDir() && entry.IsDir() {
+		// Keep the contents of a directory created before its own entry.
+		existing.mode = entry.mode
+		existing.modTime = entry.modTime
+		return
+	}
+	parent.addChild(entry)
+}
+
+// lookup returns the entry for the name.
+func (fsys *ArchiveFS) lookup(op, name string) (*archiveEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	entry := fsys.root
+	if name == "." {
+		return entry, nil
+	}
+	for _, segment := range strings.Split(name, "/") {
+		child, ok := entry.children[segment]
+		if !ok {
+			return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+		entry = child
+	}
+	return entry, nil
+}
+
+// Open the named file or directory.
+func (fsys *ArchiveFS) Open(name string) (fs.File, error) {
+	entry, err := fsys.lookup("open", name)
+	if nil != err {
+		return nil, err
+	}
+	if entry.IsDir() {
+		return &archiveDir{archiveEntry: entry, entries: dirEntries{entries: entry.sortedChildren()}}, nil
+	}
+
+	reader, closer, err := fsys.openEntry(entry)
+	if nil != err {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &archiveFile{archiveEntry: entry, ReadSeeker: reader, closer: closer}, nil
+}
+
+// openEntry returns a reader of the contents of the file entry.
+func (fsys *ArchiveFS) openEntry(entry *archiveEntry) (io.ReadSeeker, io.Closer, error) {
+	switch {
+	case entry.gzipped:
+		stream := &streamReader{size: entry.size, open: func() (io.Reader, []io.Closer, error) {
+			return fsys.openGzipped(entry)
+		}}
+		return stream, stream, nil
+	case entry.deflated:
+		stream := &streamReader{size: entry.size, open: func() (io.Reader, []io.Closer, error) {
+			return fsys.openDeflated(entry)
+		}}
+		return stream, stream, nil
+	}
+
+	file, readerAt, err := fsys.openArchive()
+	if nil != err {
+		return nil, nil, err
+	}
+	return io.NewSectionReader(readerAt, entry.offset, entry.size), file, nil
+}
+
+// openDeflated returns a reader of the decompressed contents of the deflated
+// file entry, limited to the size of the file.
+func (fsys *ArchiveFS) openDeflated(entry *archiveEntry) (io.Reader, []io.Closer, error) {
+	file, readerAt, err := fsys.openArchive()
+	if nil != err {
+		return nil, nil, err
+	}
+	decompressor := flate.NewReader(io.NewSectionReader(readerAt, entry.offset, entry.compressed))
+	return io.LimitReader(decompressor, entry.size), []io.Closer{decompressor, file}, nil
+}
+
+// openGzipped returns a reader of the contents of the file entry of a gzipped
+// tar archive, limited to the size of the file. The archive is decompressed
+// from the start up to the contents of the file.
+func (fsys *ArchiveFS) openGzipped(entry *archiveEntry) (io.Reader, []io.Closer, error) {
+	file, err := fsys.parent.Open(fsys.name)
+	if nil != err {
+		return nil, nil, err
+	}
+	decompressor, err := gzip.NewReader(file)
+	if nil != err {
+		file.Close()
+		return nil, nil, err
+	}
+	closers := []io.Closer{decompressor, file}
+	if _, err = io.CopyN(ioutil.Discard, decompressor, entry.offset); nil != err {
+		closeAll(closers)
+		return nil, nil, err
+	}
+	return io.LimitReader(decompressor, entry.size), closers, nil
+}
+
+// ReadDir reads the named directory and returns its entries sorted by name.
+func (fsys *ArchiveFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entry, err := fsys.lookup("readdir", name)
+	if nil != err {
+		return nil, err
+	}
+	if !entry.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	return entry.sortedChildren(), nil
+}
+
+// Stat returns the file information of the named file or directory.
+func (fsys *ArchiveFS) Stat(name string) (fs.FileInfo, error) {
+	entry, err := fsys.lookup("stat", name)
+	if nil != err {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// archiveEntry is a file or directory within an archive. It serves as both the
+// fs.FileInfo and fs.DirEntry of the file or directory.
+type archiveEntry struct {
+	name    string
+	mode    fs.FileMode
+	modTime time.Time
+	size    int64
+
+	// Location of the contents of a file within the archive file or, for
+	// gzipped tar archives, within the decompressed archive.
+	offset     int64
+	compressed int64
+	deflated   bool
+	gzipped    bool
+
+	children map[string]*archiveEntry
+}
+
+func (entry *archiveEntry) Name() string               { return entry.name }
+func (entry *archiveEntry) Size() int64                { return entry.size }
+func (entry *archiveEntry) Mode() fs.FileMode          { return entry.mode }
+func (entry *archiveEntry) ModTime() time.Time         { return entry.modTime }
+func (entry *archiveEntry) IsDir() bool                { return entry.mode.IsDir() }
+func (entry *archiveEntry) Sys() interface{}           { return nil }
+func (entry *archiveEntry) Type() fs.FileMode          { return entry.mode.Type() }
+func (entry *archiveEntry) Info() (fs.FileInfo, error) { return entry, nil }
+
+// addChild to the directory entry.
+func (entry *archiveEntry) addChild(child *archiveEntry) {
+	if entry.children == nil {
+		entry.children = make(map[string]*archiveEntry)
+	}
+	entry.children[child.name] = child
+}
+
+// sortedChildren returns the entries of the directory sorted by name.
+func (entry *archiveEntry) sortedChildren() []fs.DirEntry {
+	children := make([]fs.DirEntry, 0, len(entry.children))
+	for _, child := range entry.children {
+		children = append(children, child)
+	}
+	sort.Slice(children, func(i, j int) bool {
+		return children[i].Name() < children[j].Name()
+	})
+	return children
+}
+
+// archiveFile is an open file within an archive.
+type archiveFile struct {
+	*archiveEntry
+	io.ReadSeeker
+	closer io.Closer
+}
+
+func (file *archiveFile) Stat() (fs.FileInfo, error) { return file.archiveEntry, nil }
+
+// Close the file.
+func (file *archiveFile) Close() error {
+	if file.closer == nil {
+		return nil
+	}
+	return file.closer.Close()
+}
+
+// archiveDir is an open directory within an archive.
+type archiveDir struct {
+	*archiveEntry
+	entries dirEntries
+}
+
+func (dir *archiveDir) Stat() (fs.FileInfo, error) { return dir.archiveEntry, nil }
+func (dir *archiveDir) Close() error               { return nil }
+
+// Read always fails as directories have no contents.
+func (dir *archiveDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: dir.name, Err: errors.New("is a directory")}
+}
+
+// ReadDir returns the next n entries of the directory or, if n <= 0, all
+// remaining entries.
+func (dir *archiveDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	return dir.entries.next(n)
+}
+
+// dirEntries are the entries of an open directory, read in order.
+type dirEntries struct {
+	entries []fs.DirEntry
+	offset  int
+}
+
+// next returns the next n entries or, if n <= 0, all remaining entries.
+func (dir *dirEntries) next(n int) ([]fs.DirEntry, error) {
+	remaining := dir.entries[dir.offset:]
+	if n <= 0 {
+		dir.offset = len(dir.entries)
+		return remaining, nil
+	}
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(remaining) {
+		n = len(remaining)
+	}
+	dir.offset += n
+	return remaining[:n], nil
+}
+
+// streamReader reads the contents of a file that can only be read in order,
+// such as a compressed file. Seeking only moves the offset, with the contents
+// skipped when next read, and seeking backwards opens the contents again.
+type streamReader struct {
+	open    func() (io.Reader, []io.Closer, error)
+	size    int64
+	offset  int64
+	reader  io.Reader
+	closers []io.Closer
+	// read is the offset of the reader within the contents.
+	read int64
+}
+
+// Read the contents at the offset.
+func (stream *streamReader) Read(b []byte) (int, error) {
+	if stream.offset >= stream.size {
+		return 0, io.EOF
+	}
+	if nil != stream.reader && stream.offset < stream.read {
+		stream.Close()
+	}
+	if nil == stream.reader {
+		reader, closers, err := stream.open()
+		if nil != err {
+			return 0, err
+		}
+		stream.reader, stream.closers, stream.read = reader, closers, 0
+	}
+	if skip := stream.offset - stream.read; 0 < skip {
+		skipped, err := io.CopyN(ioutil.Discard, stream.reader, skip)
+		stream.read += skipped
+		if nil != err {
+			return 0, unexpectedEOF(err)
+		}
+	}
+
+	if remaining := stream.size - stream.offset; int64(len(b)) > remaining {
+		b = b[:remaining]
+	}
+	n, err := stream.reader.Read(b)
+	stream.read += int64(n)
+	stream.offset += int64(n)
+	if err == io.EOF && stream.offset < stream.size {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// Seek sets the offset of the next read.
+func (stream *streamReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += stream.offset
+	case io.SeekEnd:
+		offset += stream.size
+	}
+	if offset < 0 {
+		return 0, errors.New("seek to a negative offset")
+	}
+	stream.offset = offset
+	return offset, nil
+}
+
+// Close the contents being read, if open.
+func (stream *streamReader) Close() error {
+	err := closeAll(stream.closers)
+	stream.reader, stream.closers = nil, nil
+	return err
+}
+
+// closeAll closes the closers in order, returning the first error.
+func closeAll(closers []io.Closer) (err error) {
+	for _, closer := range closers {
+		if closeErr := closer.Close(); nil == err {
+			err = closeErr
+		}
+	}
+	return
+}
+
+// unexpectedEOF returns io.ErrUnexpectedEOF in place of io.EOF, as the
+// contents ended before their size.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// countingReader counts the bytes read from the wrapped reader.
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (counter *countingReader) Read(b []byte) (n int, err error) {
+	n, err = counter.reader.Read(b)
+	counter.count += int64(n)
+	return
+}
@@ -0,0 +1,346 @@
+package storage
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+var (
+	archiveContents = map[string]string{
+		"index.html":          "Space: the final frontier",
+		"sub/file.txt":        "These are the voyages of the starship Enterprise.",
+		"sub/deep/stored.txt": "Its continuing mission:",
+	}
+	archiveModTime = time.Date(2020, 4, 1, 12, 0, 0, 0, time.UTC)
+)
+
+// writeZip creates a zip archive of archiveContents where 'stored.txt' files
+// are not compressed.
+func writeZip(t *testing.T, filename string) {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for name, contents := range archiveContents {
+		method := zip.Deflate
+		if filepath.Base(name) == "stored.txt" {
+			method = zip.Store
+		}
+		writer, err := archive.CreateHeader(&zip.FileHeader{
+			Name:     name,
+			Method:   method,
+			Modified: archiveModTime,
+		})
+		if nil != err {
+			t.Fatalf("While creating zip entry got %v", err)
+		}
+		writer.Write([]byte(contents))
+	}
+	if err := archive.Close(); nil != err {
+		t.Fatalf("While closing zip got %v", err)
+	}
+	if err := ioutil.WriteFile(filename, buf.Bytes(), 0600); nil != err {
+		t.Fatalf("While writing zip got %v", err)
+	}
+}
+
+// writeTar creates an optionally gzipped tar archive of archiveContents,
+// including an explicit entry for the 'sub' directory.
+func writeTar(t *testing.T, filename string, gzipped bool) {
+	var buf bytes.Buffer
+	var writer io.Writer = &buf
+	var compressor *gzip.Writer
+	if gzipped {
+		compressor = gzip.NewWriter(&buf)
+		writer = compressor
+	}
+	archive := tar.NewWriter(writer)
+	archive.WriteHeader(&tar.Header{
+		Name: "sub/", Typeflag: tar.TypeDir, Mode: 0755, ModTime: archiveModTime,
+	})
+	for name, contents := range archiveContents {
+		archive.WriteHeader(&tar.Header{
+			Name:     name,
+			Typeflag: tar.TypeReg,
+			Mode:     0644,
+			Size:     int64(len(contents)),
+			ModTime:  archiveModTime,
+		})
+		archive.Write([]byte(contents))
+	}
+	archive.WriteHeader(&tar.Header{
+		Name: "../escape.txt", Typeflag: tar.TypeReg, Mode: 0644,
+	})
+	if err := archive.Close(); nil != err {
+		t.Fatalf("While closing tar got %v", err)
+	}
+	if gzipped {
+		compressor.Close()
+	}
+	if err := ioutil.WriteFile(filename, buf.Bytes(), 0600); nil != err {
+		t.Fatalf("While writing tar got %v", err)
+	}
+}
+
+func TestOpenArchive(t *testing.T) {
+	dir := t.TempDir()
+	testCases := []struct {
+		name   string
+		create func(*testing.T, string)
+	}{
+		{"docs.zip", writeZip},
+		{"docs.tar", func(t *testing.T, filename string) { writeTar(t, filename, false) }},
+		{"docs.tar.gz", func(t *testing.T, filename string) { writeTar(t, filename, true) }},
+		{"docs.TGZ", func(t *testing.T, filename string) { writeTar(t, filename, true) }},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			filename := filepath.Join(dir, tc.name)
+			tc.create(t, filename)
+
+			fsys, err := OpenArchive(Local(dir), tc.name)
+			if nil != err {
+				t.Fatalf("While opening archive got %v", err)
+			}
+			if err := fstest.TestFS(fsys, "index.html", "sub/file.txt", "sub/deep/stored.txt"); nil != err {
+				t.Error(err)
+			}
+
+			for name, expected := range archiveContents {
+				contents, err := fs.ReadFile(fsys, name)
+				if nil != err {
+					t.Errorf("While reading %s got %v", name, err)
+				}
+				if expected != string(contents) {
+					t.Errorf("For %s expected '%s' but got '%s'", name, expected, contents)
+				}
+			}
+
+			stat, err := fs.Stat(fsys, "sub/file.txt")
+			if nil != err {
+				t.Fatalf("While getting stat got %v", err)
+			}
+			if !archiveModTime.Equal(stat.ModTime()) {
+				t.Errorf("Expected modification time %v but got %v", archiveModTime, stat.ModTime())
+			}
+		})
+	}
+}
+
+func TestArchiveFileSeek(t *testing.T) {
+	dir := t.TempDir()
+	writeZip(t, filepath.Join(dir, "docs.zip"))
+	writeTar(t, filepath.Join(dir, "docs.tar.gz"), true)
+
+	for _, archive := range []string{"docs.zip", "docs.tar.gz"} {
+		fsys, err := LocalArchive(filepath.Join(dir, archive))
+		if nil != err {
+			t.Fatalf("While opening %s got %v", archive, err)
+		}
+		for _, name := range []string{"sub/file.txt", "sub/deep/stored.txt"} {
+			file, err := fsys.Open(name)
+			if nil != err {
+				t.Fatalf("While opening %s of %s got %v", name, archive, err)
+			}
+			seeker, ok := file.(io.Seeker)
+			if !ok {
+				t.Fatalf("Expected %s of %s to implement io.Seeker", name, archive)
+			}
+			// Read to the end, then seek backwards.
+			ioutil.ReadAll(file)
+			if _, err := seeker.Seek(4, io.SeekStart); nil != err {
+				t.Errorf("While seeking %s of %s got %v", name, archive, err)
+			}
+			contents, _ := ioutil.ReadAll(file)
+			if expected := archiveContents[name][4:]; expected != string(contents) {
+				t.Errorf("For %s of %s expected '%s' but got '%s'", name, archive, expected, contents)
+			}
+			file.Close()
+		}
+	}
+}
+
+func TestOpenArchiveCraftedSizes(t *testing.T) {
+	var compressed bytes.Buffer
+	compressor, _ := flate.NewWriter(&compressed, flate.BestCompression)
+	compressor.Write([]byte("short"))
+	compressor.Close()
+
+	testCases := []struct {
+		name     string
+		method   uint16
+		size     uint64
+		exists   bool
+		contents string
+	}{
+		{"huge.txt", zip.Deflate, 1 << 62, false, ""},
+		{"stored.txt", zip.Store, 1 << 30, false, ""},
+		{"truncated.txt", zip.Deflate, 100, true, "short"},
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for _, tc := range testCases {
+		writer, err := archive.CreateRaw(&zip.FileHeader{
+			Name:               tc.name,
+			Method:             tc.method,
+			CompressedSize64:   uint64(compressed.Len()),
+			UncompressedSize64: tc.size,
+		})
+		if nil != err {
+			t.Fatalf("While creating zip entry got %v", err)
+		}
+		writer.Write(compressed.Bytes())
+	}
+	archive.Close()
+
+	fsys, err := OpenArchive(fstest.MapFS{"crafted.zip": {Data: buf.Bytes()}}, "crafted.zip")
+	if nil != err {
+		t.Fatalf("While opening archive got %v", err)
+	}
+	for _, tc := range testCases {
+		contents, err := fs.ReadFile(fsys, tc.name)
+		if !tc.exists {
+			if !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("While reading %s expected %v but got %v", tc.name, fs.ErrNotExist, err)
+			}
+			continue
+		}
+		if !errors.Is(err, io.ErrUnexpectedEOF) || tc.contents != string(contents) {
+			t.Errorf("While reading %s expected '%s' and %v but got '%s' and %v", tc.name, tc.contents, io.ErrUnexpectedEOF, contents, err)
+		}
+	}
+}
+
+func TestOpenArchiveErrors(t *testing.T) {
+	dir := t.TempDir()
+	bad := filepath.Join(dir, "bad.zip")
+	if err := ioutil.WriteFile(bad, []byte("not a zip"), 0600); nil != err {
+		t.Fatalf("While writing file got %v", err)
+	}
+	unknown := filepath.Join(dir, "unknown.rar")
+	if err := ioutil.WriteFile(unknown, []byte("not a rar"), 0600); nil != err {
+		t.Fatalf("While writing file got %v", err)
+	}
+
+	for _, filename := range []string{bad, unknown, filepath.Join(dir, "missing.zip")} {
+		if _, err := LocalArchive(filename); nil == err {
+			t.Errorf("While opening %s expected error but got nil", filename)
+		}
+	}
+}
+
+func TestArchives(t *testing.T) {
+	dir := t.TempDir()
+	name := "docs.tar"
+	filename := filepath.Join(dir, name)
+	writeTar(t, filename, false)
+
+	archives := NewArchives(Local(dir))
+	first, err := archives.Open(name)
+	if nil != err {
+		t.Fatalf("While opening archive got %v", err)
+	}
+	second, err := archives.Open(name)
+	if nil != err {
+		t.Fatalf("While opening archive again got %v", err)
+	}
+	if first != second {
+		t.Error("Expected unmodified archive to be reused")
+	}
+
+	// Replace the archive and make sure the modification is noticed.
+	writeZip(t, filename+".zip")
+	os.Rename(filename+".zip", filename)
+	later := archiveModTime.Add(time.Hour)
+	os.Chtimes(filename, later, later)
+	if _, err := archives.Open(name); nil == err {
+		t.Error("Expected modified archive to be reopened (and fail as a tar)")
+	}
+
+	if _, err := archives.Open(name + ".missing"); nil == err {
+		t.Error("Expected missing archive to return an error")
+	}
+}
+
+func TestArchivesLimit(t *testing.T) {
+	dir := t.TempDir()
+	archives := NewArchives(Local(dir))
+	for index := 0; index <= maxOpenedArchives; index++ {
+		name := fmt.Sprintf("docs%d.tar", index)
+		writeTar(t, filepath.Join(dir, name), false)
+		if _, err := archives.Open(name); nil != err {
+			t.Fatalf("While opening %s got %v", name, err)
+		}
+		// Keep the first archive in use.
+		if _, err := archives.Open("docs0.tar"); nil != err {
+			t.Fatalf("While opening docs0.tar got %v", err)
+		}
+	}
+	if maxOpenedArchives != len(archives.opened) {
+		t.Errorf("Expected %d opened archives but got %d", maxOpenedArchives, len(archives.opened))
+	}
+	if _, ok := archives.opened["docs0.tar"]; !ok {
+		t.Error("Expected the most recently used archive to be kept")
+	}
+}
+
+func TestOpenArchiveWithoutRandomAccess(t *testing.T) {
+	dir := t.TempDir()
+	writeZip(t, filepath.Join(dir, "docs.zip"))
+	contents, _ := ioutil.ReadFile(filepath.Join(dir, "docs.zip"))
+
+	// Files of fstest.MapFS implement io.ReaderAt, so hide it.
+	fsys := streamFS{fstest.MapFS{"docs.zip": {Data: contents}}}
+	if _, err := OpenArchive(fsys, "docs.zip"); nil == err {
+		t.Error("Expected zip without random access to return an error")
+	}
+}
+
+// streamFS hides all methods of opened files other than those of fs.File.
+type streamFS struct {
+	fsys fs.FS
+}
+
+func (sfs streamFS) Open(name string) (fs.File, error) {
+	file, err := sfs.fsys.Open(name)
+	if nil != err {
+		return nil, err
+	}
+	return struct{ fs.File }{file}, nil
+}
+
+func TestIsArchive(t *testing.T) {
+	testCases := []struct {
+		name   string
+		result bool
+	}{
+		{"docs.zip", true},
+		{"/web/docs.ZIP", true},
+		{"docs.tar", true},
+		{"docs.tar.gz", true},
+		{"docs.tgz", true},
+		{".zip", false},
+		{"docs.gz", false},
+		{"docs.zip.txt", false},
+		{"docs", false},
+	}
+
+	for _, tc := range testCases {
+		if result := IsArchive(tc.name); tc.result != result {
+			t.Errorf("For %s expected %t but got %t", tc.name, tc.result, result)
+		}
+	}
+}
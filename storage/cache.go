@@ -0,0 +1,184 @@
+package storage
+
+import (
+	"bytes"
+	"container/list"
+	"io"
+	"io/fs"
+	"sync"
+	"time"
+)
+
+// CacheLimits are the limits of the files held in memory by a CachedFS.
+type CacheLimits struct {
+	// MaxBytes is the largest combined size of the cached files.
+	MaxBytes int64
+	// MaxFileBytes is the size of the largest file cached or, if '0', files
+	// are only limited by MaxBytes.
+	MaxFileBytes int64
+	// Interval between checks that a cached file hasn't changed. If '0', the
+	// file is checked every time it is opened.
+	Interval time.Duration
+}
+
+// CachedFS is a file system holding the contents of small, recently opened
+// files in memory, so that they are opened without reading the wrapped file
+// system. The least recently opened files are evicted when the cache is full.
+// A cached file is checked against the wrapped file system once the check
+// interval has passed since it was last checked and is evicted if its
+// modification time or size changed.
+type CachedFS struct {
+	fsys   fs.FS
+	limits CacheLimits
+
+	mutex sync.Mutex
+	files map[string]*list.Element
+	// recent is the list of cached files, most recently opened first.
+	recent *list.List
+	bytes  int64
+}
+
+// cachedEntry is a file held in memory, with the modification time of the file
+// when it was cached.
+type cachedEntry struct {
+	name    string
+	info    fs.FileInfo
+	modTime time.Time
+	data    []byte
+	checked time.Time
+}
+
+// Cache the contents of files of the file system in memory within the limits.
+func Cache(fsys fs.FS, limits CacheLimits) *CachedFS {
+	return &CachedFS{
+		fsys:   fsys,
+		limits: limits,
+		files:  make(map[string]*list.Element),
+		recent: list.New(),
+	}
+}
+
+// Open the named file or directory, from memory if the file is cached.
+func (fsys *CachedFS) Open(name string) (fs.File, error) {
+	if entry := fsys.lookup(name); nil != entry {
+		return &memoryFile{Reader: bytes.NewReader(entry.data), info: entry.info}, nil
+	}
+
+	file, err := fsys.fsys.Open(name)
+	if nil != err {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if nil != err || !info.Mode().IsRegular() || !fsys.fits(info.Size()) {
+		return file, nil
+	}
+
+	// Files that can't be read completely, such as those changed while being
+	// read, are opened again and served without being cached.
+	data := make([]byte, info.Size())
+	if _, err = io.ReadFull(file, data); nil != err {
+		file.Close()
+		return fsys.fsys.Open(name)
+	}
+	file.Close()
+
+	fsys.add(&cachedEntry{
+		name:    name,
+		info:    info,
+		modTime: info.ModTime(),
+		data:    data,
+		checked: time.Now(),
+	})
+	return &memoryFile{Reader: bytes.NewReader(data), info: info}, nil
+}
+
+// Stat returns the file information of the named file, from memory if the file
+// is cached.
+func (fsys *CachedFS) Stat(name string) (fs.FileInfo, error) {
+	if entry := fsys.lookup(name); nil != entry {
+		return entry.info, nil
+	}
+	return fs.Stat(fsys.fsys, name)
+}
+
+// ReadDir reads the named directory from the wrapped file system.
+func (fsys *CachedFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(fsys.fsys, name)
+}
+
+// fits returns true if a file of the size can be cached.
+func (fsys *CachedFS) fits(size int64) bool {
+	if 0 < fsys.limits.MaxFileBytes && fsys.limits.MaxFileBytes < size {
+		return false
+	}
+	return size <= fsys.limits.MaxBytes
+}
+
+// lookup returns the cached entry of the named file, checking that the file
+// hasn't changed if the check interval has passed, or nil if the file isn't
+// cached.
+func (fsys *CachedFS) lookup(name string) *cachedEntry {
+	fsys.mutex.Lock()
+	element, ok := fsys.files[name]
+	if !ok {
+		fsys.mutex.Unlock()
+		return nil
+	}
+	fsys.recent.MoveToFront(element)
+	entry := element.Value.(*cachedEntry)
+	checked := entry.checked
+	fsys.mutex.Unlock()
+
+	if 0 < fsys.limits.Interval && time.Since(checked) < fsys.limits.Interval {
+		return entry
+	}
+
+	// Check the file without holding the lock, as the wrapped file system may
+	// be slow.
+	info, err := fs.Stat(fsys.fsys, name)
+	fsys.mutex.Lock()
+	defer fsys.mutex.Unlock()
+	if nil == err && info.Mode().IsRegular() && info.Size() == int64(len(entry.data)) &&
+		info.ModTime().Equal(entry.modTime) {
+		entry.checked = time.Now()
+		return entry
+	}
+	if fsys.files[name] == element {
+		fsys.remove(element)
+	}
+	return nil
+}
+
+// add the entry to the cache, evicting the least recently opened files until
+// the cache fits within its limit.
+func (fsys *CachedFS) add(entry *cachedEntry) {
+	fsys.mutex.Lock()
+	defer fsys.mutex.Unlock()
+	if element, ok := fsys.files[entry.name]; ok {
+		fsys.remove(element)
+	}
+	fsys.files[entry.name] = fsys.recent.PushFront(entry)
+	fsys.bytes += int64(len(entry.data))
+	for fsys.limits.MaxBytes < fsys.bytes {
+		fsys.remove(fsys.recent.Back())
+	}
+}
+
+// remove the element from the cache. The lock must be held.
+func (fsys *CachedFS) remove(element *list.Element) {
+	entry := fsys.recent.Remove(element).(*cachedEntry)
+	delete(fsys.files, entry.name)
+	fsys.bytes -= int64(len(entry.data))
+}
+
+// memoryFile is an open file with content held in memory.
+type memoryFile struct {
+	*bytes.Reader
+	info fs.FileInfo
+}
+
+// Stat returns the file information of the file.
+func (file *memoryFile) Stat() (fs.FileInfo, error) { return file.info, nil }
+
+// Close the file.
+func (file *memoryFile) Close() error { return nil }
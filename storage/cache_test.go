@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	mapFS := fstest.MapFS{
+		"index.html":      {Data: []byte("index"), ModTime: modTime},
+		"large.bin":       {Data: []byte("0123456789"), ModTime: modTime},
+		"docs/guide.html": {Data: []byte("guide"), ModTime: modTime},
+	}
+	fsys := Cache(mapFS, CacheLimits{MaxBytes: 12, MaxFileBytes: 8, Interval: time.Hour})
+	if err := fstest.TestFS(fsys, "index.html", "large.bin", "docs/guide.html"); nil != err {
+		t.Error(err)
+	}
+
+	// Cached files are served from memory until they are checked again, while
+	// files larger than the per-file limit are never cached.
+	mapFS["index.html"].Data = []byte("INDEX")
+	mapFS["large.bin"].Data = []byte("9876543210")
+	testCases := []struct {
+		name     string
+		contents string
+	}{
+		{"index.html", "index"},
+		{"large.bin", "9876543210"},
+	}
+	for _, tc := range testCases {
+		contents, err := fs.ReadFile(fsys, tc.name)
+		if nil != err {
+			t.Errorf("While reading %s got %v", tc.name, err)
+		}
+		if tc.contents != string(contents) {
+			t.Errorf("While reading %s expected '%s' but got '%s'", tc.name, tc.contents, contents)
+		}
+	}
+	if 10 != fsys.bytes {
+		t.Errorf("Expected 10 bytes cached but got %d", fsys.bytes)
+	}
+
+	// Opening another file evicts the least recently opened file.
+	mapFS["notes.txt"] = &fstest.MapFile{Data: []byte("notes"), ModTime: modTime}
+	fs.ReadFile(fsys, "index.html")
+	fs.ReadFile(fsys, "notes.txt")
+	if _, ok := fsys.files["docs/guide.html"]; ok {
+		t.Error("Expected the least recently opened file to be evicted")
+	}
+	if _, ok := fsys.files["index.html"]; !ok {
+		t.Error("Expected the recently opened file to remain cached")
+	}
+}
+
+func TestCacheChanged(t *testing.T) {
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	mapFS := fstest.MapFS{
+		"index.html": {Data: []byte("index"), ModTime: modTime},
+	}
+	fsys := Cache(mapFS, CacheLimits{MaxBytes: 1024})
+
+	testCases := []struct {
+		data     string
+		modTime  time.Time
+		contents string
+	}{
+		{"index", modTime, "index"},
+		{"INDEX", modTime, "index"},
+		{"INDEX", modTime.Add(time.Second), "INDEX"},
+		{"new index", modTime.Add(time.Second), "new index"},
+	}
+	for _, tc := range testCases {
+		mapFS["index.html"].Data = []byte(tc.data)
+		mapFS["index.html"].ModTime = tc.modTime
+		contents, err := fs.ReadFile(fsys, "index.html")
+		if nil != err {
+			t.Errorf("While reading index.html got %v", err)
+		}
+		if tc.contents != string(contents) {
+			t.Errorf("While reading index.html expected '%s' but got '%s'", tc.contents, contents)
+		}
+	}
+
+	delete(mapFS, "index.html")
+	if _, err := fsys.Open("index.html"); nil == err {
+		t.Error("While opening a removed file expected an error but got nil")
+	}
+}
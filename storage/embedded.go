@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"path"
+	"time"
+)
+
+// EmbeddedFS is a read-only file system of content built into the binary, such
+// as an embed.FS. As embedded files have no modification time, every file is
+// given the same modification time (e.g. the build time) and an entity tag
+// computed from its contents when the file system is created. The file
+// information of files implements ETagger.
+type EmbeddedFS struct {
+	fsys    fs.FS
+	modTime time.Time
+	etags   map[string]string
+}
+
+// Embedded returns the file system of the embedded content, with the
+// modification time used for every file. The entity tag of every file is
+// computed by reading all of the content.
+func Embedded(fsys fs.FS, modTime time.Time) (*EmbeddedFS, error) {
+	etags := make(map[string]string)
+	err := fs.WalkDir(fsys, ".", func(name string, entry fs.DirEntry, err error) error {
+		if nil != err || entry.IsDir() {
+			return err
+		}
+		file, err := fsys.Open(name)
+		if nil != err {
+			return err
+		}
+		defer file.Close()
+
+		hash := sha256.New()
+		if _, err = io.Copy(hash, file); nil != err {
+			return err
+		}
+		etags[name] = `"` + hex.EncodeToString(hash.Sum(nil)) + `"`
+		return nil
+	})
+	if nil != err {
+		return nil, err
+	}
+	return &EmbeddedFS{fsys: fsys, modTime: modTime, etags: etags}, nil
+}
+
+// Open the named file or directory.
+func (fsys *EmbeddedFS) Open(name string) (fs.File, error) {
+	file, err := fsys.fsys.Open(name)
+	if nil != err {
+		return nil, err
+	}
+	return &embeddedFile{File: file, fsys: fsys, name: name}, nil
+}
+
+// info returns the file information of the named file with the modification
+// time and entity tag of the embedded content.
+func (fsys *EmbeddedFS) info(name string, info fs.FileInfo) fs.FileInfo {
+	return &embeddedInfo{FileInfo: info, modTime: fsys.modTime, etag: fsys.etags[name]}
+}
+
+// embeddedInfo is the file information of an embedded file.
+type embeddedInfo struct {
+	fs.FileInfo
+	modTime time.Time
+	etag    string
+}
+
+func (info *embeddedInfo) ModTime() time.Time { return info.modTime }
+func (info *embeddedInfo) Sys() interface{}   { return info }
+
+// ETag of the contents of the file or, for directories, an empty string.
+func (info *embeddedInfo) ETag() string { return info.etag }
+
+// embeddedEntry is a directory entry of an embedded directory.
+type embeddedEntry struct {
+	fs.DirEntry
+	fsys *EmbeddedFS
+	name string
+}
+
+// Info returns the file information of the entry.
+func (entry *embeddedEntry) Info() (fs.FileInfo, error) {
+	info, err := entry.DirEntry.Info()
+	if nil != err {
+		return nil, err
+	}
+	return entry.fsys.info(entry.name, info), nil
+}
+
+// embeddedFile is an open embedded file or directory.
+type embeddedFile struct {
+	fs.File
+	fsys *EmbeddedFS
+	name string
+}
+
+// Stat returns the file information of the file.
+func (file *embeddedFile) Stat() (fs.FileInfo, error) {
+	info, err := file.File.Stat()
+	if nil != err {
+		return nil, err
+	}
+	return file.fsys.info(file.name, info), nil
+}
+
+// Seek within the file, if supported by the embedded file.
+func (file *embeddedFile) Seek(offset int64, whence int) (int64, error) {
+	seeker, ok := file.File.(io.Seeker)
+	if !ok {
+		return 0, &fs.PathError{Op: "seek", Path: file.name, Err: fs.ErrInvalid}
+	}
+	return seeker.Seek(offset, whence)
+}
+
+// ReadAt reads from the offset of the file, if supported by the embedded file.
+func (file *embeddedFile) ReadAt(p []byte, offset int64) (int, error) {
+	reader, ok := file.File.(io.ReaderAt)
+	if !ok {
+		return 0, &fs.PathError{Op: "read", Path: file.name, Err: fs.ErrInvalid}
+	}
+	return reader.ReadAt(p, offset)
+}
+
+// ReadDir returns the next n entries of the directory or, if n <= 0, all
+// remaining entries.
+func (file *embeddedFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	dir, ok := file.File.(fs.ReadDirFile)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: file.name, Err: fs.ErrInvalid}
+	}
+	entries, err := dir.ReadDir(n)
+	for index, entry := range entries {
+		entries[index] = &embeddedEntry{
+			DirEntry: entry,
+			fsys:     file.fsys,
+			name:     path.Join(file.name, entry.Name()),
+		}
+	}
+	return entries, err
+}
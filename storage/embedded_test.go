@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestEmbedded(t *testing.T) {
+	buildTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	content := fstest.MapFS{
+		"index.html":     {Data: []byte("index")},
+		"copy.html":      {Data: []byte("index")},
+		"css/style.css":  {Data: []byte("style")},
+		"css/theme.css":  {Data: []byte("theme")},
+		"img/.gitignore": {Data: []byte("")},
+	}
+	fsys, err := Embedded(content, buildTime)
+	if nil != err {
+		t.Fatalf("While embedding content got %v", err)
+	}
+	if err := fstest.TestFS(fsys, "index.html", "copy.html", "css/style.css", "css/theme.css"); nil != err {
+		t.Error(err)
+	}
+
+	etags := map[string]string{}
+	for _, name := range []string{"index.html", "copy.html", "css/style.css", "css"} {
+		info, err := fs.Stat(fsys, name)
+		if nil != err {
+			t.Fatalf("While getting info of %s got %v", name, err)
+		}
+		if !buildTime.Equal(info.ModTime()) {
+			t.Errorf("While getting info of %s expected modification time %v but got %v", name, buildTime, info.ModTime())
+		}
+		tagged, ok := info.Sys().(ETagger)
+		if !ok {
+			t.Fatalf("While getting info of %s expected an ETagger", name)
+		}
+		etags[name] = tagged.ETag()
+	}
+	if etags["index.html"] == "" || etags["index.html"] != etags["copy.html"] {
+		t.Errorf("Expected equal entity tags for equal contents but got %v", etags)
+	}
+	if etags["index.html"] == etags["css/style.css"] {
+		t.Errorf("Expected different entity tags for different contents but got %v", etags)
+	}
+	if etags["css"] != "" {
+		t.Errorf("Expected no entity tag for a directory but got %s", etags["css"])
+	}
+
+	entries, err := fs.ReadDir(fsys, "css")
+	if nil != err {
+		t.Fatalf("While reading directory got %v", err)
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if nil != err {
+			t.Fatalf("While getting info of %s got %v", entry.Name(), err)
+		}
+		if tagged := info.Sys().(ETagger); tagged.ETag() == "" {
+			t.Errorf("Expected entity tag of directory entry %s", entry.Name())
+		}
+	}
+
+	file, err := fsys.Open("css/theme.css")
+	if nil != err {
+		t.Fatalf("While opening file got %v", err)
+	}
+	defer file.Close()
+	if _, err := file.(io.Seeker).Seek(2, io.SeekStart); nil != err {
+		t.Fatalf("While seeking got %v", err)
+	}
+	if contents, _ := ioutil.ReadAll(file); "eme" != string(contents) {
+		t.Errorf("Expected 'eme' after seeking but got '%s'", contents)
+	}
+}
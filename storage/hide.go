@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"io/fs"
+	"path"
+)
+
+// HiddenFS is a file system with the files of the given base names, in any
+// directory, hidden. Hidden files don't exist and are left out of directory
+// entries, which keeps files used to configure the server from being served.
+type HiddenFS struct {
+	fsys  fs.FS
+	names map[string]bool
+}
+
+// Hide the files with the base names in any directory of the file system.
+func Hide(fsys fs.FS, names ...string) *HiddenFS {
+	hidden := make(map[string]bool, len(names))
+	for _, name := range names {
+		hidden[name] = true
+	}
+	return &HiddenFS{fsys: fsys, names: hidden}
+}
+
+// Open the named file or directory, unless the file is hidden.
+func (fsys *HiddenFS) Open(name string) (fs.File, error) {
+	if fsys.names[path.Base(name)] {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	file, err := fsys.fsys.Open(name)
+	if nil != err {
+		return nil, err
+	}
+	// Only directories are wrapped, keeping the seeking and reading at offsets
+	// of regular files, which are also read directory files when opened from
+	// the local file system.
+	if _, ok := file.(fs.ReadDirFile); !ok {
+		return file, nil
+	}
+	if stat, err := file.Stat(); nil != err || !stat.IsDir() {
+		return file, err
+	}
+	return &hiddenDir{File: file, fsys: fsys, name: name}, nil
+}
+
+// Stat returns the file information of the named file, unless the file is
+// hidden.
+func (fsys *HiddenFS) Stat(name string) (fs.FileInfo, error) {
+	if fsys.names[path.Base(name)] {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return fs.Stat(fsys.fsys, name)
+}
+
+// ReadDir reads the named directory, leaving out hidden files.
+func (fsys *HiddenFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if fsys.names[path.Base(name)] {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	entries, err := fs.ReadDir(fsys.fsys, name)
+	return fsys.visible(entries), err
+}
+
+// visible returns the entries that aren't hidden.
+func (fsys *HiddenFS) visible(entries []fs.DirEntry) []fs.DirEntry {
+	visible := entries[:0]
+	for _, entry := range entries {
+		if !fsys.names[entry.Name()] {
+			visible = append(visible, entry)
+		}
+	}
+	return visible
+}
+
+// hiddenDir is an open directory leaving out hidden files.
+type hiddenDir struct {
+	fs.File
+	fsys *HiddenFS
+	name string
+}
+
+// ReadDir returns the next n visible entries of the directory or, if n <= 0,
+// all remaining visible entries.
+func (dir *hiddenDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	for {
+		entries, err := dir.File.(fs.ReadDirFile).ReadDir(n)
+		entries = dir.fsys.visible(entries)
+		// Only hidden files were read, so read more rather than returning no
+		// entries before the end of the directory.
+		if 0 < n && len(entries) == 0 && nil == err {
+			continue
+		}
+		return entries, err
+	}
+}
@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestHide(t *testing.T) {
+	fsys := Hide(fstest.MapFS{
+		"index.html":        {Data: []byte("index")},
+		"_headers":          {Data: []byte("/*\n  X-Frame-Options: DENY")},
+		"docs/_headers":     {Data: []byte("/*\n  X-Robots-Tag: noindex")},
+		"docs/guide.html":   {Data: []byte("guide")},
+		"docs/_headers.bak": {Data: []byte("backup")},
+	}, "_headers")
+	if err := fstest.TestFS(fsys, "index.html", "docs/guide.html", "docs/_headers.bak"); nil != err {
+		t.Error(err)
+	}
+
+	for _, name := range []string{"_headers", "docs/_headers"} {
+		if _, err := fs.ReadFile(fsys, name); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("While reading %s expected %v but got %v", name, fs.ErrNotExist, err)
+		}
+		if _, err := fs.Stat(fsys, name); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("While getting info of %s expected %v but got %v", name, fs.ErrNotExist, err)
+		}
+	}
+
+	testCases := []struct {
+		dir     string
+		entries string
+	}{
+		{".", "docs,index.html"},
+		{"docs", "_headers.bak,guide.html"},
+	}
+	for _, tc := range testCases {
+		entries, err := fs.ReadDir(fsys, tc.dir)
+		if nil != err {
+			t.Errorf("While reading %s got %v", tc.dir, err)
+		}
+		names := make([]string, len(entries))
+		for index, entry := range entries {
+			names[index] = entry.Name()
+		}
+		if result := strings.Join(names, ","); tc.entries != result {
+			t.Errorf("While reading %s expected entries '%s' but got '%s'", tc.dir, tc.entries, result)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package storage
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Local returns the file system of the folder on the local file system. This
+// is the default backend.
+func Local(folder string) fs.FS {
+	return os.DirFS(folder)
+}
+
+// LocalArchive returns the file system of the contents of an archive file on
+// the local file system.
+func LocalArchive(filename string) (fs.FS, error) {
+	return OpenArchive(Local(filepath.Dir(filename)), filepath.Base(filename))
+}
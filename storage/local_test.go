@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"io/fs"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocal(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "file.txt"), []byte("contents"), 0600); nil != err {
+		t.Fatalf("While writing file got %v", err)
+	}
+
+	contents, err := fs.ReadFile(Local(dir), "file.txt")
+	if nil != err {
+		t.Errorf("While reading file got %v", err)
+	}
+	if "contents" != string(contents) {
+		t.Errorf("Expected 'contents' but got '%s'", contents)
+	}
+}
+
+func TestLocalArchive(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "docs.tar.gz")
+	writeTar(t, filename, true)
+
+	fsys, err := LocalArchive(filename)
+	if nil != err {
+		t.Fatalf("While opening archive got %v", err)
+	}
+	contents, err := fs.ReadFile(fsys, "index.html")
+	if nil != err {
+		t.Errorf("While reading file got %v", err)
+	}
+	if archiveContents["index.html"] != string(contents) {
+		t.Errorf("Expected '%s' but got '%s'", archiveContents["index.html"], contents)
+	}
+}
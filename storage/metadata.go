@@ -0,0 +1,207 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxMetadataEntries is the largest number of files and directories with cached
+// metadata, beyond which the cache is cleared. This keeps requests for many
+// missing files from growing the cache without limit.
+const maxMetadataEntries = 100000
+
+// MetadataFS is a file system caching the file information and directory
+// entries of the wrapped file system, including files that don't exist. Cached
+// metadata is invalidated when the folder of the file system is watched for
+// changes and otherwise expires after the interval.
+type MetadataFS struct {
+	fsys     fs.FS
+	interval time.Duration
+
+	mutex    sync.Mutex
+	stats    map[string]*metadataEntry
+	dirs     map[string]*metadataEntry
+	watching bool
+	watcher  io.Closer
+	// generation is incremented when metadata is invalidated, so that metadata
+	// read from the wrapped file system during an invalidation isn't cached.
+	generation uint64
+}
+
+// metadataEntry is the cached file information or directory entries of a file,
+// or the error returned for the file.
+type metadataEntry struct {
+	info    fs.FileInfo
+	entries []fs.DirEntry
+	err     error
+	cached  time.Time
+}
+
+// Metadata caches the file information and directory entries of the file
+// system, which expire after the interval until the folder is watched.
+func Metadata(fsys fs.FS, interval time.Duration) *MetadataFS {
+	return &MetadataFS{
+		fsys:     fsys,
+		interval: interval,
+		stats:    make(map[string]*metadataEntry),
+		dirs:     make(map[string]*metadataEntry),
+	}
+}
+
+// Watch the local folder of the file system for changes, invalidating the
+// cached metadata of changed files, which then no longer expires. Watching is
+// only supported on Linux.
+func (fsys *MetadataFS) Watch(folder string) error {
+	watcher, err := fsys.watch(folder)
+	if nil != err {
+		return err
+	}
+	fsys.mutex.Lock()
+	defer fsys.mutex.Unlock()
+	fsys.watcher, fsys.watching = watcher, true
+	fsys.clear()
+	return nil
+}
+
+// Close stops watching the folder for changes, if watched.
+func (fsys *MetadataFS) Close() error {
+	fsys.mutex.Lock()
+	defer fsys.mutex.Unlock()
+	if nil == fsys.watcher {
+		return nil
+	}
+	err := fsys.watcher.Close()
+	fsys.watcher, fsys.watching = nil, false
+	return err
+}
+
+// unwatch falls back to expiring cached metadata after the folder can no longer
+// be watched.
+func (fsys *MetadataFS) unwatch() {
+	fsys.mutex.Lock()
+	defer fsys.mutex.Unlock()
+	if nil != fsys.watcher {
+		fsys.watcher.Close()
+	}
+	fsys.watcher, fsys.watching = nil, false
+	fsys.clear()
+}
+
+// Open the named file or directory. Files that are known not to exist return
+// an error without opening the file.
+func (fsys *MetadataFS) Open(name string) (fs.File, error) {
+	if entry, _ := fsys.lookup(name, false); nil != entry && nil != entry.err {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return fsys.fsys.Open(name)
+}
+
+// Stat returns the file information of the named file.
+func (fsys *MetadataFS) Stat(name string) (fs.FileInfo, error) {
+	entry, generation := fsys.lookup(name, false)
+	if nil != entry {
+		return entry.info, entry.err
+	}
+	info, err := fs.Stat(fsys.fsys, name)
+	fsys.store(name, false, generation, &metadataEntry{info: info, err: err})
+	return info, err
+}
+
+// ReadDir reads the named directory.
+func (fsys *MetadataFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entry, generation := fsys.lookup(name, true)
+	if nil == entry {
+		entries, err := fs.ReadDir(fsys.fsys, name)
+		entry = &metadataEntry{entries: entries, err: err}
+		fsys.store(name, true, generation, entry)
+	}
+	// Return a copy of the entries, as callers may sort them.
+	return append([]fs.DirEntry(nil), entry.entries...), entry.err
+}
+
+// lookup returns the cached file information or, for dir, directory entries of
+// the named file, or nil if the file isn't cached or the entry expired, and the
+// current generation of the cache.
+func (fsys *MetadataFS) lookup(name string, dir bool) (*metadataEntry, uint64) {
+	fsys.mutex.Lock()
+	defer fsys.mutex.Unlock()
+	entry, ok := fsys.cache(dir)[name]
+	if !ok || (!fsys.watching && fsys.interval <= time.Since(entry.cached)) {
+		return nil, fsys.generation
+	}
+	return entry, fsys.generation
+}
+
+// store the file information or, for dir, directory entries of the named file
+// read in the generation of the cache. Only files that exist and files that
+// don't exist are cached, not other errors.
+func (fsys *MetadataFS) store(name string, dir bool, generation uint64, entry *metadataEntry) {
+	if nil != entry.err && !errors.Is(entry.err, fs.ErrNotExist) {
+		return
+	}
+	fsys.mutex.Lock()
+	defer fsys.mutex.Unlock()
+	if generation != fsys.generation {
+		return
+	}
+	if maxMetadataEntries <= len(fsys.stats)+len(fsys.dirs) {
+		fsys.clear()
+	}
+	entry.cached = time.Now()
+	fsys.cache(dir)[name] = entry
+}
+
+// cache returns the cache of directory entries for dir, otherwise the cache of
+// file information. The lock must be held.
+func (fsys *MetadataFS) cache(dir bool) map[string]*metadataEntry {
+	if dir {
+		return fsys.dirs
+	}
+	return fsys.stats
+}
+
+// invalidate the cached metadata of the named file and its directory. If the
+// file is a directory, the metadata of everything within it is invalidated
+// too.
+func (fsys *MetadataFS) invalidate(name string, isDir bool) {
+	fsys.mutex.Lock()
+	defer fsys.mutex.Unlock()
+	if "." == name {
+		fsys.clear()
+		return
+	}
+	fsys.generation++
+	delete(fsys.stats, name)
+	delete(fsys.dirs, name)
+	delete(fsys.dirs, path.Dir(name))
+	if !isDir {
+		return
+	}
+	prefix := name + "/"
+	for _, cache := range []map[string]*metadataEntry{fsys.stats, fsys.dirs} {
+		for cached := range cache {
+			if strings.HasPrefix(cached, prefix) {
+				delete(cache, cached)
+			}
+		}
+	}
+}
+
+// reset the cache, invalidating the metadata of every file.
+func (fsys *MetadataFS) reset() {
+	fsys.mutex.Lock()
+	defer fsys.mutex.Unlock()
+	fsys.clear()
+}
+
+// clear the cache. The lock must be held.
+func (fsys *MetadataFS) clear() {
+	fsys.generation++
+	fsys.stats = make(map[string]*metadataEntry)
+	fsys.dirs = make(map[string]*metadataEntry)
+}
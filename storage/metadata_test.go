@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestMetadata(t *testing.T) {
+	mapFS := fstest.MapFS{
+		"index.html":      {Data: []byte("index")},
+		"docs/guide.html": {Data: []byte("guide")},
+	}
+	fsys := Metadata(mapFS, time.Hour)
+	if err := fstest.TestFS(fsys, "index.html", "docs/guide.html"); nil != err {
+		t.Error(err)
+	}
+
+	// Cached metadata, including of missing files, is used until it expires.
+	fs.Stat(fsys, "missing.html")
+	mapFS["missing.html"] = &fstest.MapFile{Data: []byte("added")}
+	mapFS["docs/added.html"] = &fstest.MapFile{Data: []byte("added")}
+	delete(mapFS, "index.html")
+
+	if _, err := fs.Stat(fsys, "index.html"); nil != err {
+		t.Errorf("While getting cached info of index.html expected no error but got %v", err)
+	}
+	if _, err := fs.Stat(fsys, "missing.html"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("While getting cached info of missing.html expected %v but got %v", fs.ErrNotExist, err)
+	}
+	if _, err := fsys.Open("missing.html"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("While opening cached missing.html expected %v but got %v", fs.ErrNotExist, err)
+	}
+	if entries, _ := fs.ReadDir(fsys, "docs"); 1 != len(entries) {
+		t.Errorf("While reading cached docs expected 1 entry but got %d", len(entries))
+	}
+
+	// Invalidated metadata is read again.
+	fsys.invalidate("docs/added.html", false)
+	if entries, _ := fs.ReadDir(fsys, "docs"); 2 != len(entries) {
+		t.Errorf("While reading invalidated docs expected 2 entries but got %d", len(entries))
+	}
+	fsys.invalidate(".", true)
+	if _, err := fs.Stat(fsys, "missing.html"); nil != err {
+		t.Errorf("While getting invalidated info of missing.html expected no error but got %v", err)
+	}
+}
+
+func TestMetadataExpired(t *testing.T) {
+	mapFS := fstest.MapFS{
+		"index.html": {Data: []byte("index")},
+	}
+	fsys := Metadata(mapFS, 0)
+	fs.Stat(fsys, "index.html")
+	delete(mapFS, "index.html")
+	if _, err := fs.Stat(fsys, "index.html"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("While getting expired info of index.html expected %v but got %v", fs.ErrNotExist, err)
+	}
+}
@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"errors"
+	"io/fs"
+	"sort"
+)
+
+// OverlayFS is a read-only union of file systems, which are searched in order.
+// The first file system containing a name provides the file, while the entries
+// of a directory are merged from every file system containing the directory.
+type OverlayFS struct {
+	layers []fs.FS
+}
+
+// Overlay returns the union of the file systems, with earlier file systems
+// taking precedence over later ones.
+func Overlay(layers ...fs.FS) *OverlayFS {
+	return &OverlayFS{layers: layers}
+}
+
+// Open the named file or directory from the first file system containing it.
+func (fsys *OverlayFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	for index, layer := range fsys.layers {
+		file, err := layer.Open(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if nil != err {
+			return nil, err
+		}
+		stat, err := file.Stat()
+		if nil != err {
+			file.Close()
+			return nil, err
+		}
+		if !stat.IsDir() {
+			return file, nil
+		}
+		return &overlayDir{File: file, fsys: fsys, name: name, first: index}, nil
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+// Stat returns the file information of the named file or directory from the
+// first file system containing it.
+func (fsys *OverlayFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	for _, layer := range fsys.layers {
+		stat, err := fs.Stat(layer, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		return stat, err
+	}
+	return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+}
+
+// ReadDir reads the named directory from every file system containing it and
+// returns the merged entries sorted by name. Entries from earlier file systems
+// take precedence.
+func (fsys *OverlayFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	for index, layer := range fsys.layers {
+		if _, err := fs.Stat(layer, name); errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		return fsys.readDir(name, index)
+	}
+	return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+}
+
+// readDir merges the entries of the named directory from the file systems,
+// starting with the first file system containing the name. Later file systems
+// that don't contain the directory are skipped.
+func (fsys *OverlayFS) readDir(name string, first int) ([]fs.DirEntry, error) {
+	entries, err := fs.ReadDir(fsys.layers[first], name)
+	if nil != err {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		seen[entry.Name()] = true
+	}
+	for _, layer := range fsys.layers[first+1:] {
+		layerEntries, err := fs.ReadDir(layer, name)
+		if nil != err {
+			continue
+		}
+		for _, entry := range layerEntries {
+			if !seen[entry.Name()] {
+				seen[entry.Name()] = true
+				entries = append(entries, entry)
+			}
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+// overlayDir is an open directory of the first file system containing it, with
+// entries merged from all of the file systems.
+type overlayDir struct {
+	fs.File
+	fsys    *OverlayFS
+	name    string
+	first   int
+	entries *dirEntries
+}
+
+// ReadDir returns the next n merged entries of the directory or, if n <= 0,
+// all remaining entries.
+func (dir *overlayDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if dir.entries == nil {
+		entries, err := dir.fsys.readDir(dir.name, dir.first)
+		if nil != err {
+			return nil, err
+		}
+		dir.entries = &dirEntries{entries: entries}
+	}
+	return dir.entries.next(n)
+}
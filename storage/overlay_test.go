@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+var (
+	overlayTeam = fstest.MapFS{
+		"index.html":      {Data: []byte("team index")},
+		"docs/guide.html": {Data: []byte("team guide")},
+		"shadow":          {Data: []byte("team file")},
+	}
+	overlayTheme = fstest.MapFS{
+		"index.html":      {Data: []byte("theme index")},
+		"style.css":       {Data: []byte("theme style")},
+		"docs/index.html": {Data: []byte("theme docs index")},
+		"shadow/hidden":   {Data: []byte("theme hidden")},
+		"theme/logo.svg":  {Data: []byte("theme logo")},
+	}
+)
+
+func TestOverlay(t *testing.T) {
+	fsys := Overlay(overlayTeam, overlayTheme)
+	if err := fstest.TestFS(fsys, "index.html", "style.css", "docs/guide.html", "docs/index.html", "theme/logo.svg"); nil != err {
+		t.Error(err)
+	}
+
+	testCases := []struct {
+		name     string
+		file     string
+		contents string
+		err      error
+	}{
+		{"First layer wins", "index.html", "team index", nil},
+		{"Second layer only", "style.css", "theme style", nil},
+		{"Merged directory", "docs/index.html", "theme docs index", nil},
+		{"Shadowed by file", "shadow", "team file", nil},
+		{"Missing", "missing.txt", "", fs.ErrNotExist},
+		{"Invalid", "../index.html", "", fs.ErrInvalid},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			contents, err := fs.ReadFile(fsys, tc.file)
+			if !errors.Is(err, tc.err) {
+				t.Errorf("While reading %s expected %v but got %v", tc.file, tc.err, err)
+			}
+			if tc.contents != string(contents) {
+				t.Errorf("While reading %s expected '%s' but got '%s'", tc.file, tc.contents, contents)
+			}
+			if _, err := fs.Stat(fsys, tc.file); !errors.Is(err, tc.err) {
+				t.Errorf("While getting info of %s expected %v but got %v", tc.file, tc.err, err)
+			}
+		})
+	}
+}
+
+func TestOverlayReadDir(t *testing.T) {
+	fsys := Overlay(overlayTeam, overlayTheme)
+
+	testCases := []struct {
+		name    string
+		dir     string
+		entries string
+		isError bool
+	}{
+		{"Root", ".", "docs,index.html,shadow,style.css,theme", false},
+		{"Merged", "docs", "guide.html,index.html", false},
+		{"Second layer only", "theme", "logo.svg", false},
+		{"Shadowed by file", "shadow", "", true},
+		{"Missing", "missing", "", true},
+		{"Invalid", "/docs", "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			entries, err := fs.ReadDir(fsys, tc.dir)
+			hasError := nil != err
+			if hasError && !tc.isError {
+				t.Errorf("Expected no error but got %v", err)
+			}
+			if !hasError && tc.isError {
+				t.Error("Expected an error but got no error")
+			}
+			names := make([]string, len(entries))
+			for index, entry := range entries {
+				names[index] = entry.Name()
+			}
+			if result := strings.Join(names, ","); tc.entries != result {
+				t.Errorf("Expected entries '%s' but got '%s'", tc.entries, result)
+			}
+		})
+	}
+}
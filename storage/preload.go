@@ -0,0 +1,279 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"mime"
+	"path"
+	"strings"
+)
+
+// maxGzipBytes is the size of the largest file compressed when preloading.
+const maxGzipBytes = 10 * 1024 * 1024
+
+// Gzipper is implemented by file systems holding gzip compressed variants of
+// files.
+type Gzipper interface {
+	// Gzipped returns the gzip compressed contents of the named file, if there
+	// are any.
+	Gzipped(name string) ([]byte, bool)
+}
+
+// PreloadStats summarizes the files of a preloaded file system.
+type PreloadStats struct {
+	// Files is the number of preloaded files.
+	Files int
+	// Bytes is the combined size of the preloaded files.
+	Bytes int64
+	// Gzipped is the number of files with a gzip compressed variant.
+	Gzipped int
+	// GzippedBytes is the combined size of the gzip compressed variants.
+	GzippedBytes int64
+}
+
+// PreloadedFS is a file system of content that doesn't change while served,
+// such as a read-only container image. The file information, directory entries
+// and entity tags of all files, and gzip compressed variants of files with
+// compressible content types, are read when the file system is created and,
+// optionally, so is the content of every file. The file information of files
+// implements ETagger. Files that weren't preloaded, such as those beneath
+// symbolic links to directories, are opened from the wrapped file system.
+type PreloadedFS struct {
+	fsys  fs.FS
+	files map[string]*preloadedEntry
+	stats PreloadStats
+}
+
+// preloadedEntry is a preloaded file or directory.
+type preloadedEntry struct {
+	info    *preloadedInfo
+	entries []fs.DirEntry
+	data    []byte
+	gzipped []byte
+}
+
+// Preload the file system, holding the content of every file in memory if
+// inMemory is true. The content types of files, which decide whether they are
+// compressed, are those returned by typeByExtension for their extensions.
+func Preload(fsys fs.FS, inMemory bool, typeByExtension func(ext string) string) (*PreloadedFS, error) {
+	preloaded := &PreloadedFS{fsys: fsys, files: make(map[string]*preloadedEntry)}
+	err := fs.WalkDir(fsys, ".", func(name string, entry fs.DirEntry, err error) error {
+		if nil != err {
+			return err
+		}
+		info, err := fs.Stat(fsys, name)
+		if nil != err {
+			return err
+		}
+		loaded := &preloadedEntry{info: &preloadedInfo{FileInfo: info}}
+		if info.Mode().IsRegular() {
+			compress := compressible(typeByExtension(path.Ext(name)))
+			if err = preloaded.load(name, loaded, inMemory, compress); nil != err {
+				return err
+			}
+		}
+		if name != "." {
+			parent := preloaded.files[path.Dir(name)]
+			parent.entries = append(parent.entries, fs.FileInfoToDirEntry(loaded.info))
+		}
+		// Symbolic links to directories aren't walked, so their contents are
+		// left to the wrapped file system.
+		if 0 == entry.Type()&fs.ModeSymlink || !info.IsDir() {
+			preloaded.files[name] = loaded
+		}
+		return nil
+	})
+	if nil != err {
+		return nil, err
+	}
+	return preloaded, nil
+}
+
+// load the entity tag, gzip compressed variant if compress is true and, if
+// inMemory is true, content of the named file into the entry.
+func (fsys *PreloadedFS) load(name string, entry *preloadedEntry, inMemory, compress bool) error {
+	file, err := fsys.fsys.Open(name)
+	if nil != err {
+		return err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	compress = compress && entry.info.Size() <= maxGzipBytes
+	if inMemory || compress {
+		if entry.data, err = ioutil.ReadAll(file); nil != err {
+			return err
+		}
+		hash.Write(entry.data)
+	} else if _, err = io.Copy(hash, file); nil != err {
+		return err
+	}
+	entry.info.etag = `"` + hex.EncodeToString(hash.Sum(nil)) + `"`
+	fsys.stats.Files++
+	fsys.stats.Bytes += entry.info.Size()
+
+	if compress {
+		var buf bytes.Buffer
+		writer, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+		writer.Write(entry.data)
+		writer.Close()
+		// Only keep variants that are worth decompressing.
+		if buf.Len() < len(entry.data)*9/10 {
+			entry.gzipped = buf.Bytes()
+			fsys.stats.Gzipped++
+			fsys.stats.GzippedBytes += int64(buf.Len())
+		}
+	}
+	if !inMemory {
+		entry.data = nil
+	}
+	return nil
+}
+
+// Stats returns the summary of the preloaded files.
+func (fsys *PreloadedFS) Stats() PreloadStats {
+	return fsys.stats
+}
+
+// Open the named file or directory, from memory if the content was preloaded.
+func (fsys *PreloadedFS) Open(name string) (fs.File, error) {
+	entry, ok := fsys.files[name]
+	if !ok {
+		return fsys.fsys.Open(name)
+	}
+	if entry.info.IsDir() {
+		return &preloadedDir{info: entry.info, entries: entry.entries}, nil
+	}
+	if nil != entry.data {
+		return &memoryFile{Reader: bytes.NewReader(entry.data), info: entry.info}, nil
+	}
+	file, err := fsys.fsys.Open(name)
+	if nil != err {
+		return nil, err
+	}
+	return &preloadedFile{File: file, name: name, info: entry.info}, nil
+}
+
+// Stat returns the preloaded file information of the named file.
+func (fsys *PreloadedFS) Stat(name string) (fs.FileInfo, error) {
+	if entry, ok := fsys.files[name]; ok {
+		return entry.info, nil
+	}
+	return fs.Stat(fsys.fsys, name)
+}
+
+// ReadDir returns the preloaded entries of the named directory.
+func (fsys *PreloadedFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if entry, ok := fsys.files[name]; ok && entry.info.IsDir() {
+		return append([]fs.DirEntry(nil), entry.entries...), nil
+	}
+	return fs.ReadDir(fsys.fsys, name)
+}
+
+// Gzipped returns the gzip compressed contents of the named file, if it has a
+// compressible content type and compressing it reduced its size.
+func (fsys *PreloadedFS) Gzipped(name string) ([]byte, bool) {
+	if entry, ok := fsys.files[name]; ok && nil != entry.gzipped {
+		return entry.gzipped, true
+	}
+	return nil, false
+}
+
+// compressible returns true if the content type is text or another format that
+// compresses well.
+func compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if nil != err {
+		return false
+	}
+	if strings.HasPrefix(mediaType, "text/") ||
+		strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "+xml") {
+		return true
+	}
+	switch mediaType {
+	case "application/javascript", "application/json", "application/xml",
+		"application/wasm", "image/svg+xml", "image/x-icon", "font/ttf", "font/otf":
+		return true
+	}
+	return false
+}
+
+// preloadedInfo is the file information of a preloaded file.
+type preloadedInfo struct {
+	fs.FileInfo
+	etag string
+}
+
+func (info *preloadedInfo) Sys() interface{} { return info }
+
+// ETag of the contents of the file or, for directories, an empty string.
+func (info *preloadedInfo) ETag() string { return info.etag }
+
+// preloadedFile is an open file of the wrapped file system with preloaded file
+// information.
+type preloadedFile struct {
+	fs.File
+	name string
+	info fs.FileInfo
+}
+
+// Stat returns the preloaded file information of the file.
+func (file *preloadedFile) Stat() (fs.FileInfo, error) { return file.info, nil }
+
+// Seek within the file, if supported by the wrapped file.
+func (file *preloadedFile) Seek(offset int64, whence int) (int64, error) {
+	seeker, ok := file.File.(io.Seeker)
+	if !ok {
+		return 0, &fs.PathError{Op: "seek", Path: file.name, Err: fs.ErrInvalid}
+	}
+	return seeker.Seek(offset, whence)
+}
+
+// ReadAt reads from the offset within the file, if supported by the wrapped
+// file, such as for opening archives.
+func (file *preloadedFile) ReadAt(b []byte, offset int64) (int, error) {
+	readerAt, ok := file.File.(io.ReaderAt)
+	if !ok {
+		return 0, &fs.PathError{Op: "readat", Path: file.name, Err: fs.ErrInvalid}
+	}
+	return readerAt.ReadAt(b, offset)
+}
+
+// preloadedDir is an open directory with preloaded entries.
+type preloadedDir struct {
+	info    fs.FileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+// Stat returns the preloaded file information of the directory.
+func (dir *preloadedDir) Stat() (fs.FileInfo, error) { return dir.info, nil }
+
+// Read fails, as directories can't be read.
+func (dir *preloadedDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: dir.info.Name(), Err: fs.ErrInvalid}
+}
+
+// Close the directory.
+func (dir *preloadedDir) Close() error { return nil }
+
+// ReadDir returns the next n entries of the directory or, if n <= 0, all
+// remaining entries.
+func (dir *preloadedDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	remaining := dir.entries[dir.offset:]
+	if 0 < n {
+		if 0 == len(remaining) {
+			return nil, io.EOF
+		}
+		if n < len(remaining) {
+			remaining = remaining[:n]
+		}
+	}
+	dir.offset += len(remaining)
+	return append([]fs.DirEntry(nil), remaining...), nil
+}
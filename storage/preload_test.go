@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// testTypeByExtension returns the content types of the extensions used by the
+// tests, independent of the content types of the system.
+func testTypeByExtension(ext string) string {
+	return map[string]string{
+		".html": "text/html; charset=utf-8",
+		".png":  "image/png",
+		".qq":   "text/plain; charset=utf-8",
+	}[ext]
+}
+
+func TestPreload(t *testing.T) {
+	page := strings.Repeat("<p>compressible</p>", 100)
+	for _, inMemory := range []bool{false, true} {
+		mapFS := fstest.MapFS{
+			"index.html":      {Data: []byte(page)},
+			"docs/guide.html": {Data: []byte("guide")},
+			"notes.qq":        {Data: []byte(page)},
+			"photo.png":       {Data: []byte(page)},
+		}
+		fsys, err := Preload(mapFS, inMemory, testTypeByExtension)
+		if nil != err {
+			t.Fatalf("While preloading got %v", err)
+		}
+		if err := fstest.TestFS(fsys, "index.html", "docs/guide.html", "notes.qq", "photo.png"); nil != err {
+			t.Error(err)
+		}
+
+		stats := fsys.Stats()
+		if 4 != stats.Files || int64(3*len(page)+5) != stats.Bytes || 2 != stats.Gzipped {
+			t.Errorf("While preloading expected 4 files, %d bytes and 2 gzipped but got %+v", 3*len(page)+5, stats)
+		}
+		for _, name := range []string{"index.html", "docs/guide.html"} {
+			info, err := fs.Stat(fsys, name)
+			if nil != err {
+				t.Fatalf("While getting info of %s got %v", name, err)
+			}
+			if tagged, ok := info.Sys().(ETagger); !ok || !strings.HasPrefix(tagged.ETag(), `"`) {
+				t.Errorf("While getting info of %s expected an entity tag but got %v", name, info.Sys())
+			}
+		}
+		if _, ok := fsys.Gzipped("notes.qq"); !ok {
+			t.Error("Expected a gzip variant of the configured text type")
+		}
+		if _, ok := fsys.Gzipped("photo.png"); ok {
+			t.Error("Expected no gzip variant of an image")
+		}
+
+		// Content held in memory no longer reads the wrapped file system.
+		mapFS["docs/guide.html"].Data = []byte("GUIDE")
+		contents, err := fs.ReadFile(fsys, "docs/guide.html")
+		if nil != err {
+			t.Errorf("While reading docs/guide.html got %v", err)
+		}
+		if expected := map[bool]string{false: "GUIDE", true: "guide"}[inMemory]; expected != string(contents) {
+			t.Errorf("While reading docs/guide.html in memory (%t) expected '%s' but got '%s'", inMemory, expected, contents)
+		}
+	}
+}
+
+func TestPreloadArchives(t *testing.T) {
+	dir := t.TempDir()
+	writeZip(t, filepath.Join(dir, "docs.zip"))
+	for _, inMemory := range []bool{false, true} {
+		fsys, err := Preload(Local(dir), inMemory, testTypeByExtension)
+		if nil != err {
+			t.Fatalf("While preloading got %v", err)
+		}
+		archive, err := NewArchives(fsys).Open("docs.zip")
+		if nil != err {
+			t.Fatalf("While opening a preloaded archive (in memory: %t) got %v", inMemory, err)
+		}
+		for name, expected := range archiveContents {
+			contents, err := fs.ReadFile(archive, name)
+			if nil != err || expected != string(contents) {
+				t.Errorf("While reading %s (in memory: %t) expected '%s' but got '%s' and %v", name, inMemory, expected, contents, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,488 @@
+package storage
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultS3Timeout is the timeout of requests to object storage when none is
+// configured.
+const defaultS3Timeout = 30 * time.Second
+
+var (
+	// now is the time used to sign requests. Overridden to simplify unit
+	// testing.
+	now = time.Now
+)
+
+// ETagger is implemented by the value returned by Sys() for the file
+// information of backends that provide entity tags for their files.
+type ETagger interface {
+	ETag() string
+}
+
+// S3Config is the location of, and credentials for, a bucket in S3-compatible
+// object storage.
+type S3Config struct {
+	// Endpoint is the URL of the object storage service (e.g.
+	// 'https://s3.amazonaws.com' or 'http://localhost:9000').
+	Endpoint string
+	// Region used to sign requests. Defaults to 'us-east-1'.
+	Region string
+	Bucket string
+	// Prefix of the keys of the objects to serve (e.g. 'sites/docs').
+	Prefix string
+	// AccessKey and SecretKey used to sign requests. If not set, requests are
+	// anonymous.
+	AccessKey string
+	SecretKey string
+	// PathStyle places the bucket in the URL path rather than the hostname.
+	PathStyle bool
+	// Timeout of connecting to the service and of waiting for the headers of
+	// responses. Defaults to 30 seconds.
+	Timeout time.Duration
+	// Client used for requests. Defaults to a client with the timeout.
+	Client *http.Client
+}
+
+// S3FS is a read-only file system of the objects within a bucket of
+// S3-compatible object storage. Keys are split on '/' into directories, which
+// are listed with ListObjectsV2 and exist as long as they contain objects.
+// Files opened from the file system implement io.Seeker and io.ReaderAt using
+// ranged requests, so only the requested parts of objects are transferred, and
+// their file information implements ETagger.
+type S3FS struct {
+	config S3Config
+	bucket *url.URL
+}
+
+// NewS3 returns the file system of the bucket.
+func NewS3(config S3Config) (*S3FS, error) {
+	bucket, err := url.Parse(config.Endpoint)
+	if nil != err {
+		return nil, err
+	}
+	if (bucket.Scheme != "http" && bucket.Scheme != "https") || bucket.Host == "" {
+		return nil, fmt.Errorf("endpoint '%s' is not an HTTP(S) URL", config.Endpoint)
+	}
+	if config.Bucket == "" {
+		return nil, errors.New("bucket is not set")
+	}
+
+	bucket.Path = strings.TrimSuffix(bucket.Path, "/")
+	if config.PathStyle {
+		bucket.Path += "/" + config.Bucket
+	} else {
+		bucket.Host = config.Bucket + "." + bucket.Host
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultS3Timeout
+	}
+	if config.Client == nil {
+		config.Client = newS3Client(config.Timeout)
+	}
+	config.Prefix = strings.Trim(config.Prefix, "/")
+	return &S3FS{config: config, bucket: bucket}, nil
+}
+
+// newS3Client returns a client whose requests fail if connecting or waiting for
+// the headers of a response takes longer than the timeout. The time taken to
+// transfer the contents of objects isn't limited, so that large objects can be
+// streamed to slow clients.
+func newS3Client(timeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}).DialContext
+	transport.TLSHandshakeTimeout = timeout
+	transport.ResponseHeaderTimeout = timeout
+	return &http.Client{Transport: transport}
+}
+
+// key returns the object key of the named file.
+func (fsys *S3FS) key(name string) string {
+	if name == "." {
+		return fsys.config.Prefix
+	}
+	return strings.TrimPrefix(fsys.config.Prefix+"/"+name, "/")
+}
+
+// do sends a request for the object key, or the bucket if the key is empty.
+func (fsys *S3FS) do(method, key string, query url.Values, header http.Header) (*http.Response, error) {
+	target := fsys.bucket.Scheme + "://" + fsys.bucket.Host +
+		awsEscape(fsys.bucket.Path+"/"+key, true)
+	if 0 < len(query) {
+		target += "?" + canonicalQuery(query)
+	}
+	req, err := http.NewRequest(method, target, nil)
+	if nil != err {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if fsys.config.AccessKey != "" {
+		signV4(req, fsys.config.AccessKey, fsys.config.SecretKey, fsys.config.Region, "s3", now())
+	}
+	return fsys.config.Client.Do(req)
+}
+
+// Open the named file or directory.
+func (fsys *S3FS) Open(name string) (fs.File, error) {
+	info, err := fsys.stat("open", name)
+	if nil != err {
+		return nil, err
+	}
+	if info.IsDir() {
+		return &s3Dir{fsys: fsys, name: name, info: info}, nil
+	}
+	return &s3File{fsys: fsys, key: fsys.key(name), info: info}, nil
+}
+
+// Stat returns the file information of the named file or directory.
+func (fsys *S3FS) Stat(name string) (fs.FileInfo, error) {
+	return fsys.stat("stat", name)
+}
+
+// stat returns the file information of the object with the name or, if there
+// is no such object, of the directory with the name.
+func (fsys *S3FS) stat(op, name string) (*s3Object, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return &s3Object{name: ".", dir: true}, nil
+	}
+
+	resp, err := fsys.do(http.MethodHead, fsys.key(name), nil, nil)
+	if nil != err {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		size, _ := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+		modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+		return &s3Object{
+			name:    path.Base(name),
+			size:    size,
+			modTime: modTime,
+			etag:    resp.Header.Get("ETag"),
+		}, nil
+	}
+	if resp.StatusCode != http.StatusNotFound {
+		return nil, statusError(op, name, resp)
+	}
+
+	result, err := fsys.list(name, "", 1)
+	if nil != err {
+		return nil, err
+	}
+	if len(result.Contents) == 0 && len(result.CommonPrefixes) == 0 {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return &s3Object{name: path.Base(name), dir: true}, nil
+}
+
+// ReadDir reads the named directory and returns its entries sorted by name.
+func (fsys *S3FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+
+	var entries []fs.DirEntry
+	token := ""
+	for {
+		result, err := fsys.list(name, token, 0)
+		if nil != err {
+			return nil, err
+		}
+		for _, prefix := range result.CommonPrefixes {
+			if child := strings.TrimSuffix(prefix.Prefix[len(result.Prefix):], "/"); validName(child) {
+				entries = append(entries, &s3Object{name: child, dir: true})
+			}
+		}
+		for _, object := range result.Contents {
+			if child := object.Key[len(result.Prefix):]; validName(child) {
+				entries = append(entries, &s3Object{
+					name:    child,
+					size:    object.Size,
+					modTime: object.LastModified.Truncate(time.Second),
+					etag:    object.ETag,
+				})
+			}
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+
+	if len(entries) == 0 && name != "." {
+		// Directories only exist while they contain objects.
+		if _, err := fsys.stat("readdir", name); nil != err {
+			return nil, err
+		}
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+// listBucketResult is the response to a ListObjectsV2 request.
+type listBucketResult struct {
+	Prefix                string
+	IsTruncated           bool
+	NextContinuationToken string
+	Contents              []struct {
+		Key          string
+		LastModified time.Time
+		ETag         string
+		Size         int64
+	}
+	CommonPrefixes []struct {
+		Prefix string
+	}
+}
+
+// list the objects and common prefixes within the named directory starting at
+// the continuation token, if any. If maxKeys is zero, the service default is
+// used.
+func (fsys *S3FS) list(name, token string, maxKeys int) (*listBucketResult, error) {
+	prefix := fsys.key(name)
+	if prefix != "" {
+		prefix += "/"
+	}
+	query := url.Values{
+		"list-type": {"2"},
+		"delimiter": {"/"},
+		"prefix":    {prefix},
+	}
+	if token != "" {
+		query.Set("continuation-token", token)
+	}
+	if 0 < maxKeys {
+		query.Set("max-keys", strconv.Itoa(maxKeys))
+	}
+
+	resp, err := fsys.do(http.MethodGet, "", query, nil)
+	if nil != err {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError("readdir", name, resp)
+	}
+	result := &listBucketResult{}
+	if err = xml.NewDecoder(resp.Body).Decode(result); nil != err {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	// Some services omit the prefix from the response.
+	result.Prefix = prefix
+	return result, nil
+}
+
+// validName returns true if the name is a single valid path element.
+func validName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.Contains(name, "/")
+}
+
+// statusError returns the error for an unsuccessful response.
+func statusError(op, name string, resp *http.Response) error {
+	err := fmt.Errorf("unexpected status '%s'", resp.Status)
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		err = fs.ErrNotExist
+	case http.StatusUnauthorized, http.StatusForbidden:
+		err = fs.ErrPermission
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+// s3Object is an object or directory within a bucket. It serves as the
+// fs.FileInfo and fs.DirEntry of the object or directory.
+type s3Object struct {
+	name    string
+	size    int64
+	modTime time.Time
+	etag    string
+	dir     bool
+}
+
+func (object *s3Object) Name() string               { return object.name }
+func (object *s3Object) Size() int64                { return object.size }
+func (object *s3Object) ModTime() time.Time         { return object.modTime }
+func (object *s3Object) IsDir() bool                { return object.dir }
+func (object *s3Object) Sys() interface{}           { return object }
+func (object *s3Object) Type() fs.FileMode          { return object.Mode().Type() }
+func (object *s3Object) Info() (fs.FileInfo, error) { return object, nil }
+
+// ETag of the object, including the surrounding quotes.
+func (object *s3Object) ETag() string { return object.etag }
+
+// Mode of the object, which is read-only.
+func (object *s3Object) Mode() fs.FileMode {
+	if object.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+// s3File is an open object. The contents are read from the current offset with
+// a ranged request that is reused until the offset is changed by seeking.
+type s3File struct {
+	fsys   *S3FS
+	key    string
+	info   *s3Object
+	offset int64
+	body   io.ReadCloser
+}
+
+func (file *s3File) Stat() (fs.FileInfo, error) { return file.info, nil }
+
+// Read the contents of the object from the current offset.
+func (file *s3File) Read(b []byte) (int, error) {
+	if file.offset >= file.info.size {
+		return 0, io.EOF
+	}
+	if file.body == nil {
+		body, err := file.get(file.offset, -1)
+		if nil != err {
+			return 0, err
+		}
+		file.body = body
+	}
+	n, err := file.body.Read(b)
+	file.offset += int64(n)
+	if err == io.EOF && file.offset < file.info.size {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// Seek sets the offset for the next Read.
+func (file *s3File) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += file.offset
+	case io.SeekEnd:
+		offset += file.info.size
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: file.info.name, Err: fs.ErrInvalid}
+	}
+	if offset != file.offset && file.body != nil {
+		file.body.Close()
+		file.body = nil
+	}
+	file.offset = offset
+	return offset, nil
+}
+
+// ReadAt reads len(b) bytes of the object starting at the offset.
+func (file *s3File) ReadAt(b []byte, offset int64) (int, error) {
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "read", Path: file.info.name, Err: fs.ErrInvalid}
+	}
+	if offset >= file.info.size {
+		return 0, io.EOF
+	}
+	if len(b) == 0 {
+		return 0, nil
+	}
+	body, err := file.get(offset, offset+int64(len(b))-1)
+	if nil != err {
+		return 0, err
+	}
+	defer body.Close()
+	n, err := io.ReadFull(body, b)
+	if err == io.ErrUnexpectedEOF && offset+int64(n) == file.info.size {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// get the contents of the object from start to end, inclusive, or to the end
+// of the object if end is negative. The request fails if the object has
+// changed since it was opened.
+func (file *s3File) get(start, end int64) (io.ReadCloser, error) {
+	header := http.Header{"Range": {fmt.Sprintf("bytes=%d-", start)}}
+	if 0 <= end {
+		header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+	}
+	if file.info.etag != "" {
+		header.Set("If-Match", file.info.etag)
+	}
+
+	resp, err := file.fsys.do(http.MethodGet, file.key, nil, header)
+	if nil != err {
+		return nil, &fs.PathError{Op: "read", Path: file.info.name, Err: err}
+	}
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		return resp.Body, nil
+	case http.StatusOK:
+		// The range was ignored, so skip to the start.
+		if _, err = io.CopyN(ioutil.Discard, resp.Body, start); nil != err {
+			resp.Body.Close()
+			return nil, &fs.PathError{Op: "read", Path: file.info.name, Err: err}
+		}
+		return resp.Body, nil
+	}
+	resp.Body.Close()
+	return nil, statusError("read", file.info.name, resp)
+}
+
+// Close the file.
+func (file *s3File) Close() error {
+	if file.body == nil {
+		return nil
+	}
+	err := file.body.Close()
+	file.body = nil
+	return err
+}
+
+// s3Dir is an open directory within a bucket. Entries are listed on the first
+// call to ReadDir.
+type s3Dir struct {
+	fsys    *S3FS
+	name    string
+	info    *s3Object
+	entries *dirEntries
+}
+
+func (dir *s3Dir) Stat() (fs.FileInfo, error) { return dir.info, nil }
+func (dir *s3Dir) Close() error               { return nil }
+
+// Read always fails as directories have no contents.
+func (dir *s3Dir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: dir.name, Err: errors.New("is a directory")}
+}
+
+// ReadDir returns the next n entries of the directory or, if n <= 0, all
+// remaining entries.
+func (dir *s3Dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if dir.entries == nil {
+		entries, err := dir.fsys.ReadDir(dir.name)
+		if nil != err {
+			return nil, err
+		}
+		dir.entries = &dirEntries{entries: entries}
+	}
+	return dir.entries.next(n)
+}
@@ -0,0 +1,144 @@
+//go:build linux
+
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+// inotifyMask is the inotify events of changes to the metadata of files.
+const inotifyMask = syscall.IN_ATTRIB | syscall.IN_CREATE | syscall.IN_DELETE |
+	syscall.IN_DELETE_SELF | syscall.IN_MODIFY | syscall.IN_MOVED_FROM |
+	syscall.IN_MOVED_TO | syscall.IN_MOVE_SELF
+
+// inotifyWatcher watches the directories of a folder with inotify.
+type inotifyWatcher struct {
+	fsys   *MetadataFS
+	folder string
+	fd     int
+	file   *os.File
+	// dirs maps watch descriptors to the names of the watched directories.
+	dirs map[int32]string
+}
+
+// watch the folder and its subdirectories with inotify, invalidating the
+// metadata of changed files.
+func (fsys *MetadataFS) watch(folder string) (io.Closer, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if nil != err {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	// As the descriptor is non-blocking, reads are handled by the runtime
+	// poller and are interrupted when the file is closed. The descriptor is
+	// kept rather than calling Fd, which makes it blocking.
+	watcher := &inotifyWatcher{
+		fsys:   fsys,
+		folder: folder,
+		fd:     fd,
+		file:   os.NewFile(uintptr(fd), "inotify"),
+		dirs:   make(map[int32]string),
+	}
+	if err := watcher.add("."); nil != err {
+		watcher.file.Close()
+		return nil, err
+	}
+	go watcher.run()
+	return watcher.file, nil
+}
+
+// add watches for the named directory and its subdirectories.
+func (watcher *inotifyWatcher) add(name string) error {
+	root := filepath.Join(watcher.folder, filepath.FromSlash(name))
+	return filepath.WalkDir(root, func(filename string, entry fs.DirEntry, err error) error {
+		if nil != err {
+			// Directories removed while being walked are skipped.
+			if filename != root && os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !entry.IsDir() {
+			return nil
+		}
+		wd, err := syscall.InotifyAddWatch(
+			watcher.fd, filename, inotifyMask|syscall.IN_ONLYDIR,
+		)
+		if nil != err {
+			return os.NewSyscallError("inotify_add_watch", err)
+		}
+		relative, err := filepath.Rel(watcher.folder, filename)
+		if nil != err {
+			return err
+		}
+		watcher.dirs[int32(wd)] = filepath.ToSlash(relative)
+		return nil
+	})
+}
+
+// run reads inotify events until the watcher is closed.
+func (watcher *inotifyWatcher) run() {
+	buf := make([]byte, 64*1024)
+	for {
+		count, err := watcher.file.Read(buf)
+		if nil != err {
+			if !errors.Is(err, os.ErrClosed) {
+				log.Printf("Failed to watch %s: %v\n", watcher.folder, err)
+				watcher.fsys.unwatch()
+			}
+			return
+		}
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= count; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + syscall.SizeofInotifyEvent
+			nameEnd := nameStart + int(event.Len)
+			name := string(bytes.TrimRight(buf[nameStart:nameEnd], "\x00"))
+			offset = nameEnd
+			watcher.handle(event, name)
+		}
+	}
+}
+
+// handle the inotify event of the named file within a watched directory.
+func (watcher *inotifyWatcher) handle(event *syscall.InotifyEvent, name string) {
+	if 0 != event.Mask&syscall.IN_Q_OVERFLOW {
+		// Events were lost, so nothing cached can be trusted.
+		watcher.fsys.reset()
+		return
+	}
+	dir, ok := watcher.dirs[event.Wd]
+	if !ok {
+		return
+	}
+	if 0 != event.Mask&syscall.IN_IGNORED {
+		delete(watcher.dirs, event.Wd)
+		// Without a watch of the folder itself, such as when it was removed,
+		// changes would no longer invalidate the cache.
+		if "." == dir {
+			watcher.fsys.unwatch()
+		}
+		return
+	}
+
+	isDir := 0 != event.Mask&syscall.IN_ISDIR
+	if "" == name {
+		// The watched directory itself changed.
+		watcher.fsys.invalidate(dir, true)
+		return
+	}
+	name = path.Join(dir, name)
+	watcher.fsys.invalidate(name, isDir)
+	if isDir && 0 != event.Mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) {
+		if err := watcher.add(name); nil != err {
+			log.Printf("Failed to watch %s: %v\n", name, err)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+//go:build linux
+
+package storage
+
+import (
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMetadataWatch(t *testing.T) {
+	folder := t.TempDir()
+	fsys := Metadata(Local(folder), time.Hour)
+	if err := fsys.Watch(folder); nil != err {
+		t.Fatalf("While watching %s got %v", folder, err)
+	}
+	defer fsys.Close()
+
+	// eventually waits for the change to be seen through the cache.
+	eventually := func(name string, exists bool) {
+		for start := time.Now(); time.Since(start) < 5*time.Second; {
+			_, err := fs.Stat(fsys, name)
+			if exists == (nil == err) {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Errorf("While watching %s expected it to exist (%t) but it didn't", name, exists)
+	}
+
+	for _, name := range []string{"index.html", "docs/guide.html"} {
+		if _, err := fs.Stat(fsys, name); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("While getting info of %s expected %v but got %v", name, fs.ErrNotExist, err)
+		}
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(folder, "index.html"), []byte("index"), 0600); nil != err {
+		t.Fatalf("While writing file got %v", err)
+	}
+	eventually("index.html", true)
+
+	// Files within new directories are watched too.
+	if err := os.Mkdir(filepath.Join(folder, "docs"), 0700); nil != err {
+		t.Fatalf("While creating directory got %v", err)
+	}
+	eventually("docs", true)
+	if err := ioutil.WriteFile(filepath.Join(folder, "docs", "guide.html"), []byte("guide"), 0600); nil != err {
+		t.Fatalf("While writing file got %v", err)
+	}
+	eventually("docs/guide.html", true)
+
+	if err := os.RemoveAll(filepath.Join(folder, "docs")); nil != err {
+		t.Fatalf("While removing directory got %v", err)
+	}
+	eventually("docs/guide.html", false)
+}
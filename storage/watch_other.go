@@ -0,0 +1,14 @@
+//go:build !linux
+
+package storage
+
+import (
+	"errors"
+	"io"
+)
+
+// watch is unsupported on platforms other than Linux, where cached metadata
+// expires instead.
+func (fsys *MetadataFS) watch(folder string) (io.Closer, error) {
+	return nil, errors.New("watching for changes is only supported on Linux")
+}